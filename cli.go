@@ -0,0 +1,338 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/osprogramadores/op-web-linter/lang"
+)
+
+// Exit codes for the lint subcommand.
+const (
+	exitPass  = 0 // All files passed.
+	exitFail  = 1 // Problems found (or files need reformatting).
+	exitError = 2 // Usage or execution errors.
+)
+
+// Alternative file extensions for the built-in languages.
+var langExtensionAliases = map[string]string{
+	"bash": "sh",
+	"cc":   "cpp",
+	"cxx":  "cpp",
+}
+
+// lintCommand implements the "lint" subcommand, linting files without
+// starting the HTTP server. Returns the exit code.
+func lintCommand(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s lint [flags] file...\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(fs.Output(), "Archives (.zip, .tar.gz or .tgz) are linted as multi-file programs.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	var (
+		langname = fs.String("lang", "", "Language of the files (default: guess from the file extension)")
+		write    = fs.Bool("write", false, "Write reformatted code back to the files")
+		fix      = fs.Bool("fix", false, "Apply the automatic fixes of the linters (where available)")
+		langfile = fs.String("languages", "", "JSON file with additional language definitions (optional)")
+		chaldir  = fs.String("challenges", "", "Directory with challenge profiles (optional)")
+		chal     = fs.String("challenge", "", "Check the house rules of this challenge (requires --challenges)")
+		sandbox  = fs.Bool("sandbox", true, "Run external tools inside a sandbox")
+		writable = fs.String("sandbox-writable", "", "Colon separated list of paths kept writable inside the sandbox")
+		overlay  = fs.String("sandbox-overlay", defaultSandboxOverlay(), "Colon separated list of paths writable inside the sandbox through an overlay (changes are discarded)")
+		gochecks = fs.String("go-checks", strings.Join(lang.DefaultGoChecks, ","), "Comma separated list of staticcheck checks run on Go programs")
+		govet    = fs.String("go-vet-checks", strings.Join(lang.DefaultGoVetChecks, ","), "Comma separated list of go vet analyzers run on Go programs")
+		loglevel = fs.String("log-level", "warn", "Minimum log level (debug, info, warn or error)")
+	)
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitError
+	}
+
+	logger, err := newLogger("text", *loglevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting up logging: %v\n", err)
+		return exitError
+	}
+	slog.SetDefault(logger)
+
+	lang.Sandbox.Enabled = *sandbox
+	if *writable != "" {
+		lang.Sandbox.Writable = strings.Split(*writable, ":")
+	}
+	if *overlay != "" {
+		lang.Sandbox.Overlay = strings.Split(*overlay, ":")
+	}
+	lang.GoChecks = strings.Split(*gochecks, ",")
+	lang.GoVetChecks = strings.Split(*govet, ",")
+	if err := lang.CheckGoVetChecks(lang.GoVetChecks); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing --go-vet-checks: %v\n", err)
+		return exitError
+	}
+	if err := loadLanguages(*langfile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading languages: %v\n", err)
+		return exitError
+	}
+	if *chaldir != "" {
+		if lang.Challenges, err = lang.LoadChallenges(*chaldir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading challenges: %v\n", err)
+			return exitError
+		}
+	}
+
+	// Kill running tools on interrupt.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	ret := exitPass
+	for _, fname := range fs.Args() {
+		lint := lintFile
+		if isArchive(fname) {
+			lint = lintArchive
+		}
+		code := lint(ctx, os.Stdout, fname, *langname, *chal, *write, *fix)
+		if code > ret {
+			ret = code
+		}
+	}
+	return ret
+}
+
+// lintFile lints a single file, printing diagnostics and the reformatted
+// (and fixed, if fix is true) code to w, or rewriting the file if write is
+// true. The file is also checked against the house rules of the challenge,
+// if not empty. Returns the exit code.
+func lintFile(ctx context.Context, w io.Writer, fname, langname, challenge string, write, fix bool) int {
+	if langname == "" {
+		langname = guessLang(fname)
+	}
+	if _, ok := supported.Get(langname); !ok {
+		fmt.Fprintf(os.Stderr, "%s: unknown language %q (use --lang, one of: %s)\n", fname, langname, strings.Join(supported.Names(), ", "))
+		return exitError
+	}
+
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return exitError
+	}
+
+	resp, err := supported.Lint(ctx, lang.LintRequest{Text: string(data), Lang: langname, Fix: fix, Challenge: challenge})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", fname, err)
+		return exitError
+	}
+
+	// New program text, if reformatted or fixed.
+	changed, text := resp.Reformatted || resp.Fixed, resp.ReformattedText
+	if resp.Fixed {
+		text = resp.FixedText
+	}
+
+	for _, d := range resp.Diagnostics {
+		// Refer to the text in the file: the original text, unless we
+		// rewrite it below.
+		if !write || !changed {
+			d = originalPosition(d)
+		}
+		fmt.Fprintln(w, formatDiagnostic(fname, d))
+	}
+
+	ret := exitPass
+	if !resp.Pass {
+		ret = exitFail
+	}
+
+	if !changed {
+		return ret
+	}
+	what, msg := "reformatted", "needs reformatting. Reformatted code"
+	if resp.Fixed {
+		what, msg = "fixed", "has fixable problems. Fixed code"
+	}
+	if write {
+		if err := os.WriteFile(fname, []byte(text), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return exitError
+		}
+		fmt.Fprintf(w, "%s: %s\n", fname, what)
+		return ret
+	}
+	fmt.Fprintf(w, "%s: %s:\n%s", fname, msg, text)
+	if !strings.HasSuffix(text, "\n") {
+		fmt.Fprintln(w)
+	}
+	return exitFail
+}
+
+// lintArchive lints the files in an archive as a multi-file program,
+// printing diagnostics and the reformatted (and fixed, if fix is true) files
+// to w, like lintFile. Archives can't be rewritten, so write must be false.
+// Returns the exit code.
+func lintArchive(ctx context.Context, w io.Writer, fname, langname, challenge string, write, fix bool) int {
+	if write {
+		fmt.Fprintf(os.Stderr, "%s: --write is not supported for archives\n", fname)
+		return exitError
+	}
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return exitError
+	}
+	files, err := lang.ReadArchive(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", fname, err)
+		return exitError
+	}
+
+	// Use the language of the first file with a known extension.
+	for _, f := range files {
+		if langname != "" {
+			break
+		}
+		langname = guessLang(f.Path)
+	}
+	if _, ok := supported.Get(langname); !ok {
+		fmt.Fprintf(os.Stderr, "%s: unknown language %q (use --lang, one of: %s)\n", fname, langname, strings.Join(supported.Names(), ", "))
+		return exitError
+	}
+
+	resp, err := supported.Lint(ctx, lang.LintRequest{Lang: langname, Fix: fix, Files: files, Challenge: challenge})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", fname, err)
+		return exitError
+	}
+
+	// Diagnostics refer to the files in the archive.
+	for _, d := range resp.Diagnostics {
+		name := fname
+		if d.File != "" {
+			name, d.File = d.File, ""
+		}
+		fmt.Fprintln(w, formatDiagnostic(name, originalPosition(d)))
+	}
+
+	ret := exitPass
+	if !resp.Pass {
+		ret = exitFail
+	}
+	for _, f := range resp.Files {
+		if !f.Reformatted && !f.Fixed {
+			continue
+		}
+		text, msg := f.ReformattedText, "needs reformatting. Reformatted code"
+		if f.Fixed {
+			text, msg = f.FixedText, "has fixable problems. Fixed code"
+		}
+		fmt.Fprintf(w, "%s: %s:\n%s", f.Path, msg, text)
+		if !strings.HasSuffix(text, "\n") {
+			fmt.Fprintln(w)
+		}
+		ret = exitFail
+	}
+	return ret
+}
+
+// isArchive returns true if the file name has the extension of a supported
+// archive format.
+func isArchive(fname string) bool {
+	fname = strings.ToLower(fname)
+	return strings.HasSuffix(fname, ".zip") || strings.HasSuffix(fname, ".tar.gz") || strings.HasSuffix(fname, ".tgz")
+}
+
+// formatDiagnostic formats a diagnostic in the usual compiler style
+// (file:line:col: severity: message [rule]), followed by the context
+// lines, if any.
+func formatDiagnostic(fname string, d lang.Diagnostic) string {
+	var sb strings.Builder
+
+	sb.WriteString(fname)
+	if d.Line > 0 {
+		fmt.Fprintf(&sb, ":%d", d.Line)
+		if d.Column > 0 {
+			fmt.Fprintf(&sb, ":%d", d.Column)
+		}
+	}
+	sb.WriteString(": ")
+	if d.Severity != "" {
+		sb.WriteString(d.Severity + ": ")
+	}
+	sb.WriteString(d.Message)
+	if d.RuleID != "" {
+		sb.WriteString(" [" + d.RuleID + "]")
+	}
+	if d.Tool != "" {
+		sb.WriteString(" (" + d.Tool + ")")
+	}
+	for _, line := range d.Context {
+		sb.WriteString("\n\t" + line)
+	}
+	return sb.String()
+}
+
+// originalPosition returns the diagnostic with its position translated to
+// the original text. Columns are dropped if the tool ran on the reformatted
+// text.
+func originalPosition(d lang.Diagnostic) lang.Diagnostic {
+	if d.Source != lang.SourceOriginal {
+		d.Column, d.EndColumn = 0, 0
+	}
+	d.Line, d.EndLine = d.OriginalLine, d.OriginalEndLine
+	return d
+}
+
+// guessLang returns the language name for a file based on its extension,
+// or "" if unknown. Languages are tried in alphabetical order.
+func guessLang(fname string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(fname), "."))
+	if alias, ok := langExtensionAliases[ext]; ok {
+		ext = alias
+	}
+	for _, name := range supported.Names() {
+		if supported[name].Extension == ext {
+			return name
+		}
+	}
+	return ""
+}
+
+// loadLanguages adds the languages defined in the configuration file (if
+// not empty) to the supported languages. These take precedence over the
+// built-in languages with the same name.
+func loadLanguages(fname string) error {
+	if fname == "" {
+		return nil
+	}
+	langs, err := lang.LoadLanguages(fname)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(langs))
+	for name := range langs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := supported[name]; ok {
+			slog.Warn("Language from file overrides built-in definition", "lang", name, "file", fname)
+		}
+		supported[name] = langs[name]
+	}
+	slog.Info("Loaded languages", "count", len(langs), "file", fname)
+	return nil
+}
@@ -0,0 +1,247 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/osprogramadores/op-web-linter/lang"
+)
+
+func TestFormatDiagnostic(t *testing.T) {
+	tests := []struct {
+		d    lang.Diagnostic
+		want string
+	}{
+		{
+			lang.Diagnostic{Tool: "clang-tidy", Line: 3, Column: 5, Severity: "warning", RuleID: "bugprone-x", Message: "bad", Context: []string{"  int x;", "  ^"}},
+			"prog.c:3:5: warning: bad [bugprone-x] (clang-tidy)\n\t  int x;\n\t  ^",
+		},
+		{
+			lang.Diagnostic{Line: 3, Message: "no column"},
+			"prog.c:3: no column",
+		},
+		{
+			lang.Diagnostic{Tool: "gcc", Severity: "error", Message: "global"},
+			"prog.c: error: global (gcc)",
+		},
+	}
+	for _, tt := range tests {
+		if got := formatDiagnostic("prog.c", tt.d); got != tt.want {
+			t.Errorf("formatDiagnostic(%+v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestOriginalPosition(t *testing.T) {
+	tests := []struct {
+		d    lang.Diagnostic
+		want lang.Diagnostic
+	}{
+		{
+			lang.Diagnostic{Line: 3, Column: 5, EndLine: 3, EndColumn: 7, Source: lang.SourceOriginal, OriginalLine: 3, OriginalEndLine: 3},
+			lang.Diagnostic{Line: 3, Column: 5, EndLine: 3, EndColumn: 7, Source: lang.SourceOriginal, OriginalLine: 3, OriginalEndLine: 3},
+		},
+		{
+			lang.Diagnostic{Line: 4, Column: 5, EndLine: 5, EndColumn: 7, Source: lang.SourceReformatted, OriginalLine: 2, OriginalEndLine: 3},
+			lang.Diagnostic{Line: 2, EndLine: 3, Source: lang.SourceReformatted, OriginalLine: 2, OriginalEndLine: 3},
+		},
+	}
+	for _, tt := range tests {
+		if got := originalPosition(tt.d); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("originalPosition(%+v) = %+v, want %+v", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestGuessLang(t *testing.T) {
+	tests := []struct {
+		fname string
+		want  string
+	}{
+		{"prog.c", "c"},
+		{"dir/prog.CPP", "cpp"},
+		{"prog.cc", "cpp"},
+		{"prog.go", "golang"},
+		{"prog.py", "python"},
+		{"script.sh", "bash"},
+		{"script.bash", "bash"},
+		{"prog", ""},
+		{"prog.unknown", ""},
+	}
+	for _, tt := range tests {
+		if got := guessLang(tt.fname); got != tt.want {
+			t.Errorf("guessLang(%q) = %q, want %q", tt.fname, got, tt.want)
+		}
+	}
+}
+
+// setTestLanguage adds a fake "test" language (extension "tst") to the
+// supported languages until the test ends. The fake linter uppercases the
+// program and fails if it changed.
+func setTestLanguage(t *testing.T) {
+	saved := supported["test"]
+	t.Cleanup(func() {
+		if saved.Linter == nil {
+			delete(supported, "test")
+		} else {
+			supported["test"] = saved
+		}
+	})
+	supported["test"] = lang.Language{
+		Display:   "Test",
+		Extension: "tst",
+		Linter: lang.LinterFunc(func(ctx context.Context, req lang.LintRequest) (lang.LintResponse, error) {
+			upper := strings.ToUpper(req.Text)
+			if upper == req.Text {
+				return lang.LintResponse{Pass: true}, nil
+			}
+			resp := lang.LintResponse{
+				Diagnostics:     []lang.Diagnostic{{Tool: "upper", Line: 1, Message: "lowercase"}},
+				Reformatted:     true,
+				ReformattedText: upper,
+			}
+			if req.Fix {
+				resp.Fixed, resp.FixedText = true, strings.ReplaceAll(upper, "BAD", "GOOD")
+			}
+			return resp, nil
+		}),
+	}
+}
+
+func TestLintFile(t *testing.T) {
+	setTestLanguage(t)
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		text     string
+		write    bool
+		fix      bool
+		want     int
+		wantOut  string
+		wantFile string
+	}{
+		{
+			name:     "pass",
+			text:     "OK\n",
+			want:     exitPass,
+			wantFile: "OK\n",
+		},
+		{
+			name:     "needs reformatting",
+			text:     "ok\n",
+			want:     exitFail,
+			wantOut:  "{file}:1: lowercase (upper)\n{file}: needs reformatting. Reformatted code:\nOK\n",
+			wantFile: "ok\n",
+		},
+		{
+			name:     "write",
+			text:     "ok\n",
+			write:    true,
+			want:     exitFail,
+			wantOut:  "{file}:1: lowercase (upper)\n{file}: reformatted\n",
+			wantFile: "OK\n",
+		},
+		{
+			name:     "fix",
+			text:     "bad\n",
+			fix:      true,
+			want:     exitFail,
+			wantOut:  "{file}:1: lowercase (upper)\n{file}: has fixable problems. Fixed code:\nGOOD\n",
+			wantFile: "bad\n",
+		},
+		{
+			name:     "write fix",
+			text:     "bad\n",
+			write:    true,
+			fix:      true,
+			want:     exitFail,
+			wantOut:  "{file}:1: lowercase (upper)\n{file}: fixed\n",
+			wantFile: "GOOD\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fname := filepath.Join(dir, tt.name+".tst")
+			if err := os.WriteFile(fname, []byte(tt.text), 0644); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if got := lintFile(context.Background(), &out, fname, "", "", tt.write, tt.fix); got != tt.want {
+				t.Errorf("lintFile returned %d, want %d", got, tt.want)
+			}
+			if want := strings.ReplaceAll(tt.wantOut, "{file}", fname); out.String() != want {
+				t.Errorf("lintFile printed %q, want %q", out.String(), want)
+			}
+			if data, _ := os.ReadFile(fname); string(data) != tt.wantFile {
+				t.Errorf("File contains %q after lintFile, want %q", data, tt.wantFile)
+			}
+		})
+	}
+
+	// Unknown languages are errors.
+	if got := lintFile(context.Background(), &bytes.Buffer{}, filepath.Join(dir, "prog.unknown"), "", "", false, false); got != exitError {
+		t.Errorf("lintFile for an unknown language returned %d, want %d", got, exitError)
+	}
+}
+
+func TestIsArchive(t *testing.T) {
+	tests := []struct {
+		fname string
+		want  bool
+	}{
+		{"prog.zip", true},
+		{"PROG.ZIP", true},
+		{"prog.tar.gz", true},
+		{"prog.tgz", true},
+		{"prog.tar", false},
+		{"prog.c", false},
+	}
+	for _, tt := range tests {
+		if got := isArchive(tt.fname); got != tt.want {
+			t.Errorf("isArchive(%q) = %v, want %v", tt.fname, got, tt.want)
+		}
+	}
+}
+
+func TestLintArchive(t *testing.T) {
+	setTestLanguage(t)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, text := range map[string]string{"a.tst": "OK\n", "src/b.tst": "ok\n"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(text))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fname := filepath.Join(t.TempDir(), "prog.zip")
+	if err := os.WriteFile(fname, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if got := lintArchive(context.Background(), &out, fname, "", "", false, false); got != exitFail {
+		t.Errorf("lintArchive returned %d, want %d", got, exitFail)
+	}
+	if want := "src/b.tst:1: lowercase (upper)\nsrc/b.tst: needs reformatting. Reformatted code:\nOK\n"; out.String() != want {
+		t.Errorf("lintArchive printed %q, want %q", out.String(), want)
+	}
+
+	// Archives can't be rewritten.
+	if got := lintArchive(context.Background(), &bytes.Buffer{}, fname, "", "", true, false); got != exitError {
+		t.Errorf("lintArchive with write returned %d, want %d", got, exitError)
+	}
+}
@@ -6,7 +6,6 @@ package common
 import (
 	"fmt"
 	"html"
-	"log"
 	"net/http"
 	"strings"
 )
@@ -15,9 +14,8 @@ import (
 const outputLineLength = 100
 
 // HTTPError logs the error and returns the appropriate message & http code.
-func HTTPError(w http.ResponseWriter, msg string, httpcode int) {
-	m := fmt.Sprintf("Returned HTTP error %d: %v", httpcode, msg)
-	log.Print(m)
+func HTTPError(w http.ResponseWriter, r *http.Request, msg string, httpcode int) {
+	Logger(r.Context()).Warn("Returned HTTP error", "code", httpcode, "error", msg)
 	http.Error(w, msg, httpcode)
 }
 
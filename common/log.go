@@ -0,0 +1,78 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package common
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+)
+
+// RequestIDHeader is the HTTP header carrying the request ID. IDs sent by
+// clients (or a reverse proxy) are reused if valid.
+const RequestIDHeader = "X-Request-ID"
+
+// Valid request IDs received from clients.
+var requestIDRegex = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// LogProgramText includes program text and tool output in the logs when
+// true. These are redacted by default, since they contain student code.
+var LogProgramText bool
+
+// requestIDKey is the context key for the request ID.
+type requestIDKey struct{}
+
+// NewRequestID returns a new random request ID.
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ContextWithRequestID returns a copy of ctx carrying the request ID.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID in ctx, or "" if none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Logger returns the default logger, adding the request ID in ctx (if any)
+// to every message.
+func Logger(ctx context.Context) *slog.Logger {
+	if id := RequestID(ctx); id != "" {
+		return slog.Default().With("request_id", id)
+	}
+	return slog.Default()
+}
+
+// RequestIDHandler assigns an ID to every request, passing it to h in the
+// request context and returning it to the client in the X-Request-ID header.
+func RequestIDHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !requestIDRegex.MatchString(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		h.ServeHTTP(w, r.WithContext(ContextWithRequestID(r.Context(), id)))
+	})
+}
+
+// Redact returns a log attribute for text that may contain student code
+// (program text, tool output). Unless LogProgramText is set, only the size
+// of the text is logged.
+func Redact(key, text string) slog.Attr {
+	if LogProgramText {
+		return slog.String(key, text)
+	}
+	return slog.String(key, fmt.Sprintf("[redacted, %d bytes]", len(text)))
+}
@@ -0,0 +1,90 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		wantSame bool // Reuse the ID sent by the client?
+	}{
+		{"no id", "", false},
+		{"valid id", "abc-123_X.y", true},
+		{"invalid characters", "abc 123\n", false},
+		{"too long", strings.Repeat("a", 65), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := RequestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = RequestID(r.Context())
+			}))
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				r.Header.Set(RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if !requestIDRegex.MatchString(got) {
+				t.Errorf("Request ID %q is not valid", got)
+			}
+			if (got == tt.header) != tt.wantSame {
+				t.Errorf("Request ID = %q with header %q, want reused: %v", got, tt.header, tt.wantSame)
+			}
+			if h := w.Header().Get(RequestIDHeader); h != got {
+				t.Errorf("Response header %s = %q, want %q", RequestIDHeader, h, got)
+			}
+		})
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	saved := slog.Default()
+	defer slog.SetDefault(saved)
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	Logger(context.Background()).Info("no id")
+	Logger(ContextWithRequestID(context.Background(), "req1")).Info("with id")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Logger wrote %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	if strings.Contains(lines[0], "request_id") {
+		t.Errorf("Logger without request ID wrote %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "request_id=req1") {
+		t.Errorf("Logger with request ID wrote %q, want request_id=req1", lines[1])
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		logText bool
+		want    string
+	}{
+		{false, "[redacted, 13 bytes]"},
+		{true, "int main() {}"},
+	}
+	saved := LogProgramText
+	defer func() { LogProgramText = saved }()
+	for _, tt := range tests {
+		LogProgramText = tt.logText
+		if got := Redact("text", "int main() {}"); got.Key != "text" || got.Value.String() != tt.want {
+			t.Errorf("Redact with LogProgramText=%v = %v, want text=%s", tt.logText, got, tt.want)
+		}
+	}
+}
@@ -1,3 +1,7 @@
 module github.com/osprogramadores/op-web-linter
 
-go 1.19
+go 1.21
+
+require golang.org/x/tools v0.24.0
+
+require gopkg.in/yaml.v3 v3.0.1
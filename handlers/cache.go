@@ -0,0 +1,232 @@
+// Package handlers contains http handler code for op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package handlers
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/osprogramadores/op-web-linter/lang"
+	"github.com/osprogramadores/op-web-linter/metrics"
+)
+
+// Cache holds lint responses in memory (LRU) and optionally on disk, keyed
+// by a hash of the request and the tools used to lint it. Identical
+// concurrent requests share a single execution.
+type Cache struct {
+	maxEntries int    // Maximum number of entries in memory.
+	dir        string // Directory for the on-disk store (optional).
+	version    string // Server version (part of every key).
+
+	mu       sync.Mutex
+	ll       *list.List               // Most recently used entries at the front.
+	items    map[string]*list.Element // Elements in ll, by key.
+	inflight map[string]*inflightCall // Executions in progress, by key.
+}
+
+// cacheEntry is the value held in each element of Cache.ll.
+type cacheEntry struct {
+	key  string
+	resp lang.LintResponse
+}
+
+// inflightCall is an execution in progress, possibly shared by many requests.
+type inflightCall struct {
+	done chan struct{} // Closed when the execution finishes.
+	resp lang.LintResponse
+	err  error
+}
+
+// NewCache creates a new cache holding up to maxEntries responses in memory.
+// If dir is not empty, responses are also saved to files in that directory
+// (created if needed) and survive restarts. Version should identify the
+// server build, so upgrades don't reuse old results.
+func NewCache(maxEntries int, dir, version string) (*Cache, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &Cache{
+		maxEntries: maxEntries,
+		dir:        dir,
+		version:    version,
+		ll:         list.New(),
+		items:      map[string]*list.Element{},
+		inflight:   map[string]*inflightCall{},
+	}, nil
+}
+
+// Key returns the cache key for a request, given the fingerprint of the
+// tools used for the language (versions and configuration files).
+func (c *Cache) Key(req lang.LintRequest, fingerprint string) string {
+	jreq, _ := json.Marshal(req)
+
+	h := sha256.New()
+	for _, s := range []string{c.version, fingerprint, string(jreq)} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Do returns the response for the key from the cache, or calls fn to create
+// it. Concurrent calls with the same key wait for and share the result of a
+// single call to fn. Responses not coming from this call to fn are marked as
+// cached. Successful responses are added to the cache unless they contain
+// transient failures (E.g. timeouts).
+func (c *Cache) Do(ctx context.Context, key string, fn func() (lang.LintResponse, error)) (lang.LintResponse, error) {
+	for {
+		if resp, ok := c.get(key); ok {
+			metrics.CacheRequests.Inc("hit")
+			resp.Cached = true
+			return resp, nil
+		}
+
+		c.mu.Lock()
+		if call, ok := c.inflight[key]; ok {
+			c.mu.Unlock()
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return lang.LintResponse{}, ctx.Err()
+			}
+			// The request running the execution went away. Try again.
+			if errors.Is(call.err, context.Canceled) {
+				continue
+			}
+			metrics.CacheRequests.Inc("hit")
+			resp := call.resp
+			resp.Cached = true
+			return resp, call.err
+		}
+		call := &inflightCall{done: make(chan struct{})}
+		c.inflight[key] = call
+		c.mu.Unlock()
+
+		metrics.CacheRequests.Inc("miss")
+		call.resp, call.err = fn()
+		if call.err == nil && cacheable(call.resp) {
+			c.add(key, call.resp)
+		}
+
+		c.mu.Lock()
+		delete(c.inflight, key)
+		c.mu.Unlock()
+		close(call.done)
+
+		return call.resp, call.err
+	}
+}
+
+// get returns the response for the key from memory or disk.
+func (c *Cache) get(key string) (lang.LintResponse, bool) {
+	c.mu.Lock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*cacheEntry).resp, true
+	}
+	c.mu.Unlock()
+
+	if c.dir == "" {
+		return lang.LintResponse{}, false
+	}
+	data, err := os.ReadFile(c.filename(key))
+	if err != nil {
+		return lang.LintResponse{}, false
+	}
+	var resp lang.LintResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		slog.Warn("Ignoring invalid cache file", "file", c.filename(key), "error", err)
+		return lang.LintResponse{}, false
+	}
+	c.addMemory(key, resp)
+	return resp, true
+}
+
+// add adds a response to memory and disk.
+func (c *Cache) add(key string, resp lang.LintResponse) {
+	c.addMemory(key, resp)
+	if c.dir == "" {
+		return
+	}
+	if err := c.save(key, resp); err != nil {
+		slog.Error("Error saving response to cache", "error", err)
+	}
+}
+
+// addMemory adds a response to memory, evicting the least recently used
+// entries if needed.
+func (c *Cache) addMemory(key string, resp lang.LintResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*cacheEntry).resp = resp
+		return
+	}
+	c.items[key] = c.ll.PushFront(&cacheEntry{key: key, resp: resp})
+	for c.ll.Len() > c.maxEntries {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*cacheEntry).key)
+	}
+}
+
+// save writes a response to disk. The file is written under a temporary
+// name and renamed, so readers never see partial files.
+func (c *Cache) save(key string, resp lang.LintResponse) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	fname := c.filename(key)
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		return err
+	}
+	tempfd, err := os.CreateTemp(filepath.Dir(fname), "tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempfd.Name())
+
+	if _, err := tempfd.Write(data); err != nil {
+		tempfd.Close()
+		return err
+	}
+	if err := tempfd.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempfd.Name(), fname)
+}
+
+// filename returns the name of the file holding the response for key on
+// disk. Files are spread over subdirectories named after the first two
+// characters of the key.
+func (c *Cache) filename(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+// cacheable returns true if the response can be cached. Responses with
+// timeouts or exceeded resource limits depend on the server load (E.g. memory
+// used by concurrent tools) and are never cached.
+func cacheable(resp lang.LintResponse) bool {
+	for _, d := range resp.Diagnostics {
+		if d.RuleID == lang.RuleTimeout || d.RuleID == lang.RuleResourceLimit {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,221 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/osprogramadores/op-web-linter/lang"
+)
+
+// newTestCache creates a cache for the tests.
+func newTestCache(t *testing.T, maxEntries int, dir string) *Cache {
+	t.Helper()
+	c, err := NewCache(maxEntries, dir, "test")
+	if err != nil {
+		t.Fatalf("NewCache returned error: %v", err)
+	}
+	return c
+}
+
+// TestCacheShared checks that identical concurrent requests share a single
+// execution.
+func TestCacheShared(t *testing.T) {
+	c := newTestCache(t, 10, "")
+	key := c.Key(lang.LintRequest{Text: "a", Lang: "c"}, "tools")
+
+	var calls atomic.Int32
+	unblock := make(chan struct{})
+	fn := func() (lang.LintResponse, error) {
+		calls.Add(1)
+		<-unblock
+		return lang.LintResponse{Pass: true}, nil
+	}
+
+	const n = 10
+	var (
+		wg     sync.WaitGroup
+		cached atomic.Int32
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.Do(context.Background(), key, fn)
+			if err != nil || !resp.Pass {
+				t.Errorf("Do returned %+v, %v", resp, err)
+			}
+			if resp.Cached {
+				cached.Add(1)
+			}
+		}()
+	}
+	// Wait for the first execution to start before letting it finish.
+	for deadline := time.Now().Add(5 * time.Second); calls.Load() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for the execution to start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(unblock)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Concurrent Do calls ran %d executions, want 1", got)
+	}
+	if got := cached.Load(); got != n-1 {
+		t.Errorf("Concurrent Do calls returned %d cached responses, want %d", got, n-1)
+	}
+}
+
+func TestCacheDisk(t *testing.T) {
+	dir := t.TempDir()
+	req := lang.LintRequest{Text: "a", Lang: "c"}
+	want := lang.LintResponse{Pass: true, ErrorMessages: []string{"message"}}
+
+	c := newTestCache(t, 10, dir)
+	resp, err := c.Do(context.Background(), c.Key(req, "tools"), func() (lang.LintResponse, error) {
+		return want, nil
+	})
+	if err != nil || resp.Cached {
+		t.Fatalf("First Do returned cached=%v and error %v, want a new response", resp.Cached, err)
+	}
+
+	// A new cache (E.g. after a restart) reads the response from disk.
+	c = newTestCache(t, 10, dir)
+	resp, err = c.Do(context.Background(), c.Key(req, "tools"), func() (lang.LintResponse, error) {
+		t.Error("Do ran the execution for a response saved on disk")
+		return lang.LintResponse{}, nil
+	})
+	if err != nil {
+		t.Fatalf("Do returned error: %v", err)
+	}
+	want.Cached = true
+	if got, _ := json.Marshal(resp); string(got) != string(mustMarshal(t, want)) {
+		t.Errorf("Do returned %s from disk, want %s", got, mustMarshal(t, want))
+	}
+
+	// Other tool versions and server versions use different keys.
+	other, err := NewCache(10, dir, "other")
+	if err != nil {
+		t.Fatalf("NewCache returned error: %v", err)
+	}
+	for _, key := range []string{c.Key(req, "new tools"), other.Key(req, "tools")} {
+		if _, ok := other.get(key); ok {
+			t.Errorf("Cache returned a response for key %s, saved with another version", key)
+		}
+	}
+}
+
+// mustMarshal returns v encoded as JSON.
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// TestCacheNotCached checks that errors and responses with timeouts or
+// exceeded resource limits are not cached.
+func TestCacheNotCached(t *testing.T) {
+	tests := []struct {
+		name string
+		resp lang.LintResponse
+		err  error
+	}{
+		{
+			name: "error",
+			err:  errors.New("failed"),
+		},
+		{
+			name: "timeout",
+			resp: lang.LintResponse{Diagnostics: []lang.Diagnostic{{Tool: "clang-tidy", RuleID: lang.RuleTimeout, Message: "timeout"}}},
+		},
+		{
+			name: "resource limit",
+			resp: lang.LintResponse{Diagnostics: []lang.Diagnostic{{Tool: "clang-tidy", RuleID: lang.RuleResourceLimit, Message: "memory limit exceeded"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCache(t, 10, t.TempDir())
+			key := c.Key(lang.LintRequest{Text: "a", Lang: "c"}, "tools")
+			calls := 0
+			fn := func() (lang.LintResponse, error) {
+				calls++
+				return tt.resp, tt.err
+			}
+			for i := 0; i < 2; i++ {
+				resp, _ := c.Do(context.Background(), key, fn)
+				if resp.Cached {
+					t.Errorf("Do returned a cached response")
+				}
+			}
+			if calls != 2 {
+				t.Errorf("Do ran %d executions, want 2", calls)
+			}
+		})
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := newTestCache(t, 2, "")
+	fn := func() (lang.LintResponse, error) { return lang.LintResponse{Pass: true}, nil }
+	keys := []string{"aaaa", "bbbb", "cccc"}
+	for _, key := range keys {
+		c.Do(context.Background(), key, fn)
+	}
+	if _, ok := c.get(keys[0]); ok {
+		t.Errorf("Cache kept the least recently used entry")
+	}
+	for _, key := range keys[1:] {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("Cache evicted entry %s", key)
+		}
+	}
+}
+
+// TestLintRequestHandlerCache checks that /lint only caches responses for
+// languages with a known fingerprint.
+func TestLintRequestHandlerCache(t *testing.T) {
+	calls := map[string]int{}
+	languages := testLanguages(func(ctx context.Context, req lang.LintRequest) (lang.LintResponse, error) {
+		calls[req.Lang]++
+		return lang.LintResponse{Pass: true}, nil
+	})
+	languages["unknown"] = lang.Language{
+		Display:     "Unknown version",
+		Extension:   "u",
+		Linter:      languages["c"].Linter,
+		Fingerprint: func() string { return "" },
+	}
+	c := newTestCache(t, 10, "")
+
+	for _, name := range []string{"c", "go", "unknown"} {
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			LintRequestHandler(w, lintRequest(name, "program"), languages, nil, c)
+			var resp lang.LintResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Unable to decode /lint response %q: %v", w.Body.String(), err)
+			}
+			if want := name == "c" && i == 1; resp.Cached != want {
+				t.Errorf("/lint request %d for %s returned Cached=%v, want %v", i+1, name, resp.Cached, want)
+			}
+		}
+	}
+	if want := map[string]int{"c": 1, "go": 2, "unknown": 2}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("/lint ran the linters %v times, want %v", calls, want)
+	}
+}
@@ -0,0 +1,59 @@
+// Package handlers contains http handler code for op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/osprogramadores/op-web-linter/common"
+	"github.com/osprogramadores/op-web-linter/lang"
+)
+
+// ChallengeInfo describes a challenge in the response to /challenges. Test
+// cases and house rules are not included.
+type ChallengeInfo struct {
+	ID        string  // Challenge ID, used in the challenge field of requests.
+	Title     string  // User visible name.
+	URL       string  `json:",omitempty"` // Challenge description.
+	Cases     int     // Number of test cases.
+	TimeLimit float64 `json:",omitempty"` // Maximum wall time of each test case, in seconds.
+}
+
+// GetChallengesResponse contains the response to /challenges.
+type GetChallengesResponse struct {
+	Challenges []ChallengeInfo `json:"Challenges"` // JSON array with the challenges, sorted by ID.
+}
+
+// ChallengesHandler defines the handler for /challenges.
+func ChallengesHandler(w http.ResponseWriter, r *http.Request, challenges lang.ChallengeSet) {
+	logger := common.Logger(r.Context())
+	logger.Info("CHALLENGES Request", "remote", common.RealRemoteAddress(r), "method", r.Method, "url", r.URL.String())
+	CORSHandler(w, r)
+	if r.Method == "OPTIONS" {
+		logger.Debug("Got OPTIONS method. Returning.")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp := GetChallengesResponse{Challenges: []ChallengeInfo{}}
+	for _, id := range challenges.IDs() {
+		c := challenges[id]
+		resp.Challenges = append(resp.Challenges, ChallengeInfo{
+			ID:        c.ID,
+			Title:     c.Title,
+			URL:       c.URL,
+			Cases:     len(c.Cases),
+			TimeLimit: c.TimeLimit,
+		})
+	}
+	ret, err := json.Marshal(resp)
+	if err != nil {
+		common.HTTPError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write([]byte(ret))
+}
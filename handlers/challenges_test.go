@@ -0,0 +1,45 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/osprogramadores/op-web-linter/lang"
+)
+
+func TestChallengesHandler(t *testing.T) {
+	challenges := lang.ChallengeSet{
+		"sum": {ID: "sum", Title: "Sum", TimeLimit: 2, Cases: make([]lang.TestCase, 3)},
+		"abc": {ID: "abc", Title: "ABC", URL: "https://example.com/abc"},
+	}
+	w := httptest.NewRecorder()
+	ChallengesHandler(w, httptest.NewRequest("GET", "/challenges/", nil), challenges)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("/challenges returned status %d, want %d", w.Code, http.StatusOK)
+	}
+	var got GetChallengesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("/challenges returned invalid JSON %q: %v", w.Body.String(), err)
+	}
+	want := GetChallengesResponse{Challenges: []ChallengeInfo{
+		{ID: "abc", Title: "ABC", URL: "https://example.com/abc"},
+		{ID: "sum", Title: "Sum", Cases: 3, TimeLimit: 2},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("/challenges returned %+v, want %+v", got, want)
+	}
+
+	// No challenges is an empty list, not null.
+	w = httptest.NewRecorder()
+	ChallengesHandler(w, httptest.NewRequest("GET", "/challenges/", nil), nil)
+	if want := `{"Challenges":[]}`; w.Body.String() != want {
+		t.Errorf("/challenges without challenges returned %q, want %q", w.Body.String(), want)
+	}
+}
@@ -6,65 +6,33 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
-	"sort"
 
 	"github.com/osprogramadores/op-web-linter/common"
+	"github.com/osprogramadores/op-web-linter/lang"
 )
 
-// LangDetails contains details for a single language.
-type LangDetails struct {
-	Display string
-	LintFn  func(w http.ResponseWriter, r *http.Request, req LintRequest)
-}
-
 // GetLangResponse contains the response to /languages.
 type GetLangResponse struct {
 	Languages []string `json:"Languages"` // JSON array with the list of languages.
 }
 
-// SupportedLangs holds the supported languages.
-type SupportedLangs map[string]LangDetails
-
 // LanguagesHandler defines the handler for /languages.
-func LanguagesHandler(w http.ResponseWriter, r *http.Request, supported SupportedLangs) {
-	log.Printf("LANGUAGES Request %s %s %s\n", common.RealRemoteAddress(r), r.Method, r.URL)
+func LanguagesHandler(w http.ResponseWriter, r *http.Request, supported lang.Languages) {
+	logger := common.Logger(r.Context())
+	logger.Info("LANGUAGES Request", "remote", common.RealRemoteAddress(r), "method", r.Method, "url", r.URL.String())
 	CORSHandler(w, r)
 	if r.Method == "OPTIONS" {
-		log.Printf("Got OPTIONS method. Returning.")
+		logger.Debug("Got OPTIONS method. Returning.")
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	langs := LanguagesList(supported)
-
-	ret, err := json.Marshal(GetLangResponse{Languages: langs})
+	ret, err := json.Marshal(GetLangResponse{Languages: supported.Names()})
 	if err != nil {
-		common.HTTPError(w, err.Error(), http.StatusInternalServerError)
+		common.HTTPError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("content-type", "application/json")
 	w.Write([]byte(ret))
 }
-
-// LanguagesList returns a string slice with all supported languages.
-func LanguagesList(supported SupportedLangs) []string {
-	var langs []string
-	for lang, details := range supported {
-		if details.LintFn != nil {
-			langs = append(langs, lang)
-		}
-	}
-	sort.Strings(langs)
-	return langs
-}
-
-// validLang returns true if the language is a supported language.
-func validLang(lang string, supported SupportedLangs) bool {
-	details, ok := supported[lang]
-	if ok && details.LintFn != nil {
-		return true
-	}
-	return false
-}
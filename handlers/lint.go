@@ -6,75 +6,256 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/osprogramadores/op-web-linter/common"
+	"github.com/osprogramadores/op-web-linter/lang"
+	"github.com/osprogramadores/op-web-linter/metrics"
+	"github.com/osprogramadores/op-web-linter/sarif"
 )
 
-// LintRequest contains a request to lint a source program.
-type LintRequest struct {
-	Text string `json:"text"` // Text of the program.
-	Lang string `json:"lang"` // Language (must be in SupportedLangs)
-}
+// Response formats for /lint.
+const (
+	formatJSON  = "json"
+	formatSARIF = "sarif"
+)
 
-// LintResponse contains a response to a lint request.
-type LintResponse struct {
-	Pass            bool     // Pass or not?
-	ErrorMessages   []string // Used to send global linter failures back (usually blank).
-	Reformatted     bool     // Was the program reformatted?
-	ReformattedText string   // Reformatted program code.
+// lintHTTPRequest is the body of a /lint request: the lint request itself
+// plus options that only affect the HTTP response.
+type lintHTTPRequest struct {
+	lang.LintRequest
+	Format string `json:"format"` // Response format (json or sarif, optional).
 }
 
+// Seconds clients should wait before retrying when the queue is full.
+const retryAfter = 10
+
+// Content types of archive uploads to /lint.
+var archiveContentTypes = []string{"application/zip", "application/gzip", "application/x-gzip"}
+
 // LintRequestHandler handles /lint. The entire JSON request needs
-// to be posted as field "request" in the form.
-func LintRequestHandler(w http.ResponseWriter, r *http.Request, supported SupportedLangs) {
-	log.Printf("LINT Request %s %s %s\n", common.RealRemoteAddress(r), r.Method, r.URL)
+// to be posted as field "request" in the form. Multi-file programs can also
+// be posted as a zip or tar.gz archive, with the language and options in the
+// query string (E.g. /lint/?lang=c&fix=true&challenge=07). If pool is not
+// nil, requests wait for a free slot in the pool before running the linter.
+// If cache is not nil, responses are cached for languages with a fingerprint
+// function.
+func LintRequestHandler(w http.ResponseWriter, r *http.Request, supported lang.Languages, pool *WorkerPool, cache *Cache) {
+	logger := common.Logger(r.Context())
+	logger.Info("LINT Request", "remote", common.RealRemoteAddress(r), "method", r.Method, "url", r.URL.String())
 	CORSHandler(w, r)
 	if r.Method == "OPTIONS" {
-		log.Printf("Got OPTIONS method. Returning.")
+		logger.Debug("Got OPTIONS method. Returning.")
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
 	// Only POST request.
 	if r.Method != "POST" {
-		common.HTTPError(w, "Only POST requested accepted", http.StatusMethodNotAllowed)
+		common.HTTPError(w, r, "Only POST requested accepted", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Content-type must be application/json.
-	if !strings.Contains(r.Header.Get("content-type"), "application/json") {
-		common.HTTPError(w, "Incorrect content-type. Expected: application/json", http.StatusUnsupportedMediaType)
+	// Content-type must be application/json, or one of the archive types.
+	var (
+		body    lintHTTPRequest
+		escaped bool
+	)
+	switch ctype := r.Header.Get("content-type"); {
+	case strings.Contains(ctype, "application/json"):
+		d := json.NewDecoder(r.Body)
+		d.Decode(&body)
+		escaped = true
+	case isArchiveContentType(ctype):
+		var err error
+		if body, err = archiveRequest(w, r); err != nil {
+			common.HTTPError(w, r, "Invalid archive: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		common.HTTPError(w, r, "Incorrect content-type. Expected: application/json or "+strings.Join(archiveContentTypes, ", "),
+			http.StatusUnsupportedMediaType)
 		return
 	}
+	req := body.LintRequest
+	logger.Debug("Received form data", "lang", req.Lang, "files", len(req.Files), common.Redact("text", req.Text))
 
-	var req LintRequest
-	d := json.NewDecoder(r.Body)
-	d.Decode(&req)
-	log.Printf("Received form data: %+v", req)
-
-	// Program text must not be null.
-	if len(req.Text) == 0 {
-		common.HTTPError(w, "Program text cannot be empty", http.StatusBadRequest)
+	// Program text must not be null. Multi-file programs have no text.
+	if len(req.Text) == 0 && len(req.Files) == 0 {
+		common.HTTPError(w, r, "Program text cannot be empty", http.StatusBadRequest)
+		return
+	}
+	if len(req.Text) > 0 && len(req.Files) > 0 {
+		common.HTTPError(w, r, "Program text and files cannot be used together", http.StatusBadRequest)
 		return
 	}
 
 	// Validate as JSON.
 	jreq, err := json.Marshal(req)
 	if err != nil {
-		common.HTTPError(w, err.Error(), http.StatusBadRequest)
+		common.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.Debug("Parsed JSON", common.Redact("json", string(jreq)))
+
+	format, err := responseFormat(r, body.Format)
+	if err != nil {
+		common.HTTPError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
-	log.Printf("Parsed JSON: %v\n", string(jreq))
 
 	// Test valid languages.
-	if !validLang(req.Lang, supported) {
-		common.HTTPError(w, "Invalid Language", http.StatusBadRequest)
+	details, ok := supported.Get(req.Lang)
+	if !ok {
+		common.HTTPError(w, r, "Invalid Language", http.StatusBadRequest)
+		return
+	}
+
+	// The form sends the program text escaped. File texts in multi-file
+	// requests are taken verbatim.
+	if escaped {
+		if req.Text, err = url.QueryUnescape(req.Text); err != nil {
+			common.HTTPError(w, r, "Invalid program text: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Count the request by outcome (set below) when done.
+	outcome := "error"
+	defer func() {
+		metrics.Requests.Inc(req.Lang, outcome)
+	}()
+
+	// Run the appropriate linter after waiting for a free slot.
+	run := func() (lang.LintResponse, error) {
+		if pool != nil {
+			release, depth, wait, err := pool.Acquire(r.Context(), req.Lang)
+			logger.Info("Queue", "lang", req.Lang, "depth", depth, "wait", wait, "error", err)
+			w.Header().Set("X-Queue-Depth", strconv.Itoa(depth))
+			w.Header().Set("X-Queue-Wait-Ms", strconv.FormatInt(wait.Milliseconds(), 10))
+			if err != nil {
+				return lang.LintResponse{}, err
+			}
+			defer release()
+		}
+		resp, err := supported.Lint(r.Context(), req)
+		// Results are unreliable if the client went away.
+		if err == nil && r.Context().Err() != nil {
+			err = r.Context().Err()
+		}
+		return resp, err
+	}
+
+	// Languages with unknown tool versions (E.g. the version command failed
+	// at startup) have an empty fingerprint, and are not cached.
+	var (
+		resp        lang.LintResponse
+		fingerprint string
+	)
+	if details.Fingerprint != nil {
+		fingerprint = details.Fingerprint()
+	}
+	if cache != nil && fingerprint != "" {
+		resp, err = cache.Do(r.Context(), cache.Key(req, fingerprint+lang.Challenges.Fingerprint(req.Challenge)), run)
+	} else {
+		resp, err = run()
+	}
+
+	switch {
+	case err == ErrQueueFull:
+		outcome = "busy"
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		common.HTTPError(w, r, "Server busy, please try again later", http.StatusTooManyRequests)
+		return
+	case r.Context().Err() != nil:
+		// Client went away.
+		outcome = "canceled"
+		common.HTTPError(w, r, r.Context().Err().Error(), http.StatusServiceUnavailable)
+		return
+	case errors.Is(err, lang.ErrInvalidFiles), errors.Is(err, lang.ErrUnknownChallenge):
+		common.HTTPError(w, r, err.Error(), http.StatusBadRequest)
 		return
+	case err != nil:
+		common.HTTPError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var jresp []byte
+	contentType := "application/json"
+	switch {
+	case format == formatSARIF && len(req.Files) > 0:
+		contentType = sarif.MediaType
+		jresp, err = json.Marshal(sarif.FromFiles(req.Files, resp))
+	case format == formatSARIF:
+		contentType = sarif.MediaType
+		jresp, err = json.Marshal(sarif.FromResponse("program."+details.Extension, req.Text, resp))
+	default:
+		jresp, err = json.Marshal(resp)
 	}
+	if err != nil {
+		common.HTTPError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	outcome = "fail"
+	if resp.Pass {
+		outcome = "pass"
+	}
+	logger.Info("Lint response", "lang", req.Lang, "pass", resp.Pass, "diagnostics", len(resp.Diagnostics),
+		"reformatted", resp.Reformatted, "cached", resp.Cached)
+	logger.Debug("JSON response", common.Redact("json", string(jresp)))
+	w.Header().Set("content-type", contentType)
+	w.Write(jresp)
+	w.Write([]byte("\n"))
+}
 
-	// Call the appropriate linter.
-	supported[req.Lang].LintFn(w, r, req)
+// responseFormat returns the format of the response to a /lint request. The
+// format field in the request takes precedence over the Accept header.
+func responseFormat(r *http.Request, format string) (string, error) {
+	switch format {
+	case formatJSON, formatSARIF:
+		return format, nil
+	case "":
+		if strings.Contains(r.Header.Get("accept"), sarif.MediaType) {
+			return formatSARIF, nil
+		}
+		return formatJSON, nil
+	}
+	return "", fmt.Errorf("invalid format %q (expected %s or %s)", format, formatJSON, formatSARIF)
+}
+
+// isArchiveContentType returns true if ctype is one of the archive content
+// types.
+func isArchiveContentType(ctype string) bool {
+	for _, t := range archiveContentTypes {
+		if strings.Contains(ctype, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveRequest reads a /lint request posted as an archive. The language
+// and options come from the query string (lang, fix, challenge and format).
+func archiveRequest(w http.ResponseWriter, r *http.Request) (lintHTTPRequest, error) {
+	// Archives can't be larger than their contents, unless they're tiny.
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, lang.MaxFilesSize+1<<20))
+	if err != nil {
+		return lintHTTPRequest{}, err
+	}
+	files, err := lang.ReadArchive(data)
+	if err != nil {
+		return lintHTTPRequest{}, err
+	}
+	q := r.URL.Query()
+	fix, _ := strconv.ParseBool(q.Get("fix"))
+	return lintHTTPRequest{
+		LintRequest: lang.LintRequest{Lang: q.Get("lang"), Fix: fix, Files: files, Challenge: q.Get("challenge")},
+		Format:      q.Get("format"),
+	}, nil
 }
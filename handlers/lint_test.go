@@ -0,0 +1,171 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/osprogramadores/op-web-linter/lang"
+	"github.com/osprogramadores/op-web-linter/sarif"
+)
+
+func TestResponseFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		accept  string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", want: formatJSON},
+		{name: "accept header", accept: "application/sarif+json, application/json", want: formatSARIF},
+		{name: "field", format: "sarif", want: formatSARIF},
+		{name: "field takes precedence", accept: sarif.MediaType, format: "json", want: formatJSON},
+		{name: "invalid", format: "xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/lint/", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			got, err := responseFormat(r, tt.format)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("responseFormat(%q, %q) = %q, %v, want %q (error: %v)", tt.accept, tt.format, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLintRequestHandlerSARIF(t *testing.T) {
+	r := httptest.NewRequest("POST", "/lint/", strings.NewReader(`{"lang":"c","text":"int main() {}","format":"sarif"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	LintRequestHandler(w, r, testLanguages(nil), nil, nil)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("/lint returned status %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+	}
+	if got := w.Header().Get("content-type"); got != sarif.MediaType {
+		t.Errorf("/lint returned content type %q, want %q", got, sarif.MediaType)
+	}
+	if want := `"version":"2.1.0"`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("/lint returned %q, want a SARIF log", w.Body.String())
+	}
+}
+
+// zipArchive returns a zip archive with the files.
+func zipArchive(t *testing.T, files []lang.File) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f.Text))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLintRequestHandlerFiles(t *testing.T) {
+	files := []lang.File{{Path: "main.c", Text: "int main() {}\n"}, {Path: "src/util.h", Text: "void f();\n"}}
+	tests := []struct {
+		name      string
+		url       string
+		ctype     string
+		body      string
+		wantCode  int
+		wantFiles []lang.File
+	}{
+		{
+			name:      "json",
+			url:       "/lint/",
+			ctype:     "application/json",
+			body:      `{"lang":"c","files":[{"path":"main.c","text":"int main() {}\n"},{"path":"src/util.h","text":"void f();\n"}]}`,
+			wantCode:  http.StatusOK,
+			wantFiles: files,
+		},
+		{
+			name:      "verbatim texts",
+			url:       "/lint/",
+			ctype:     "application/json",
+			body:      `{"lang":"c","files":[{"path":"main.c","text":"printf(\"100%%\");%0A"}]}`,
+			wantCode:  http.StatusOK,
+			wantFiles: []lang.File{{Path: "main.c", Text: "printf(\"100%%\");%0A"}},
+		},
+		{
+			name:      "zip",
+			url:       "/lint/?lang=c",
+			ctype:     "application/zip",
+			body:      string(zipArchive(t, files)),
+			wantCode:  http.StatusOK,
+			wantFiles: files,
+		},
+		{
+			name:     "invalid archive",
+			url:      "/lint/?lang=c",
+			ctype:    "application/zip",
+			body:     "not a zip file",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "text and files",
+			url:      "/lint/",
+			ctype:    "application/json",
+			body:     `{"lang":"c","text":"int","files":[{"path":"main.c","text":"int"}]}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid path",
+			url:      "/lint/",
+			ctype:    "application/json",
+			body:     `{"lang":"c","files":[{"path":"../main.c","text":"int"}]}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "unsupported content type",
+			url:      "/lint/?lang=c",
+			ctype:    "application/x-tar",
+			body:     "data",
+			wantCode: http.StatusUnsupportedMediaType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []lang.File
+			linter := func(ctx context.Context, req lang.LintRequest) (lang.LintResponse, error) {
+				got = req.Files
+				return lang.LintResponse{Pass: true}, nil
+			}
+			languages := testLanguages(linter)
+			l := languages["c"]
+			l.MultiFile = true
+			languages["c"] = l
+
+			r := httptest.NewRequest("POST", tt.url, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.ctype)
+			w := httptest.NewRecorder()
+			LintRequestHandler(w, r, languages, nil, nil)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("/lint returned status %d, want %d (body %q)", w.Code, tt.wantCode, w.Body.String())
+			}
+			if !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("/lint linted files %+v, want %+v", got, tt.wantFiles)
+			}
+		})
+	}
+}
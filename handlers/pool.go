@@ -0,0 +1,133 @@
+// Package handlers contains http handler code for op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull is returned by WorkerPool.Acquire when the wait queue is full.
+var ErrQueueFull = errors.New("too many requests in queue")
+
+// WorkerPool limits the number of lint requests running concurrently, both
+// globally and per language. Requests above the limits wait in a bounded
+// queue.
+type WorkerPool struct {
+	global   chan struct{}            // Global slots.
+	perLang  map[string]chan struct{} // Per language slots (optional).
+	maxQueue int                      // Maximum number of waiting requests.
+
+	mu     sync.Mutex
+	queued int // Requests currently waiting.
+}
+
+// NewWorkerPool creates a new WorkerPool allowing up to workers concurrent
+// requests, further limited per language by langWorkers (languages not in
+// the map are only subject to the global limit). Up to maxQueue requests
+// wait for a free slot. Workers and all per language counts must be at least
+// 1 (otherwise requests block forever) and maxQueue must not be negative.
+func NewWorkerPool(workers int, langWorkers map[string]int, maxQueue int) *WorkerPool {
+	p := &WorkerPool{
+		global:   make(chan struct{}, workers),
+		perLang:  map[string]chan struct{}{},
+		maxQueue: maxQueue,
+	}
+	for lang, n := range langWorkers {
+		p.perLang[lang] = make(chan struct{}, n)
+	}
+	return p
+}
+
+// Acquire waits for a free slot to lint a program in the given language.
+// Returns a function to release the slot, the number of requests waiting
+// in the queue (including this one) when the request arrived and the time
+// spent waiting. Returns ErrQueueFull if the queue is full, or the context
+// error if the context is done before a slot becomes available.
+func (p *WorkerPool) Acquire(ctx context.Context, lang string) (func(), int, time.Duration, error) {
+	start := time.Now()
+
+	// Fast path: free slots available.
+	if release, ok := p.tryAcquire(lang); ok {
+		return release, 0, 0, nil
+	}
+
+	p.mu.Lock()
+	if p.queued >= p.maxQueue {
+		p.mu.Unlock()
+		return nil, p.maxQueue, 0, ErrQueueFull
+	}
+	p.queued++
+	depth := p.queued
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		p.queued--
+		p.mu.Unlock()
+	}()
+
+	// Language slot first, so we don't hold a global slot while waiting
+	// for a busy language.
+	lsem := p.perLang[lang]
+	if lsem != nil {
+		select {
+		case lsem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, depth, time.Since(start), ctx.Err()
+		}
+	}
+	select {
+	case p.global <- struct{}{}:
+	case <-ctx.Done():
+		if lsem != nil {
+			<-lsem
+		}
+		return nil, depth, time.Since(start), ctx.Err()
+	}
+	return p.releaseFunc(lsem), depth, time.Since(start), nil
+}
+
+// Queued returns the number of requests currently waiting in the queue.
+func (p *WorkerPool) Queued() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queued
+}
+
+// tryAcquire attempts to acquire the language and global slots without
+// waiting.
+func (p *WorkerPool) tryAcquire(lang string) (func(), bool) {
+	lsem := p.perLang[lang]
+	if lsem != nil {
+		select {
+		case lsem <- struct{}{}:
+		default:
+			return nil, false
+		}
+	}
+	select {
+	case p.global <- struct{}{}:
+	default:
+		if lsem != nil {
+			<-lsem
+		}
+		return nil, false
+	}
+	return p.releaseFunc(lsem), true
+}
+
+// releaseFunc returns a function that releases the global slot and the
+// language slot (if not nil).
+func (p *WorkerPool) releaseFunc(lsem chan struct{}) func() {
+	return func() {
+		<-p.global
+		if lsem != nil {
+			<-lsem
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/osprogramadores/op-web-linter/lang"
+)
+
+// testLanguages returns a set of fake languages using linter (by default,
+// one that always passes).
+func testLanguages(linter lang.LinterFunc) lang.Languages {
+	if linter == nil {
+		linter = func(ctx context.Context, req lang.LintRequest) (lang.LintResponse, error) {
+			return lang.LintResponse{Pass: true}, nil
+		}
+	}
+	return lang.Languages{
+		"c":  {Display: "C", Extension: "c", Linter: linter, Fingerprint: func() string { return "c-tools" }},
+		"go": {Display: "Go", Extension: "go", Linter: linter},
+	}
+}
+
+// lintRequest returns a /lint request for a program in the language.
+func lintRequest(lang, text string) *http.Request {
+	r := httptest.NewRequest("POST", "/lint/", strings.NewReader(`{"lang":"`+lang+`","text":"`+text+`"}`))
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+// waitQueued waits until n requests are waiting in the pool.
+func waitQueued(t *testing.T, p *WorkerPool, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); p.Queued() != n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timeout waiting for %d queued requests (got %d)", n, p.Queued())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWorkerPoolQueueFull(t *testing.T) {
+	ctx := context.Background()
+	p := NewWorkerPool(1, nil, 1)
+
+	release, depth, _, err := p.Acquire(ctx, "c")
+	if err != nil || depth != 0 {
+		t.Fatalf("Acquire with free slots returned depth %d and error %v, want 0 and no error", depth, err)
+	}
+
+	// The second request waits in the queue, the third one is rejected.
+	acquired := make(chan error)
+	go func() {
+		release, depth, _, err := p.Acquire(ctx, "c")
+		if err == nil {
+			defer release()
+			if depth != 1 {
+				err = errors.New("unexpected queue depth")
+			}
+		}
+		acquired <- err
+	}()
+	waitQueued(t, p, 1)
+	if _, _, _, err := p.Acquire(ctx, "c"); err != ErrQueueFull {
+		t.Errorf("Acquire with a full queue returned error %v, want %v", err, ErrQueueFull)
+	}
+
+	release()
+	if err := <-acquired; err != nil {
+		t.Errorf("Queued Acquire returned error: %v", err)
+	}
+	if n := p.Queued(); n != 0 {
+		t.Errorf("Queued() = %d after all requests finished, want 0", n)
+	}
+}
+
+func TestWorkerPoolLanguageSlots(t *testing.T) {
+	ctx := context.Background()
+	p := NewWorkerPool(2, map[string]int{"c": 1}, 0)
+
+	release, _, _, err := p.Acquire(ctx, "c")
+	if err != nil {
+		t.Fatalf("Acquire returned error: %v", err)
+	}
+	// The language slot is taken, but not all global slots.
+	if _, _, _, err := p.Acquire(ctx, "c"); err != ErrQueueFull {
+		t.Errorf("Acquire for a busy language returned error %v, want %v", err, ErrQueueFull)
+	}
+	other, _, _, err := p.Acquire(ctx, "go")
+	if err != nil {
+		t.Fatalf("Acquire for another language returned error: %v", err)
+	}
+	other()
+	release()
+
+	release, _, _, err = p.Acquire(ctx, "c")
+	if err != nil {
+		t.Fatalf("Acquire after release returned error: %v", err)
+	}
+	release()
+}
+
+func TestWorkerPoolCanceled(t *testing.T) {
+	p := NewWorkerPool(1, map[string]int{"c": 1}, 1)
+	release, _, _, err := p.Acquire(context.Background(), "go")
+	if err != nil {
+		t.Fatalf("Acquire returned error: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, _, err := p.Acquire(ctx, "c"); err != context.DeadlineExceeded {
+		t.Errorf("Acquire with an expired context returned error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if n := p.Queued(); n != 0 {
+		t.Errorf("Queued() = %d after the request gave up, want 0", n)
+	}
+	// The language slot taken while waiting for the global one is released.
+	select {
+	case p.perLang["c"] <- struct{}{}:
+		<-p.perLang["c"]
+	default:
+		t.Errorf("Acquire with an expired context kept the language slot")
+	}
+}
+
+// TestLintRequestHandlerBusy checks that /lint requests are rejected with
+// 429 when the queue is full.
+func TestLintRequestHandlerBusy(t *testing.T) {
+	p := NewWorkerPool(1, nil, 0)
+	release, _, _, err := p.Acquire(context.Background(), "c")
+	if err != nil {
+		t.Fatalf("Acquire returned error: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	LintRequestHandler(w, lintRequest("c", "int main() {}"), testLanguages(nil), p, nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Busy /lint returned status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got == "" {
+		t.Errorf("Busy /lint returned no Retry-After header")
+	}
+
+	release()
+	w = httptest.NewRecorder()
+	LintRequestHandler(w, lintRequest("c", "int main() {}"), testLanguages(nil), p, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("/lint returned status %d after the slot was released, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+	}
+	if got := w.Header().Get("X-Queue-Depth"); got != "0" {
+		t.Errorf("/lint returned X-Queue-Depth %q, want %q", got, "0")
+	}
+}
@@ -0,0 +1,136 @@
+// Package handlers contains http handler code for op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/osprogramadores/op-web-linter/common"
+	"github.com/osprogramadores/op-web-linter/lang"
+	"github.com/osprogramadores/op-web-linter/metrics"
+)
+
+// maxRunRequestSize is the maximum size of a /run request: the input and
+// expected output of the test cases, the program files and some room for
+// the JSON encoding.
+const maxRunRequestSize = 2*lang.MaxCases*lang.MaxCaseSize + lang.MaxFilesSize + 1<<20
+
+// RunRequestHandler handles /run. The request is a JSON encoded
+// lang.RunRequest. Unlike the program text in /lint, texts are not escaped.
+// If pool is not nil, requests wait for a free slot in the pool before
+// building the program. Requests fail (with 503) if the sandbox is disabled.
+func RunRequestHandler(w http.ResponseWriter, r *http.Request, supported lang.Languages, pool *WorkerPool) {
+	logger := common.Logger(r.Context())
+	logger.Info("RUN Request", "remote", common.RealRemoteAddress(r), "method", r.Method, "url", r.URL.String())
+	CORSHandler(w, r)
+	if r.Method == "OPTIONS" {
+		logger.Debug("Got OPTIONS method. Returning.")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Only POST request.
+	if r.Method != "POST" {
+		common.HTTPError(w, r, "Only POST requested accepted", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Submitted programs are only run inside the sandbox.
+	if !lang.Sandbox.Enabled {
+		common.HTTPError(w, r, "Running programs requires the sandbox, which is disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Content-type must be application/json.
+	if !strings.Contains(r.Header.Get("content-type"), "application/json") {
+		common.HTTPError(w, r, "Incorrect content-type. Expected: application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	var req lang.RunRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRunRequestSize)).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			common.HTTPError(w, r, fmt.Sprintf("Request larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		common.HTTPError(w, r, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.Debug("Received request", "lang", req.Lang, "files", len(req.Files), "cases", len(req.Cases), common.Redact("text", req.Text))
+
+	// Program text must not be null. Multi-file programs have no text.
+	if len(req.Text) == 0 && len(req.Files) == 0 {
+		common.HTTPError(w, r, "Program text cannot be empty", http.StatusBadRequest)
+		return
+	}
+	if len(req.Text) > 0 && len(req.Files) > 0 {
+		common.HTTPError(w, r, "Program text and files cannot be used together", http.StatusBadRequest)
+		return
+	}
+
+	// Count the request by outcome (set below) when done.
+	outcome := "error"
+	defer func() {
+		metrics.RunRequests.Inc(req.Lang, outcome)
+	}()
+
+	// Build and run the program after waiting for a free slot.
+	run := func() (lang.RunResponse, error) {
+		if pool != nil {
+			release, depth, wait, err := pool.Acquire(r.Context(), req.Lang)
+			logger.Info("Queue", "lang", req.Lang, "depth", depth, "wait", wait, "error", err)
+			w.Header().Set("X-Queue-Depth", strconv.Itoa(depth))
+			w.Header().Set("X-Queue-Wait-Ms", strconv.FormatInt(wait.Milliseconds(), 10))
+			if err != nil {
+				return lang.RunResponse{}, err
+			}
+			defer release()
+		}
+		return supported.Run(r.Context(), req)
+	}
+	resp, err := run()
+
+	switch {
+	case err == ErrQueueFull:
+		outcome = "busy"
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		common.HTTPError(w, r, "Server busy, please try again later", http.StatusTooManyRequests)
+		return
+	case r.Context().Err() != nil:
+		// Client went away.
+		outcome = "canceled"
+		common.HTTPError(w, r, r.Context().Err().Error(), http.StatusServiceUnavailable)
+		return
+	case errors.Is(err, lang.ErrUnknownLanguage), errors.Is(err, lang.ErrNotRunnable):
+		common.HTTPError(w, r, "Invalid Language: "+err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, lang.ErrInvalidFiles), errors.Is(err, lang.ErrInvalidCases), errors.Is(err, lang.ErrUnknownChallenge):
+		common.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		common.HTTPError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jresp, err := json.Marshal(resp)
+	if err != nil {
+		common.HTTPError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	outcome = "fail"
+	if resp.Pass {
+		outcome = "pass"
+	}
+	logger.Info("Run response", "lang", req.Lang, "pass", resp.Pass, "built", resp.Built, "cases", len(resp.Cases))
+	logger.Debug("JSON response", common.Redact("json", string(jresp)))
+	w.Header().Set("content-type", "application/json")
+	w.Write(jresp)
+	w.Write([]byte("\n"))
+}
@@ -0,0 +1,124 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/osprogramadores/op-web-linter/lang"
+)
+
+func TestRunRequestHandler(t *testing.T) {
+	// The fake runner passes programs printing their input.
+	runner := lang.RunnerFunc(func(ctx context.Context, req lang.RunRequest) (lang.RunResponse, error) {
+		resp := lang.RunResponse{Built: true, Pass: true}
+		for _, tc := range req.Cases {
+			pass := req.Text == "echo" && tc.Stdin == tc.Expected
+			resp.Cases = append(resp.Cases, lang.CaseResult{Name: tc.Name, Pass: pass})
+			resp.Pass = resp.Pass && pass
+		}
+		return resp, nil
+	})
+	languages := testLanguages(nil)
+	c := languages["c"]
+	c.Runner = runner
+	languages["c"] = c
+
+	defer func(enabled bool) { lang.Sandbox.Enabled = enabled }(lang.Sandbox.Enabled)
+
+	tests := []struct {
+		name      string
+		method    string
+		ctype     string
+		body      string
+		noSandbox bool
+		wantCode  int
+		wantBody  string
+	}{
+		{
+			name:     "pass",
+			body:     `{"lang":"c","text":"echo","cases":[{"name":"one","stdin":"1","expected":"1"}]}`,
+			wantCode: http.StatusOK,
+			wantBody: `"Pass":true`,
+		},
+		{
+			name:     "fail",
+			body:     `{"lang":"c","text":"cat","cases":[{"stdin":"1","expected":"1"}]}`,
+			wantCode: http.StatusOK,
+			wantBody: `"Pass":false`,
+		},
+		{
+			name:     "get",
+			method:   "GET",
+			wantCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:     "content type",
+			ctype:    "text/plain",
+			body:     "echo",
+			wantCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:     "invalid json",
+			body:     `{"lang":`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "empty program",
+			body:     `{"lang":"c","cases":[{"stdin":"1","expected":"1"}]}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "not runnable",
+			body:     `{"lang":"go","text":"echo","cases":[{"stdin":"1","expected":"1"}]}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: "Invalid Language",
+		},
+		{
+			name:     "no cases",
+			body:     `{"lang":"c","text":"echo"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: "invalid test cases",
+		},
+		{
+			name:      "sandbox disabled",
+			body:      `{"lang":"c","text":"echo","cases":[{"name":"one","stdin":"1","expected":"1"}]}`,
+			noSandbox: true,
+			wantCode:  http.StatusServiceUnavailable,
+			wantBody:  "requires the sandbox",
+		},
+		{
+			name:     "too large",
+			body:     `{"lang":"c","text":"` + strings.Repeat("x", maxRunRequestSize) + `"}`,
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, ctype := tt.method, tt.ctype
+			if method == "" {
+				method = "POST"
+			}
+			if ctype == "" {
+				ctype = "application/json"
+			}
+			lang.Sandbox.Enabled = !tt.noSandbox
+			r := httptest.NewRequest(method, "/run/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", ctype)
+			w := httptest.NewRecorder()
+			RunRequestHandler(w, r, languages, nil)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("/run returned status %d, want %d (body %q)", w.Code, tt.wantCode, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("/run returned %q, want it to contain %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -6,23 +6,25 @@ package handlers
 
 import (
 	htemplate "html/template"
+	"log/slog"
 	ttemplate "text/template"
 
-	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/osprogramadores/op-web-linter/common"
+	"github.com/osprogramadores/op-web-linter/lang"
 )
 
 // FormData holds the parameters passed to the
 type FormData struct {
 	RootPath       string         // The base path for the server (default = "/").
 	LanguagesPath  string         // Path for API languages calls.
+	ChallengesPath string         // Path for API challenges calls.
 	LintPath       string         // Path for API linter calls.
-	SupportedLangs SupportedLangs // Supported Languages.
+	SupportedLangs lang.Languages // Supported Languages.
 	StaticDir      string         // Directory for static files.
 	StaticPath     string         // Path for static files (/static).
 	TmplPath       string         // Path for template files.
@@ -31,7 +33,7 @@ type FormData struct {
 // TmplSetup parses all templates under dir and sets up handlers under path for
 // each of the files it finds.
 func TmplSetup(dir, path string, tmpldata *FormData) error {
-	log.Printf("Setting up templates from: %s", dir)
+	slog.Info("Setting up templates", "dir", dir)
 
 	files, err := os.ReadDir(dir)
 	if err != nil {
@@ -43,7 +45,7 @@ func TmplSetup(dir, path string, tmpldata *FormData) error {
 		fpath := filepath.Join(dir, fname)
 
 		if !file.Type().IsRegular() {
-			log.Printf("Ignoring %s (not a plain file)", fpath)
+			slog.Info("Ignoring template (not a plain file)", "file", fpath)
 			continue
 		}
 
@@ -57,10 +59,11 @@ func TmplSetup(dir, path string, tmpldata *FormData) error {
 			}
 			// Create handlers for each file.
 			http.HandleFunc(urlpath, func(w http.ResponseWriter, r *http.Request) {
-				log.Printf("Serving HTML template %s", urlpath)
+				logger := common.Logger(r.Context())
+				logger.Info("Serving HTML template", "path", urlpath)
 				if err := tmpl.Execute(w, tmpldata); err != nil {
-					log.Printf("Error serving HTML template: %v", err)
-					common.HTTPError(w, err.Error(), http.StatusInternalServerError)
+					logger.Error("Error serving HTML template", "error", err)
+					common.HTTPError(w, r, err.Error(), http.StatusInternalServerError)
 					return
 				}
 			})
@@ -71,17 +74,18 @@ func TmplSetup(dir, path string, tmpldata *FormData) error {
 			}
 			// Create handlers for each file.
 			http.HandleFunc(urlpath, func(w http.ResponseWriter, r *http.Request) {
-				log.Printf("Serving text template %s", urlpath)
+				logger := common.Logger(r.Context())
+				logger.Info("Serving text template", "path", urlpath)
 				w.Header().Set("Content-Type", "application/javascript")
 				if err := tmpl.Execute(w, tmpldata); err != nil {
-					log.Printf("Error serving text template: %v", err)
-					common.HTTPError(w, err.Error(), http.StatusInternalServerError)
+					logger.Error("Error serving text template", "error", err)
+					common.HTTPError(w, r, err.Error(), http.StatusInternalServerError)
 					return
 				}
 			})
 		}
 
-		log.Printf("Registered template handler at: %s", urlpath)
+		slog.Info("Registered template handler", "path", urlpath)
 	}
 	return nil
 }
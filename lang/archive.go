@@ -0,0 +1,140 @@
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrUnknownArchive is returned when reading archives in unsupported formats.
+var ErrUnknownArchive = errors.New("unknown archive format (expected zip or tar.gz)")
+
+// ReadArchive returns the files in a zip or tar.gz archive, for multi-file
+// requests. Directories are ignored. Archives with links, special files,
+// paths outside the archive root (E.g. "../x" or "/etc/x"), or exceeding the
+// limits for multi-file requests are rejected with an error wrapping
+// ErrInvalidFiles.
+func ReadArchive(data []byte) ([]File, error) {
+	var (
+		files []File
+		err   error
+	)
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		files, err = readZip(data)
+	case bytes.HasPrefix(data, []byte("\x1f\x8b")):
+		files, err = readTarGz(data)
+	default:
+		return nil, ErrUnknownArchive
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFiles(files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// readZip returns the files in a zip archive.
+func readZip(data []byte) ([]File, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var (
+		files []File
+		size  int
+	)
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		if !zf.Mode().IsRegular() {
+			return nil, fmt.Errorf("%w: %q is not a regular file", ErrInvalidFiles, zf.Name)
+		}
+		if len(files) == MaxFiles {
+			return nil, errTooManyFiles
+		}
+		f, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		file, err := readArchiveFile(zf.Name, f, &size)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// readTarGz returns the files in a gzip compressed tar archive.
+func readTarGz(data []byte) ([]File, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var (
+		files []File
+		size  int
+	)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir, tar.TypeXGlobalHeader:
+			continue
+		case tar.TypeReg:
+		default:
+			return nil, fmt.Errorf("%w: %q is not a regular file", ErrInvalidFiles, hdr.Name)
+		}
+		if len(files) == MaxFiles {
+			return nil, errTooManyFiles
+		}
+		file, err := readArchiveFile(hdr.Name, tr, &size)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+}
+
+// readArchiveFile reads a file from an archive, adding its length to size.
+// Fails if the name is not a valid path, or if size exceeds MaxFilesSize
+// (E.g. for highly compressed files).
+func readArchiveFile(name string, r io.Reader, size *int) (File, error) {
+	// Archives created from the current directory have names starting
+	// with "./".
+	name = strings.TrimPrefix(name, "./")
+	if err := checkPath(name); err != nil {
+		return File{}, err
+	}
+	data, err := io.ReadAll(io.LimitReader(r, int64(MaxFilesSize-*size+1)))
+	if err != nil {
+		return File{}, err
+	}
+	*size += len(data)
+	if *size > MaxFilesSize {
+		return File{}, fmt.Errorf("%w: files larger than %d bytes", ErrInvalidFiles, MaxFilesSize)
+	}
+	return File{Path: name, Text: string(data)}, nil
+}
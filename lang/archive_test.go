@@ -0,0 +1,203 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// archiveEntry is an entry in an archive built by the tests.
+type archiveEntry struct {
+	name string
+	text string
+	mode fs.FileMode // Type bits only (E.g. fs.ModeDir, fs.ModeSymlink).
+}
+
+// makeZip returns a zip archive with the entries.
+func makeZip(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		hdr.SetMode(e.mode | 0o644)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// makeTarGz returns a gzip compressed tar archive with the entries.
+func makeTarGz(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Typeflag: tar.TypeReg, Size: int64(len(e.text))}
+		switch e.mode {
+		case fs.ModeDir:
+			hdr.Typeflag, hdr.Size = tar.TypeDir, 0
+		case fs.ModeSymlink:
+			hdr.Typeflag, hdr.Size, hdr.Linkname = tar.TypeSymlink, 0, e.text
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			if _, err := tw.Write([]byte(e.text)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+		want    []File
+		wantErr error
+	}{
+		{
+			name: "files",
+			entries: []archiveEntry{
+				{name: "main.c", text: "int main() {}\n"},
+				{name: "src/", mode: fs.ModeDir},
+				{name: "src/util.h", text: "void f();\n"},
+			},
+			want: []File{
+				{Path: "main.c", Text: "int main() {}\n"},
+				{Path: "src/util.h", Text: "void f();\n"},
+			},
+		},
+		{
+			name: "current directory prefix",
+			entries: []archiveEntry{
+				{name: "./", mode: fs.ModeDir},
+				{name: "./main.c", text: "int main() {}\n"},
+			},
+			want: []File{{Path: "main.c", Text: "int main() {}\n"}},
+		},
+		{
+			name:    "parent directory",
+			entries: []archiveEntry{{name: "../main.c", text: "x"}},
+			wantErr: ErrInvalidFiles,
+		},
+		{
+			name:    "parent directory inside path",
+			entries: []archiveEntry{{name: "src/../../main.c", text: "x"}},
+			wantErr: ErrInvalidFiles,
+		},
+		{
+			name:    "absolute path",
+			entries: []archiveEntry{{name: "/etc/passwd", text: "x"}},
+			wantErr: ErrInvalidFiles,
+		},
+		{
+			name:    "symlink",
+			entries: []archiveEntry{{name: "passwd", text: "/etc/passwd", mode: fs.ModeSymlink}},
+			wantErr: ErrInvalidFiles,
+		},
+		{
+			name: "duplicate path",
+			entries: []archiveEntry{
+				{name: "main.c", text: "a"},
+				{name: "./main.c", text: "b"},
+			},
+			wantErr: ErrInvalidFiles,
+		},
+		{
+			name: "file and directory",
+			entries: []archiveEntry{
+				{name: "src", text: "a"},
+				{name: "src/main.c", text: "b"},
+			},
+			wantErr: ErrInvalidFiles,
+		},
+		{
+			name: "files too large",
+			entries: []archiveEntry{
+				{name: "a.c", text: strings.Repeat("a", MaxFilesSize/2)},
+				{name: "b.c", text: strings.Repeat("b", MaxFilesSize/2+1)},
+			},
+			wantErr: ErrInvalidFiles,
+		},
+		{
+			name:    "too many files",
+			entries: manyEntries(MaxFiles + 1),
+			wantErr: ErrInvalidFiles,
+		},
+	}
+	formats := []struct {
+		name string
+		make func(*testing.T, []archiveEntry) []byte
+	}{
+		{"zip", makeZip},
+		{"tar.gz", makeTarGz},
+	}
+	for _, format := range formats {
+		for _, tt := range tests {
+			t.Run(format.name+"/"+tt.name, func(t *testing.T) {
+				got, err := ReadArchive(format.make(t, tt.entries))
+				if tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Errorf("ReadArchive returned error %v, want %v", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("ReadArchive returned error: %v", err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("ReadArchive = %+v, want %+v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+// manyEntries returns n archive entries with distinct names.
+func manyEntries(n int) []archiveEntry {
+	var entries []archiveEntry
+	for i := 0; i < n; i++ {
+		entries = append(entries, archiveEntry{name: fmt.Sprintf("f%d.c", i), text: "x"})
+	}
+	return entries
+}
+
+func TestReadArchiveUnknownFormat(t *testing.T) {
+	for _, data := range []string{"", "not an archive", "GIF89a"} {
+		if _, err := ReadArchive([]byte(data)); !errors.Is(err, ErrUnknownArchive) {
+			t.Errorf("ReadArchive(%q) returned error %v, want %v", data, err, ErrUnknownArchive)
+		}
+	}
+	if _, err := ReadArchive([]byte("\x1f\x8bbroken")); err == nil {
+		t.Errorf("ReadArchive with a broken gzip stream returned no error")
+	}
+}
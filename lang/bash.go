@@ -0,0 +1,155 @@
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// shellDialect holds the names of a shell dialect in shellcheck and shfmt.
+type shellDialect struct {
+	shellcheck string
+	shfmt      string
+}
+
+// Shell dialects, keyed by the interpreter name in the shebang. Programs
+// without a shebang (or with unknown interpreters) are treated as bash.
+var shellDialects = map[string]shellDialect{
+	"bash": {"bash", "bash"},
+	"dash": {"dash", "posix"},
+	"ksh":  {"ksh", "mksh"},
+	"mksh": {"ksh", "mksh"},
+	"sh":   {"sh", "posix"},
+}
+
+// Resource limits for the shell tools.
+var bashLimits = DefaultLimits
+
+// FingerprintBash identifies the versions of the shell tools, for caching.
+var FingerprintBash = fingerprint([][]string{{"shellcheck", "--version"}, {"shfmt", "--version"}}, noFiles)
+
+// shellcheckOutput is the output of shellcheck in the json1 format.
+type shellcheckOutput struct {
+	Comments []struct {
+		Line      int    `json:"line"`
+		EndLine   int    `json:"endLine"`
+		Column    int    `json:"column"`
+		EndColumn int    `json:"endColumn"`
+		Level     string `json:"level"`
+		Code      int    `json:"code"`
+		Message   string `json:"message"`
+	} `json:"comments"`
+}
+
+// LintBash lints shell scripts using shfmt and shellcheck. The dialect (bash
+// by default) is taken from the shebang.
+func LintBash(ctx context.Context, req LintRequest) (LintResponse, error) {
+	tempdir, tempfile, err := saveRequestToFile(ctx, req.Text, "*.sh")
+	if err != nil {
+		return LintResponse{}, err
+	}
+	defer os.RemoveAll(tempdir)
+
+	dialect := shebangDialect(req.Text)
+	var diags []Diagnostic
+
+	// Reformat source code using shfmt. In case of errors, we move ahead
+	// with the old code and attempt linting anyway.
+	reformatted := req.Text
+	out, reformatErr := Execute(ctx, tempdir, bashLimits, "shfmt", "shfmt", "-ln", dialect.shfmt, "-i", "4", tempfile)
+	if reformatErr != nil {
+		diags = append(diags, formatterDiagnostics("shfmt", fmt.Sprintf("Error reformatting shell script: %v", reformatErr), reformatErr, out)...)
+	} else {
+		// Rewrite reformatted program to tempfile.
+		reformatted = out
+		if err := os.WriteFile(tempfile, []byte(reformatted), 0644); err != nil {
+			return LintResponse{}, err
+		}
+	}
+
+	// shellcheck returns an error code (1) when it finds problems. We look
+	// for the output instead.
+	out, err = Execute(ctx, tempdir, bashLimits, "shellcheck", "shellcheck", "--format=json1", "--shell="+dialect.shellcheck, tempfile)
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		diags = append(diags, toolDiagnostics("shellcheck", fmt.Sprintf("Error running shellcheck: %v", err), err, out)...)
+	} else {
+		d, err := bashFilterOutput(out)
+		if err != nil {
+			diags = append(diags, toolDiagnostics("shellcheck", fmt.Sprintf("Error parsing shellcheck output: %v", err), nil, out)...)
+		}
+		diags = append(diags, d...)
+	}
+
+	// Create and return response.
+	return LintResponse{
+		Pass:            len(diags) == 0,
+		ErrorMessages:   ErrorMessages(diags),
+		Diagnostics:     setSource(diags, textSource(reformatErr == nil, false)),
+		Reformatted:     reformatted != req.Text,
+		ReformattedText: reformatted,
+		Formatter:       "shfmt",
+	}, nil
+}
+
+// shebangDialect returns the shell dialect named in the shebang of the
+// program (E.g. "#!/bin/sh" or "#!/usr/bin/env bash").
+func shebangDialect(text string) shellDialect {
+	line, _, _ := strings.Cut(text, "\n")
+	if !strings.HasPrefix(line, "#!") {
+		return shellDialects["bash"]
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) > 1 && filepath.Base(fields[0]) == "env" {
+		// Skip env and its options (E.g. "-S").
+		fields = fields[1:]
+		for len(fields) > 0 && strings.HasPrefix(fields[0], "-") {
+			fields = fields[1:]
+		}
+	}
+	if len(fields) > 0 {
+		if d, ok := shellDialects[filepath.Base(fields[0])]; ok {
+			return d
+		}
+	}
+	return shellDialects["bash"]
+}
+
+// bashFilterOutput converts the shellcheck output (json1 format) into
+// diagnostics. Each diagnostic has the SC code as the rule and a link to the
+// page explaining it in the shellcheck wiki.
+func bashFilterOutput(output string) ([]Diagnostic, error) {
+	var sc shellcheckOutput
+	if err := json.Unmarshal([]byte(output), &sc); err != nil {
+		return nil, err
+	}
+	var ret []Diagnostic
+	for _, c := range sc.Comments {
+		code := fmt.Sprintf("SC%d", c.Code)
+		ret = append(ret, Diagnostic{
+			Tool:      "shellcheck",
+			Line:      c.Line,
+			Column:    c.Column,
+			EndLine:   c.EndLine,
+			EndColumn: c.EndColumn,
+			Severity:  c.Level,
+			RuleID:    code,
+			Message:   c.Message,
+			Context:   []string{ShellcheckWikiURL(code)},
+		})
+	}
+	return ret, nil
+}
+
+// ShellcheckWikiURL returns the link to the shellcheck wiki page explaining
+// a code (E.g. "SC2086").
+func ShellcheckWikiURL(code string) string {
+	return "https://www.shellcheck.net/wiki/" + code
+}
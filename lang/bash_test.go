@@ -0,0 +1,150 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestShebangDialect(t *testing.T) {
+	tests := []struct {
+		text string
+		want string // shellcheck name.
+	}{
+		{"echo hello\n", "bash"},
+		{"", "bash"},
+		{"#!/bin/bash\necho hello\n", "bash"},
+		{"#!/bin/sh\n", "sh"},
+		{"#! /bin/dash -e\n", "dash"},
+		{"#!/usr/bin/env bash\n", "bash"},
+		{"#!/usr/bin/env -S ksh -e\n", "ksh"},
+		{"#!/bin/mksh", "ksh"},
+		{"#!/usr/bin/env\n", "bash"},
+		{"#!/usr/bin/zsh\n", "bash"},
+		{"# comment\n#!/bin/sh\n", "bash"},
+	}
+	for _, tt := range tests {
+		if got := shebangDialect(tt.text); got.shellcheck != tt.want {
+			t.Errorf("shebangDialect(%q) = %+v, want shellcheck dialect %q", tt.text, got, tt.want)
+		}
+	}
+	if got, want := shebangDialect("#!/bin/sh\n"), (shellDialect{"sh", "posix"}); got != want {
+		t.Errorf("shebangDialect(sh) = %+v, want %+v", got, want)
+	}
+}
+
+func TestBashFilterOutput(t *testing.T) {
+	out := `{"comments":[` +
+		`{"file":"/tmp/1/2.sh","line":3,"endLine":3,"column":6,"endColumn":8,"level":"info","code":2086,"message":"Double quote to prevent globbing and word splitting.","fix":null},` +
+		`{"file":"/tmp/1/2.sh","line":5,"endLine":6,"column":1,"endColumn":3,"level":"error","code":1073,"message":"Couldn't parse this if expression.","fix":null}]}`
+	want := []Diagnostic{
+		{
+			Tool:      "shellcheck",
+			Line:      3,
+			Column:    6,
+			EndLine:   3,
+			EndColumn: 8,
+			Severity:  "info",
+			RuleID:    "SC2086",
+			Message:   "Double quote to prevent globbing and word splitting.",
+			Context:   []string{"https://www.shellcheck.net/wiki/SC2086"},
+		},
+		{
+			Tool:      "shellcheck",
+			Line:      5,
+			Column:    1,
+			EndLine:   6,
+			EndColumn: 3,
+			Severity:  "error",
+			RuleID:    "SC1073",
+			Message:   "Couldn't parse this if expression.",
+			Context:   []string{"https://www.shellcheck.net/wiki/SC1073"},
+		},
+	}
+	got, err := bashFilterOutput(out)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("bashFilterOutput =\n%+v, %v\nwant:\n%+v", got, err, want)
+	}
+
+	if got, err := bashFilterOutput(`{"comments":[]}`); err != nil || got != nil {
+		t.Errorf("bashFilterOutput(no comments) = %+v, %v, want nil, nil", got, err)
+	}
+	if _, err := bashFilterOutput("shellcheck: not JSON"); err == nil {
+		t.Errorf("bashFilterOutput(invalid output) returned no error")
+	}
+}
+
+// fakeShellTools installs fake versions of shfmt (collapsing repeated spaces,
+// failing on "(") and shellcheck (always passing) in the PATH.
+func fakeShellTools(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	scripts := map[string]string{
+		"shfmt": `#!/bin/sh
+eval "file=\${$#}"
+if grep -q '(' "$file"; then
+	echo "$file:1:6: reached EOF without matching ( with )"
+	exit 1
+fi
+tr -s ' ' < "$file"
+`,
+		"shellcheck": `#!/bin/sh
+echo '{"comments":[]}'
+`,
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+}
+
+func TestLintBash(t *testing.T) {
+	fakeShellTools(t)
+	tests := []struct {
+		name            string
+		text            string
+		wantPass        bool
+		wantReformatted bool
+		wantText        string // Reformatted text.
+	}{
+		{
+			name:     "formatted",
+			text:     "echo hello\n",
+			wantPass: true,
+			wantText: "echo hello\n",
+		},
+		{
+			name:            "reformatted",
+			text:            "echo  hello\n",
+			wantPass:        true,
+			wantReformatted: true,
+			wantText:        "echo hello\n",
+		},
+		{
+			name:     "syntax error",
+			text:     "echo  $(\n",
+			wantText: "echo  $(\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := LintBash(context.Background(), LintRequest{Text: tt.text})
+			if err != nil {
+				t.Fatalf("LintBash returned error: %v", err)
+			}
+			if resp.Pass != tt.wantPass || resp.Reformatted != tt.wantReformatted || resp.Formatter != "shfmt" {
+				t.Errorf("LintBash(%q) = %+v, want Pass=%v Reformatted=%v", tt.text, resp, tt.wantPass, tt.wantReformatted)
+			}
+			if resp.ReformattedText != tt.wantText {
+				t.Errorf("LintBash(%q) returned reformatted text %q, want %q", tt.text, resp.ReformattedText, tt.wantText)
+			}
+		})
+	}
+}
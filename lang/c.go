@@ -5,79 +5,84 @@
 package lang
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"log"
-	"net/http"
 	"os"
 	"strings"
-
-	"github.com/osprogramadores/op-web-linter/common"
-	"github.com/osprogramadores/op-web-linter/handlers"
 )
 
+// Style used by clang-format, and by clang-tidy when applying fixes.
+const clangFormatStyle = "{BasedOnStyle: google, IndentWidth: 4}"
+
+// Resource limits for the C tools.
+var cLimits = DefaultLimits
+
+// FingerprintC identifies the versions of the C tools, for caching.
+var FingerprintC = fingerprint([][]string{{"clang-format", "--version"}, {"clang-tidy", "--version"}}, noFiles)
+
 // LintC lints programs written in C using clang-format and clang-tidy.
-func LintC(w http.ResponseWriter, r *http.Request, req handlers.LintRequest) {
-	var clangChecks = []string{
-		"readability*",
-		"clang-analyzer-*",
-		"concurrency-*",
-		"cppcoreguidelines-*",
-		"google-*",
-		"-readability-identifier-length",
-		"-readability-magic-numbers",
-		"-cppcoreguidelines-avoid-magic-numbers",
+// Multi-file requests are linted by lintClangFiles.
+func LintC(ctx context.Context, req LintRequest) (LintResponse, error) {
+	if len(req.Files) > 0 {
+		return lintClangFiles(ctx, req, clangC)
 	}
 
-	tempdir, tempfile, err := saveRequestToFile(req.Text, "*.c")
+	tempdir, tempfile, err := saveRequestToFile(ctx, req.Text, "*.c")
 	if err != nil {
-		common.HTTPError(w, err.Error(), http.StatusInternalServerError)
-		return
+		return LintResponse{}, err
 	}
 	defer os.RemoveAll(tempdir)
 
-	var messages []string
+	var diags []Diagnostic
 
 	// Reformat source code using clang-format. In case of errors, we move ahead
 	// with the old code and attempt linting anyway.
-	reformatted, err := Execute("clang-format", "--assume-filename=c",
-		"--style={BasedOnStyle: google, IndentWidth: 4}", tempfile)
+	reformatted, err := Execute(ctx, tempdir, cLimits, "clang-format", "clang-format", "--assume-filename=c",
+		"--style="+clangFormatStyle, tempfile)
 	if err != nil {
-		messages = append(messages, fmt.Sprintf("Error reformatting C code: %v", err))
-		messages = append(messages, strings.Split(reformatted, "\n")...)
+		diags = append(diags, formatterDiagnostics("clang-format", fmt.Sprintf("Error reformatting C code: %v", err), err, reformatted)...)
 	} else {
 		// Rewrite reformatted program to tempfile.
 		if err := os.WriteFile(tempfile, []byte(reformatted), 0644); err != nil {
-			common.HTTPError(w, err.Error(), http.StatusInternalServerError)
-			return
+			return LintResponse{}, err
 		}
 	}
 	reformatErr := err
 
+	// Apply the clang-tidy fix-its, if requested. Fixed code is reformatted
+	// with the same style and linted below.
+	var fix fixResult
+	if req.Fix {
+		fix, err = runFixer(ctx, "clang-tidy", tempdir, tempfile, cLimits, "clang-tidy", "--checks="+strings.Join(clangChecks, ","),
+			"--fix", "--format-style="+clangFormatStyle, tempfile, "--")
+		if err != nil {
+			return LintResponse{}, err
+		}
+		diags = append(diags, fix.diags...)
+	}
+
 	// clang-tidy returns an error code (1) on errors, but nothing on warnings.
-	// We want to indicate every situation, so we ignore it here and look for
-	// the output. Blank output means no errors.
-	out, _ := Execute("clang-tidy", "--checks="+strings.Join(clangChecks, ","), tempfile, "--")
+	// We want to indicate every situation, so we ignore it here (unless a
+	// resource limit was exceeded) and look for the output. Blank output
+	// means no errors.
+	out, err := Execute(ctx, tempdir, cLimits, "clang-tidy", "clang-tidy", "--checks="+strings.Join(clangChecks, ","), tempfile, "--")
 	// Use cppFilterOutput since it's basically a clang-tidy output beautifier.
-	lines := cppFilterOutput(strings.Split(out, "\n"), tempfile)
-	messages = append(messages, common.SlicePrefix(lines, "clang-tidy")...)
+	diags = append(diags, cppFilterOutput(strings.Split(out, "\n"), "")...)
+	diags = append(diags, limitDiagnostics("clang-tidy", err)...)
 
 	// Pass if no messages from the reformatter or linter.
-	pass := len(messages) == 0
+	pass := len(diags) == 0
 
-	// Create response, convert to JSON and return.
-	resp := handlers.LintResponse{
+	// Create and return response.
+	return LintResponse{
 		Pass:            pass,
-		ErrorMessages:   messages,
+		ErrorMessages:   ErrorMessages(diags),
+		Diagnostics:     setSource(diags, textSource(reformatErr == nil, fix.fixed())),
 		Reformatted:     reformatted != req.Text && reformatErr == nil,
 		ReformattedText: reformatted,
-	}
-	jresp, err := json.Marshal(resp)
-	if err != nil {
-		common.HTTPError(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	log.Printf("JSON response:\n%s", prettyJSONString(jresp))
-	w.Write(jresp)
-	w.Write([]byte("\n"))
+		Formatter:       "clang-format",
+		Fixed:           fix.fixed(),
+		FixedText:       fix.text,
+		Fixes:           fix.edits,
+	}, nil
 }
@@ -0,0 +1,369 @@
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnknownChallenge is returned for requests selecting a challenge without
+// a profile.
+var ErrUnknownChallenge = errors.New("unknown challenge")
+
+// Name of the profile file in each challenge directory.
+const challengeProfileFile = "profile.yaml"
+
+// Challenge holds the profile of a challenge: the test cases used by run
+// requests and the house rules checked by lint requests.
+type Challenge struct {
+	ID        string               `yaml:"-"`         // Challenge ID (name of its directory).
+	Title     string               `yaml:"title"`     // User visible name (default: ID).
+	URL       string               `yaml:"url"`       // Challenge description (optional).
+	TimeLimit float64              `yaml:"timeLimit"` // Maximum wall time of each test case, in seconds (optional).
+	Cases     []TestCase           `yaml:"-"`         // Test cases.
+	Forbidden map[string]Forbidden `yaml:"forbidden"` // Forbidden imports and functions, by language.
+	Rules     []ChallengeRule      `yaml:"rules"`     // Extra lint rules.
+
+	fingerprint string
+}
+
+// Forbidden lists imports and functions programs can't use.
+type Forbidden struct {
+	Imports   []string `yaml:"imports"`   // Packages, modules or headers (E.g. "math/big" or "itertools").
+	Functions []string `yaml:"functions"` // Functions, optionally qualified (E.g. "sort.Ints" or "eval").
+}
+
+// ChallengeRule is an extra lint rule: a regular expression that programs
+// must not match.
+type ChallengeRule struct {
+	ID       string   `yaml:"id"`       // Rule ID.
+	Regex    string   `yaml:"regex"`    // Regular expression (Go syntax).
+	Message  string   `yaml:"message"`  // Message shown when the program matches the regex.
+	Severity string   `yaml:"severity"` // Severity (default: error).
+	Langs    []string `yaml:"langs"`    // Languages the rule applies to (default: all).
+
+	re *regexp.Regexp
+}
+
+// challengeProfile is the format of the profile files. Test cases may read
+// their input and expected output from files in the challenge directory.
+type challengeProfile struct {
+	Challenge `yaml:",inline"`
+	Cases     []struct {
+		TestCase     `yaml:",inline"`
+		StdinFile    string `yaml:"stdinFile"`
+		ExpectedFile string `yaml:"expectedFile"`
+	} `yaml:"cases"`
+}
+
+// ChallengeSet holds a set of challenges, keyed by ID.
+type ChallengeSet map[string]*Challenge
+
+// Challenges holds the challenges selected by the challenge field in lint
+// and run requests. It should only be changed at startup, before any calls
+// to Lint or Run.
+var Challenges = ChallengeSet{}
+
+// Extract the imports in a line of a program, by language. Go imports are
+// parsed from the whole program instead.
+var importRegexes = map[string]*regexp.Regexp{
+	"c":          regexp.MustCompile(`^\s*#\s*include\s*[<"]([^>"]+)[>"]`),
+	"cpp":        regexp.MustCompile(`^\s*#\s*include\s*[<"]([^>"]+)[>"]`),
+	"java":       regexp.MustCompile(`^\s*import\s+(?:static\s+)?([\w.]+(?:\.\*)?)\s*;`),
+	"javascript": regexp.MustCompile(`(?:\bfrom|\bimport|\brequire)\s*\(?\s*["']([^"']+)["']`),
+	"python":     regexp.MustCompile(`^\s*(?:from\s+([\w.]+)\s+import\b|import\s+([\w.]+(?:\s+as\s+\w+)?(?:\s*,\s*[\w.]+(?:\s+as\s+\w+)?)*))`),
+	"rust":       regexp.MustCompile(`^\s*(?:pub\s+)?(?:use\s+::?([\w:]+)|extern\s+crate\s+(\w+))`),
+	"typescript": regexp.MustCompile(`(?:\bfrom|\bimport|\brequire)\s*\(?\s*["']([^"']+)["']`),
+}
+
+// LoadChallenges loads the challenge profiles in dir. Each challenge is a
+// directory named after its ID, holding a profile.yaml file and the files
+// with the test case inputs and outputs, if any. Directories without a
+// profile are ignored.
+func LoadChallenges(dir string) (ChallengeSet, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	ret := ChallengeSet{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		c, err := loadChallenge(filepath.Join(dir, e.Name()), e.Name())
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("challenge %s: %v", e.Name(), err)
+		}
+		ret[c.ID] = c
+	}
+	return ret, nil
+}
+
+// loadChallenge loads the profile of a challenge from its directory.
+func loadChallenge(dir, id string) (*Challenge, error) {
+	data, err := os.ReadFile(filepath.Join(dir, challengeProfileFile))
+	if err != nil {
+		return nil, err
+	}
+	var p challengeProfile
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	d.KnownFields(true)
+	if err := d.Decode(&p); err != nil {
+		return nil, fmt.Errorf("%s: %v", challengeProfileFile, err)
+	}
+
+	c := p.Challenge
+	c.ID = id
+	if c.Title == "" {
+		c.Title = id
+	}
+	if c.TimeLimit < 0 || c.TimeLimit > caseTimeout.Seconds() {
+		return nil, fmt.Errorf("timeLimit must be between 0 and %v seconds", caseTimeout.Seconds())
+	}
+	for i, pc := range p.Cases {
+		tc := pc.TestCase
+		for _, f := range []struct {
+			name string
+			text *string
+		}{{pc.StdinFile, &tc.Stdin}, {pc.ExpectedFile, &tc.Expected}} {
+			if f.name == "" {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, f.name))
+			if err != nil {
+				return nil, fmt.Errorf("case %d: %v", i+1, err)
+			}
+			*f.text = string(data)
+		}
+		c.Cases = append(c.Cases, tc)
+	}
+	if len(c.Cases) > 0 {
+		if err := checkCases(c.Cases); err != nil {
+			return nil, err
+		}
+	}
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if r.ID == "" || r.Regex == "" || r.Message == "" {
+			return nil, fmt.Errorf("rule %d: id, regex and message are mandatory", i+1)
+		}
+		if r.re, err = regexp.Compile(r.Regex); err != nil {
+			return nil, fmt.Errorf("rule %s: %v", r.ID, err)
+		}
+		if r.Severity == "" {
+			r.Severity = "error"
+		}
+	}
+
+	// Cached responses depend on the contents of the profile.
+	jc, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(jc)
+	c.fingerprint = hex.EncodeToString(sum[:])
+	return &c, nil
+}
+
+// IDs returns the sorted IDs of all challenges in the set.
+func (s ChallengeSet) IDs() []string {
+	var ids []string
+	for id := range s {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Fingerprint identifies the contents of the profile of a challenge, for
+// caching. Returns "" for unknown challenges.
+func (s ChallengeSet) Fingerprint(id string) string {
+	if c, ok := s[id]; ok {
+		return c.fingerprint
+	}
+	return ""
+}
+
+// lookupChallenge returns the challenge with the given ID from Challenges,
+// or nil if id is empty. Returns ErrUnknownChallenge if there is no such
+// challenge.
+func lookupChallenge(id string) (*Challenge, error) {
+	if id == "" {
+		return nil, nil
+	}
+	c, ok := Challenges[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownChallenge, id)
+	}
+	return c, nil
+}
+
+// checkChallenge adds diagnostics to the response for the house rules of
+// the challenge broken by the files of a program (the program text, for
+// single file programs). Does nothing if c is nil.
+func checkChallenge(resp *LintResponse, c *Challenge, language string, files []File) {
+	diags := challengeDiagnostics(c, language, files)
+	if len(diags) == 0 {
+		return
+	}
+	resp.Diagnostics = append(resp.Diagnostics, diags...)
+	resp.ErrorMessages = ErrorMessages(resp.Diagnostics)
+	resp.Pass = false
+}
+
+// challengeDiagnostics returns the diagnostics for the house rules of the
+// challenge broken by the files of a program, with positions in the original
+// text of each file. Returns nil if c is nil.
+func challengeDiagnostics(c *Challenge, language string, files []File) []Diagnostic {
+	if c == nil {
+		return nil
+	}
+	var diags []Diagnostic
+	for _, f := range files {
+		diags = append(diags, setFile(c.check(language, f.Text), f.Path)...)
+	}
+	for i := range diags {
+		diags[i].OriginalLine, diags[i].OriginalEndLine = diags[i].Line, diags[i].EndLine
+	}
+	return setSource(diags, SourceOriginal)
+}
+
+// check returns diagnostics for the forbidden imports and functions and the
+// extra rules matched by the text of a program. Functions and rules are
+// matched textually, so they may also match comments and strings.
+func (c *Challenge) check(language, text string) []Diagnostic {
+	var diags []Diagnostic
+	forbidden := c.Forbidden[language]
+	for _, imp := range programImports(language, text) {
+		for _, f := range forbidden.Imports {
+			if importMatches(imp.name, f) {
+				diags = append(diags, Diagnostic{
+					Tool:     "challenge",
+					Line:     imp.line,
+					Severity: "error",
+					RuleID:   "forbidden-import",
+					Message:  fmt.Sprintf("import of %q is not allowed in challenge %s", imp.name, c.ID),
+				})
+			}
+		}
+	}
+	for _, fn := range forbidden.Functions {
+		re := regexp.MustCompile(`(?:^|[^\w.$])(` + regexp.QuoteMeta(fn) + `)\s*\(`)
+		for _, m := range re.FindAllStringSubmatchIndex(text, -1) {
+			line, col := textPosition(text, m[2])
+			diags = append(diags, Diagnostic{
+				Tool:     "challenge",
+				Line:     line,
+				Column:   col,
+				Severity: "error",
+				RuleID:   "forbidden-function",
+				Message:  fmt.Sprintf("function %q is not allowed in challenge %s", fn, c.ID),
+			})
+		}
+	}
+	for _, r := range c.Rules {
+		if len(r.Langs) > 0 && !containsString(r.Langs, language) {
+			continue
+		}
+		for _, m := range r.re.FindAllStringIndex(text, -1) {
+			line, col := textPosition(text, m[0])
+			diags = append(diags, Diagnostic{
+				Tool:     "challenge",
+				Line:     line,
+				Column:   col,
+				Severity: r.Severity,
+				RuleID:   r.ID,
+				Message:  r.Message,
+			})
+		}
+	}
+	sortDiagnostics(diags)
+	return diags
+}
+
+// programImport is a package, module or header imported by a program.
+type programImport struct {
+	name string
+	line int
+}
+
+// programImports returns the imports of a program, for languages with
+// known import syntax.
+func programImports(language, text string) []programImport {
+	var ret []programImport
+	if language == "golang" {
+		fset := token.NewFileSet()
+		f, _ := parser.ParseFile(fset, "", text, parser.ImportsOnly)
+		if f == nil {
+			return nil
+		}
+		for _, spec := range f.Imports {
+			if name, err := strconv.Unquote(spec.Path.Value); err == nil {
+				ret = append(ret, programImport{name: name, line: fset.Position(spec.Pos()).Line})
+			}
+		}
+		return ret
+	}
+
+	re, ok := importRegexes[language]
+	if !ok {
+		return nil
+	}
+	for i, line := range strings.Split(text, "\n") {
+		for _, m := range re.FindAllStringSubmatch(line, -1) {
+			for _, group := range m[1:] {
+				// Python imports several modules at once (E.g. "import
+				// os, sys as s").
+				for _, name := range strings.Split(group, ",") {
+					name, _, _ = strings.Cut(strings.TrimSpace(name), " ")
+					if name != "" {
+						ret = append(ret, programImport{name: name, line: i + 1})
+					}
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// importMatches returns true if name is the forbidden import or one of its
+// submodules (E.g. "os.path" for "os").
+func importMatches(name, forbidden string) bool {
+	if name == forbidden {
+		return true
+	}
+	for _, sep := range []string{".", "/", "::"} {
+		if strings.HasPrefix(name, forbidden+sep) {
+			return true
+		}
+	}
+	return false
+}
+
+// textPosition returns the line and column (starting at 1) of a byte offset
+// in text.
+func textPosition(text string, offset int) (int, int) {
+	before := text[:offset]
+	line := strings.Count(before, "\n") + 1
+	return line, offset - strings.LastIndex(before, "\n")
+}
@@ -0,0 +1,306 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testChallenge is the profile of the challenge used by the tests.
+const testChallenge = `
+title: Sum
+timeLimit: 2
+cases:
+  - name: small
+    stdin: "1 2\n"
+    expected: "3\n"
+  - stdinFile: big.in
+    expectedFile: big.out
+forbidden:
+  python:
+    imports: [numpy]
+    functions: [eval]
+  golang:
+    imports: [math/big]
+rules:
+  - id: hardcoded-answer
+    regex: 'print\("?[0-9]+"?\)'
+    message: the answer must be computed
+    severity: warning
+    langs: [python]
+`
+
+// writeChallenges writes challenge directories with the given files (keyed
+// by challenge ID and file name) into a temporary directory.
+func writeChallenges(t *testing.T, challenges map[string]map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for id, files := range challenges {
+		if err := os.Mkdir(filepath.Join(dir, id), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, text := range files {
+			if err := os.WriteFile(filepath.Join(dir, id, name), []byte(text), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return dir
+}
+
+// setTestChallenges loads the test challenge as "sum" into Challenges until
+// the test ends.
+func setTestChallenges(t *testing.T) {
+	t.Helper()
+	dir := writeChallenges(t, map[string]map[string]string{
+		"sum": {"profile.yaml": testChallenge, "big.in": "1000 2000\n", "big.out": "3000\n"},
+	})
+	challenges, err := LoadChallenges(dir)
+	if err != nil {
+		t.Fatalf("LoadChallenges returned error: %v", err)
+	}
+	saved := Challenges
+	Challenges = challenges
+	t.Cleanup(func() { Challenges = saved })
+}
+
+func TestLoadChallenges(t *testing.T) {
+	dir := writeChallenges(t, map[string]map[string]string{
+		"sum":     {"profile.yaml": testChallenge, "big.in": "1000 2000\n", "big.out": "3000\n"},
+		"empty":   {"profile.yaml": "url: https://example.com/\n"},
+		"noprof":  {"README": "not a challenge\n"},
+		"another": {"profile.yaml": "title: Another\n"},
+	})
+	challenges, err := LoadChallenges(dir)
+	if err != nil {
+		t.Fatalf("LoadChallenges returned error: %v", err)
+	}
+	if got, want := challenges.IDs(), []string{"another", "empty", "sum"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadChallenges returned challenges %v, want %v", got, want)
+	}
+
+	c := challenges["sum"]
+	wantCases := []TestCase{
+		{Name: "small", Stdin: "1 2\n", Expected: "3\n"},
+		{Stdin: "1000 2000\n", Expected: "3000\n"},
+	}
+	if c.Title != "Sum" || c.TimeLimit != 2 || !reflect.DeepEqual(c.Cases, wantCases) {
+		t.Errorf("LoadChallenges returned title %q, time limit %v and cases %+v, want %q, 2 and %+v", c.Title, c.TimeLimit, c.Cases, "Sum", wantCases)
+	}
+	if c.Rules[0].Severity != "warning" {
+		t.Errorf("Rule has severity %q, want %q", c.Rules[0].Severity, "warning")
+	}
+	if got := challenges["empty"].Title; got != "empty" {
+		t.Errorf("Challenge without title has title %q, want its ID", got)
+	}
+
+	// Fingerprints identify the contents of each profile.
+	if challenges.Fingerprint("empty") == challenges.Fingerprint("another") || challenges.Fingerprint("sum") == "" {
+		t.Errorf("Fingerprints are not unique: %q, %q, %q", challenges.Fingerprint("sum"), challenges.Fingerprint("empty"), challenges.Fingerprint("another"))
+	}
+	if got := challenges.Fingerprint("unknown"); got != "" {
+		t.Errorf("Fingerprint of unknown challenge = %q, want empty", got)
+	}
+}
+
+func TestLoadChallengesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+	}{
+		{"invalid yaml", "title: [\n"},
+		{"unknown field", "tittle: Sum\n"},
+		{"time limit", "timeLimit: 60\n"},
+		{"missing file", "cases:\n  - stdinFile: missing.in\n"},
+		{"invalid cases", "cases:\n  - stdin: \"" + strings.Repeat("a", MaxCaseSize+1) + "\"\n"},
+		{"incomplete rule", "rules:\n  - id: rule\n    regex: x\n"},
+		{"invalid regex", "rules:\n  - id: rule\n    regex: '('\n    message: m\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeChallenges(t, map[string]map[string]string{"bad": {"profile.yaml": tt.profile}})
+			if _, err := LoadChallenges(dir); err == nil || !strings.HasPrefix(err.Error(), "challenge bad: ") {
+				t.Errorf("LoadChallenges returned error %v, want one for challenge bad", err)
+			}
+		})
+	}
+	if _, err := LoadChallenges(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("LoadChallenges for a missing directory returned no error")
+	}
+}
+
+func TestChallengeCheck(t *testing.T) {
+	setTestChallenges(t)
+	c := Challenges["sum"]
+
+	tests := []struct {
+		name string
+		lang string
+		text string
+		want []Diagnostic
+	}{
+		{
+			name: "clean",
+			lang: "python",
+			text: "a, b = map(int, input().split())\nprint(a + b)\n",
+		},
+		{
+			name: "forbidden python imports",
+			lang: "python",
+			text: "import os, numpy as np\nfrom numpy.linalg import norm\nimport numpyx\n",
+			want: []Diagnostic{
+				{Tool: "challenge", Line: 1, Severity: "error", RuleID: "forbidden-import", Message: `import of "numpy" is not allowed in challenge sum`},
+				{Tool: "challenge", Line: 2, Severity: "error", RuleID: "forbidden-import", Message: `import of "numpy.linalg" is not allowed in challenge sum`},
+			},
+		},
+		{
+			name: "forbidden function",
+			lang: "python",
+			text: "x = eval(input())\ny = obj.eval(x)\n",
+			want: []Diagnostic{
+				{Tool: "challenge", Line: 1, Column: 5, Severity: "error", RuleID: "forbidden-function", Message: `function "eval" is not allowed in challenge sum`},
+			},
+		},
+		{
+			name: "rule",
+			lang: "python",
+			text: "print(3)\n",
+			want: []Diagnostic{
+				{Tool: "challenge", Line: 1, Column: 1, Severity: "warning", RuleID: "hardcoded-answer", Message: "the answer must be computed"},
+			},
+		},
+		{
+			name: "rule in other language",
+			lang: "javascript",
+			text: "print(3)\n",
+		},
+		{
+			name: "go imports",
+			lang: "golang",
+			text: "package main\n\nimport (\n\t\"fmt\"\n\t\"math/big\"\n)\n",
+			want: []Diagnostic{
+				{Tool: "challenge", Line: 5, Severity: "error", RuleID: "forbidden-import", Message: `import of "math/big" is not allowed in challenge sum`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.check(tt.lang, tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("check =\n%+v\nwant:\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportMatches(t *testing.T) {
+	tests := []struct {
+		name, forbidden string
+		want            bool
+	}{
+		{"numpy", "numpy", true},
+		{"numpy.linalg", "numpy", true},
+		{"numpyx", "numpy", false},
+		{"math/big", "math", true},
+		{"std::collections::HashMap", "std::collections", true},
+		{"java.util.*", "java.util", true},
+		{"os", "os.path", false},
+	}
+	for _, tt := range tests {
+		if got := importMatches(tt.name, tt.forbidden); got != tt.want {
+			t.Errorf("importMatches(%q, %q) = %v, want %v", tt.name, tt.forbidden, got, tt.want)
+		}
+	}
+}
+
+// TestLintChallenge checks that lint requests selecting a challenge report
+// the house rules broken by the program.
+func TestLintChallenge(t *testing.T) {
+	setTestChallenges(t)
+	languages := Languages{"python": {Display: "Python", Extension: "py", Linter: headerLinter}}
+
+	resp, err := languages.Lint(context.Background(), LintRequest{Text: "print(3)\n", Lang: "python", Challenge: "sum"})
+	if err != nil {
+		t.Fatalf("Lint returned error: %v", err)
+	}
+	if resp.Pass || len(resp.Diagnostics) != 2 {
+		t.Fatalf("Lint returned Pass=%v and %d diagnostics, want false and 2", resp.Pass, len(resp.Diagnostics))
+	}
+	if d := resp.Diagnostics[1]; d.RuleID != "hardcoded-answer" || d.Source != SourceOriginal || d.OriginalLine != 1 {
+		t.Errorf("Lint returned diagnostic %+v, want the house rule on original line 1", d)
+	}
+	if _, err := languages.Lint(context.Background(), LintRequest{Text: "print(3)\n", Lang: "python", Challenge: "unknown"}); !errors.Is(err, ErrUnknownChallenge) {
+		t.Errorf("Lint with an unknown challenge returned error %v, want %v", err, ErrUnknownChallenge)
+	}
+}
+
+// TestRunChallenge checks that run requests selecting a challenge use its
+// test cases, and fail when breaking its house rules.
+func TestRunChallenge(t *testing.T) {
+	setTestChallenges(t)
+	languages := Languages{"python": {Display: "Python", Extension: "py", Linter: headerLinter, Runner: pythonRunner}}
+
+	tests := []struct {
+		name      string
+		text      string
+		cases     []TestCase
+		wantPass  bool
+		wantDiags int
+		wantCases int
+	}{
+		{
+			name:      "pass",
+			text:      "a, b = map(int, input().split())\nprint(a + b)\n",
+			wantPass:  true,
+			wantCases: 2,
+		},
+		{
+			name:      "house rule",
+			text:      "a, b = map(int, eval('input().split()'))\nprint(a + b)\n",
+			wantDiags: 1,
+			wantCases: 2,
+		},
+		{
+			name:      "wrong output",
+			text:      "import sys\nline = input()\nprint(line)\nprint(line, file=sys.stderr)\n",
+			wantCases: 2,
+		},
+		{
+			name:      "request cases",
+			text:      "a, b = map(int, input().split())\nprint(a + b)\n",
+			cases:     []TestCase{{Stdin: "1 1\n", Expected: "3\n"}},
+			wantCases: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := languages.Run(context.Background(), RunRequest{Text: tt.text, Lang: "python", Challenge: "sum", Cases: tt.cases})
+			if err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+			if len(resp.Cases) != tt.wantCases || resp.Pass != tt.wantPass || len(resp.Diagnostics) != tt.wantDiags {
+				t.Fatalf("Run returned %d cases, Pass=%v and %d diagnostics, want %d, %v and %d", len(resp.Cases), resp.Pass, len(resp.Diagnostics), tt.wantCases, tt.wantPass, tt.wantDiags)
+			}
+			// Only the cases of the challenge are hidden.
+			for _, c := range resp.Cases {
+				hidden := tt.cases == nil
+				if c.Hidden != hidden || (hidden && (c.Stdout != "" || c.Stderr != "" || c.Diff != "")) {
+					t.Errorf("Run returned case %+v, want Hidden=%v (without output and diff if hidden)", c, hidden)
+				}
+				if !hidden && !c.Pass && c.Diff == "" {
+					t.Errorf("Run returned failed case %+v without a diff", c)
+				}
+			}
+		})
+	}
+
+	if _, err := languages.Run(context.Background(), RunRequest{Text: "print(3)\n", Lang: "python", Challenge: "sum", TimeLimit: 60}); !errors.Is(err, ErrInvalidCases) {
+		t.Errorf("Run with a time limit over the maximum returned error %v, want %v", err, ErrInvalidCases)
+	}
+}
@@ -0,0 +1,157 @@
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Checks run by clang-tidy on C and C++ programs.
+var clangChecks = []string{
+	"readability*",
+	"clang-analyzer-*",
+	"concurrency-*",
+	"cppcoreguidelines-*",
+	"google-*",
+	"-readability-identifier-length",
+	"-readability-magic-numbers",
+	"-cppcoreguidelines-avoid-magic-numbers",
+}
+
+// clangLanguage describes the files and compiler options of a language
+// linted with the clang tools, for multi-file requests.
+type clangLanguage struct {
+	name    string   // Language name, for messages.
+	sources []string // Extensions of the source files (compiled and linted).
+	headers []string // Extensions of the header files (reformatted only).
+	args    []string // Compiler arguments.
+	limits  Limits   // Resource limits.
+}
+
+// Languages linted with the clang tools.
+var (
+	clangC = clangLanguage{
+		name:    "C",
+		sources: []string{".c"},
+		headers: []string{".h"},
+		limits:  cLimits,
+	}
+	clangCPP = clangLanguage{
+		name:    "C++",
+		sources: []string{".cpp", ".cc", ".cxx"},
+		headers: []string{".h", ".hh", ".hpp", ".hxx"},
+		args:    []string{"--std=c++14"},
+		limits:  cppLimits,
+	}
+)
+
+// lintClangFiles lints a multi-file C or C++ program. All files are
+// reformatted with clang-format, and the source files are linted together
+// by clang-tidy, which reports problems in the headers they include too.
+func lintClangFiles(ctx context.Context, req LintRequest, lang clangLanguage) (LintResponse, error) {
+	tempdir, fnames, err := saveRequestFiles(ctx, req.Files)
+	if err != nil {
+		return LintResponse{}, err
+	}
+	defer os.RemoveAll(tempdir)
+
+	// Headers are included relative to the source files or to the root.
+	checks := "--checks=" + strings.Join(clangChecks, ",")
+	args := append([]string{"--", "-I" + tempdir}, lang.args...)
+
+	var (
+		diags   []Diagnostic
+		sources []string
+		files   []FileResponse
+		fixes   []FixEdit
+
+		reformatted bool
+	)
+	textSources := map[string]string{}
+	for i, f := range req.Files {
+		ext := path.Ext(f.Path)
+		source := containsString(lang.sources, ext)
+		if !source && !containsString(lang.headers, ext) {
+			continue
+		}
+		fname := fnames[i]
+
+		// Reformat file using clang-format. In case of errors, we move
+		// ahead with the old code and attempt linting anyway.
+		text, err := Execute(ctx, tempdir, lang.limits, "clang-format", "clang-format", "--style="+clangFormatStyle, fname)
+		if err != nil {
+			d := formatterDiagnostics("clang-format", fmt.Sprintf("Error reformatting %s code: %v", lang.name, err), err, text)
+			diags = append(diags, setFile(d, f.Path)...)
+		} else if err := os.WriteFile(fname, []byte(text), 0644); err != nil {
+			return LintResponse{}, err
+		}
+		fr := FileResponse{
+			Path:            f.Path,
+			Reformatted:     text != f.Text && err == nil,
+			ReformattedText: text,
+		}
+		reformatErr := err
+
+		// Apply the clang-tidy fix-its to source files, if requested.
+		var fix fixResult
+		if source && req.Fix {
+			fix, err = runFixer(ctx, "clang-tidy", tempdir, fname, lang.limits, "clang-tidy",
+				append([]string{checks, "--fix", "--format-style=" + clangFormatStyle, fname}, args...)...)
+			if err != nil {
+				return LintResponse{}, err
+			}
+			diags = append(diags, setFile(fix.diags, f.Path)...)
+			for _, e := range fix.edits {
+				e.File = f.Path
+				fixes = append(fixes, e)
+			}
+			fr.Fixed, fr.FixedText = fix.fixed(), fix.text
+		}
+
+		textSources[f.Path] = textSource(reformatErr == nil, fix.fixed())
+		files = append(files, fr)
+		reformatted = reformatted || fr.Reformatted
+		if source {
+			sources = append(sources, fname)
+		}
+	}
+	if len(sources) == 0 {
+		return LintResponse{}, fmt.Errorf("%w: no %s source files (%s)", ErrInvalidFiles, lang.name, strings.Join(lang.sources, ", "))
+	}
+
+	// clang-tidy returns an error code (1) on errors, but nothing on warnings.
+	// We look for the output instead. Headers included by several source
+	// files may have the same problems reported more than once.
+	cmd := append([]string{checks, "--header-filter=^" + regexp.QuoteMeta(tempdir+"/")}, sources...)
+	out, err := Execute(ctx, tempdir, lang.limits, "clang-tidy", "clang-tidy", append(cmd, args...)...)
+	diags = append(diags, uniqueDiagnostics(cppFilterOutput(strings.Split(out, "\n"), tempdir))...)
+	diags = append(diags, limitDiagnostics("clang-tidy", err)...)
+
+	// Positions refer to the text of each file after reformatting and
+	// fixing.
+	for i := range diags {
+		diags[i].Source = SourceOriginal
+		if s, ok := textSources[diags[i].File]; ok {
+			diags[i].Source = s
+		}
+	}
+
+	// Create and return response.
+	return LintResponse{
+		Pass:          len(diags) == 0,
+		ErrorMessages: ErrorMessages(diags),
+		Diagnostics:   diags,
+		Reformatted:   reformatted,
+		Formatter:     "clang-format",
+		Fixed:         len(fixes) > 0,
+		Fixes:         fixes,
+		Files:         files,
+	}, nil
+}
@@ -5,25 +5,23 @@
 package lang
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"log"
-	"net/url"
 	"os"
+	"strconv"
+	"strings"
+
+	"github.com/osprogramadores/op-web-linter/common"
+	"github.com/osprogramadores/op-web-linter/metrics"
 )
 
-// saveRequestToFile unescapes the passed request data and saves it into a
-// temporary file, returning its directory and name. The template parameter
+// saveRequestToFile saves the program text into a temporary file, returning
+// its directory and name. The template parameter
 // specifies how the filename will appear.  Use "*.foo" to have a temporary
 // filename with extension foo.  Callers must use defer os.Removeall(tempdir)
 // in their functions.
-func saveRequestToFile(data string, template string) (string, string, error) {
-	unescaped, err := url.QueryUnescape(data)
-	if err != nil {
-		return "", "", err
-	}
-	log.Printf("Decoded Request: %s\n", unescaped)
+func saveRequestToFile(ctx context.Context, data string, template string) (string, string, error) {
+	common.Logger(ctx).Debug("Program text", common.Redact("text", data))
 
 	tempdir, err := os.MkdirTemp("", "")
 	if err != nil {
@@ -36,19 +34,103 @@ func saveRequestToFile(data string, template string) (string, string, error) {
 	}
 	defer tempfd.Close()
 
-	if _, err = tempfd.Write([]byte(unescaped)); err != nil {
+	if _, err = tempfd.Write([]byte(data)); err != nil {
 		os.RemoveAll(tempdir)
 		return "", "", err
 	}
 	return tempdir, tempfd.Name(), nil
 }
 
-// prettyJSONString converts a "text" slice of JSON bytes into a pretty
-// formatted JSON string.
-func prettyJSONString(j []byte) string {
-	var pretty bytes.Buffer
-	if err := json.Indent(&pretty, j, "", "    "); err != nil {
-		return fmt.Sprintf("Error printing JSON: %v", err)
+// toolDiagnostics returns a diagnostic containing a global failure message
+// for the named tool (usually a reformatter). The error that caused the
+// failure, if any, sets the rule ID. Failures that look like exceeding a
+// limit from the output (see outputLimit) are reported as such. Any output
+// from the tool is attached to the diagnostic as context.
+func toolDiagnostics(tool, msg string, err error, output string) []Diagnostic {
+	d := Diagnostic{
+		Tool:     tool,
+		Severity: "error",
+		RuleID:   limitRuleID(err),
+		Message:  msg,
+	}
+	if limit := outputLimit(err, output); limit != "" {
+		d.RuleID = RuleResourceLimit
+		d.Message += fmt.Sprintf(" (%s limit exceeded?)", limit)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) != "" {
+			d.Context = append(d.Context, line)
+		}
+	}
+	return []Diagnostic{d}
+}
+
+// formatterDiagnostics works like toolDiagnostics for reformatting failures,
+// which are also counted in the metrics.
+func formatterDiagnostics(tool, msg string, err error, output string) []Diagnostic {
+	metrics.FormatterFailures.Inc(tool)
+	return toolDiagnostics(tool, msg, err, output)
+}
+
+// setSource records the text the diagnostics refer to (one of the Source
+// constants).
+func setSource(diags []Diagnostic, source string) []Diagnostic {
+	for i := range diags {
+		diags[i].Source = source
+	}
+	return diags
+}
+
+// textSource returns the text the linters ran on: the fixed text if fixed is
+// true, the reformatted text if reformatted is true, or the original text.
+func textSource(reformatted, fixed bool) string {
+	switch {
+	case fixed:
+		return SourceFixed
+	case reformatted:
+		return SourceReformatted
+	}
+	return SourceOriginal
+}
+
+// appendUnparsed adds a line that could not be parsed into a diagnostic. The
+// line is added as context to the last diagnostic in the slice, if any, or
+// as a new diagnostic without position information.
+func appendUnparsed(diags []Diagnostic, tool, line string) []Diagnostic {
+	if len(diags) == 0 {
+		return append(diags, Diagnostic{Tool: tool, Message: line})
+	}
+	last := &diags[len(diags)-1]
+	last.Context = append(last.Context, line)
+	return diags
+}
+
+// atoi converts a string to an integer, returning zero on errors. Used to
+// convert line and column numbers already validated by a regexp.
+func atoi(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// containsInt returns true if the slice contains the value.
+func containsInt(slice []int, value int) bool {
+	for _, v := range slice {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString returns true if the slice contains the value.
+func containsString(slice []string, value string) bool {
+	for _, v := range slice {
+		if v == value {
+			return true
+		}
 	}
-	return pretty.String()
+	return false
 }
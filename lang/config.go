@@ -0,0 +1,339 @@
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// LanguagesConfig holds the contents of the languages configuration file.
+type LanguagesConfig struct {
+	Languages map[string]*LanguageConfig `json:"languages"` // Keyed by language name.
+}
+
+// LanguageConfig describes a language defined in the configuration file.
+type LanguageConfig struct {
+	Display   string        `json:"display"`   // User visible name.
+	Extension string        `json:"extension"` // File extension (without the dot).
+	Formatter *ToolConfig   `json:"formatter"` // Formatter (optional).
+	Fixer     *ToolConfig   `json:"fixer"`     // Autofix tool, run when requested (optional).
+	Linters   []*ToolConfig `json:"linters"`   // Linters, run in order.
+	Limits    *Limits       `json:"limits"`    // Resource limits (default: DefaultLimits).
+}
+
+// ToolConfig describes one external tool (formatter, fixer or linter). The strings
+// {file}, {dir} and {home} in the command line are replaced by the source
+// file, the temporary directory and the home directory of the server.
+type ToolConfig struct {
+	Name      string   `json:"name"`      // Name used in diagnostics (default: first word of command).
+	Command   []string `json:"command"`   // Command line.
+	InPlace   bool     `json:"inPlace"`   // Formatter or fixer rewrites the file instead of printing to stdout.
+	Regex     string   `json:"regex"`     // Regexp matching diagnostic lines (see toolRegexGroups).
+	Ignore    string   `json:"ignore"`    // Regexp matching output lines to be ignored.
+	Severity  string   `json:"severity"`  // Severity for diagnostics that don't report one.
+	PassCodes []int    `json:"passCodes"` // Exit codes meaning success (default: 0).
+	FailCodes []int    `json:"failCodes"` // Exit codes meaning problems found (default: 1).
+
+	regex  *regexp.Regexp
+	ignore *regexp.Regexp
+	limits *Limits
+}
+
+// Named groups recognized in ToolConfig.Regex. Only "message" is mandatory.
+var toolRegexGroups = map[string]bool{
+	"line":     true,
+	"col":      true,
+	"endline":  true,
+	"endcol":   true,
+	"severity": true,
+	"rule":     true,
+	"message":  true,
+}
+
+// LoadLanguages reads the languages configuration file and returns the
+// languages defined in it, ready to be merged into the supported languages.
+func LoadLanguages(fname string) (Languages, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var cfg LanguagesConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+
+	ret := Languages{}
+	for name, lc := range cfg.Languages {
+		if err := lc.compile(); err != nil {
+			return nil, fmt.Errorf("%s: language %q: %v", fname, name, err)
+		}
+		ret[name] = Language{Display: lc.Display, Extension: lc.Extension, Linter: lc, Fingerprint: lc.fingerprint()}
+	}
+	return ret, nil
+}
+
+// compile validates the language configuration, sets defaults and compiles
+// the regular expressions.
+func (lc *LanguageConfig) compile() error {
+	if lc.Display == "" || lc.Extension == "" {
+		return fmt.Errorf("display and extension are mandatory")
+	}
+	if lc.Formatter == nil && len(lc.Linters) == 0 {
+		return fmt.Errorf("at least one formatter or linter must be defined")
+	}
+	if lc.Limits == nil {
+		limits := DefaultLimits
+		lc.Limits = &limits
+	}
+	if lc.Formatter != nil {
+		lc.Formatter.limits = lc.Limits
+		if err := lc.Formatter.compile(false); err != nil {
+			return fmt.Errorf("formatter: %v", err)
+		}
+	}
+	if lc.Fixer != nil {
+		lc.Fixer.limits = lc.Limits
+		if err := lc.Fixer.compile(false); err != nil {
+			return fmt.Errorf("fixer: %v", err)
+		}
+	}
+	for i, t := range lc.Linters {
+		t.limits = lc.Limits
+		if err := t.compile(true); err != nil {
+			return fmt.Errorf("linter %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// fingerprint returns a function identifying the language definition and
+// the binaries of its tools, for caching.
+func (lc *LanguageConfig) fingerprint() func() string {
+	def, _ := json.Marshal(lc)
+	tools := fingerprint(nil, func() []string {
+		var files []string
+		for _, t := range append([]*ToolConfig{lc.Formatter, lc.Fixer}, lc.Linters...) {
+			if t != nil {
+				files = append(files, t.Command[0])
+			}
+		}
+		return files
+	})
+	return func() string {
+		fp := tools()
+		if fp == "" {
+			return ""
+		}
+		return fmt.Sprintf("%x:%s", sha256.Sum256(def), fp)
+	}
+}
+
+// compile validates the tool configuration, sets defaults and compiles the
+// regular expressions. Linters must define a regexp with a message group.
+func (t *ToolConfig) compile(linter bool) error {
+	if len(t.Command) == 0 {
+		return fmt.Errorf("command is mandatory")
+	}
+	if t.Name == "" {
+		t.Name = t.Command[0]
+	}
+	if len(t.PassCodes) == 0 {
+		t.PassCodes = []int{0}
+	}
+	if len(t.FailCodes) == 0 {
+		t.FailCodes = []int{1}
+	}
+
+	var err error
+	if t.Ignore != "" {
+		if t.ignore, err = regexp.Compile(t.Ignore); err != nil {
+			return err
+		}
+	}
+	if !linter {
+		return nil
+	}
+	if t.regex, err = regexp.Compile(t.Regex); err != nil {
+		return err
+	}
+	if t.regex.SubexpIndex("message") < 0 {
+		return fmt.Errorf("regex must contain a named group called \"message\"")
+	}
+	for _, name := range t.regex.SubexpNames() {
+		if name != "" && !toolRegexGroups[name] {
+			return fmt.Errorf("unknown named group in regex: %q", name)
+		}
+	}
+	return nil
+}
+
+// Lint lints a program using the tools described in the language configuration.
+func (lc *LanguageConfig) Lint(ctx context.Context, req LintRequest) (LintResponse, error) {
+	tempdir, tempfile, err := saveRequestToFile(ctx, req.Text, "*."+lc.Extension)
+	if err != nil {
+		return LintResponse{}, err
+	}
+	defer os.RemoveAll(tempdir)
+
+	vars := strings.NewReplacer("{file}", tempfile, "{dir}", tempdir, "{home}", os.Getenv("HOME"))
+
+	var (
+		diags       []Diagnostic
+		reformatted string
+		reformatOK  bool
+		pass        = true
+	)
+
+	// Reformat first, if we have a formatter. In case of errors, we move
+	// ahead with the old code and attempt linting anyway.
+	if f := lc.Formatter; f != nil {
+		out, code, err := f.run(ctx, tempdir, vars)
+		if err == nil && !containsInt(f.PassCodes, code) {
+			err = fmt.Errorf("exit code %d", code)
+		}
+		switch {
+		case err != nil:
+			diags = append(diags, formatterDiagnostics(f.Name, fmt.Sprintf("Reformat failed: %v", err), err, out)...)
+		case f.InPlace:
+			data, err := os.ReadFile(tempfile)
+			if err != nil {
+				return LintResponse{}, err
+			}
+			reformatted, reformatOK = string(data), true
+		default:
+			// Rewrite reformatted program to tempfile.
+			if err := os.WriteFile(tempfile, []byte(out), 0644); err != nil {
+				return LintResponse{}, err
+			}
+			reformatted, reformatOK = out, true
+		}
+	}
+
+	// Apply fixes, if requested. The fixed program is linted below.
+	var fix fixResult
+	if f := lc.Fixer; f != nil && req.Fix {
+		fix, err = fixFile(f.Name, tempfile, func() (string, error) {
+			return f.fix(ctx, tempdir, tempfile, vars)
+		})
+		if err != nil {
+			return LintResponse{}, err
+		}
+		diags = append(diags, fix.diags...)
+	}
+
+	for _, t := range lc.Linters {
+		d, ok := t.lint(ctx, tempdir, vars)
+		diags = append(diags, d...)
+		pass = pass && ok
+	}
+
+	// Create and return response.
+	resp := LintResponse{
+		Pass:            pass && len(diags) == 0,
+		ErrorMessages:   ErrorMessages(diags),
+		Diagnostics:     setSource(diags, textSource(reformatOK, fix.fixed())),
+		Reformatted:     reformatOK && reformatted != req.Text,
+		ReformattedText: reformatted,
+		Fixed:           fix.fixed(),
+		FixedText:       fix.text,
+		Fixes:           fix.edits,
+	}
+	if lc.Formatter != nil {
+		resp.Formatter = lc.Formatter.Name
+	}
+	return resp, nil
+}
+
+// fix runs the fixer on the program in tempfile. Fixers not rewriting the
+// file in place print the fixed program, which is written to tempfile. Exit
+// codes in FailCodes mean problems remain (reported later by the linters).
+func (t *ToolConfig) fix(ctx context.Context, dir, tempfile string, vars *strings.Replacer) (string, error) {
+	out, _, err := t.run(ctx, dir, vars)
+	if err != nil || t.InPlace {
+		return out, err
+	}
+	return out, os.WriteFile(tempfile, []byte(out), 0644)
+}
+
+// run executes the tool after expanding the variables in the command line.
+// Returns the output and exit code of the tool. Exit codes listed in
+// PassCodes or FailCodes are not considered errors.
+func (t *ToolConfig) run(ctx context.Context, dir string, vars *strings.Replacer) (string, int, error) {
+	var args []string
+	for _, arg := range t.Command[1:] {
+		args = append(args, vars.Replace(arg))
+	}
+	out, err := Execute(ctx, dir, *t.limits, t.Name, vars.Replace(t.Command[0]), args...)
+	code := Exitcode(err)
+
+	if err != nil {
+		// Execution errors (E.g. program not found) have no exit code.
+		if _, ok := err.(*exec.ExitError); !ok {
+			return out, code, err
+		}
+		if !containsInt(t.PassCodes, code) && !containsInt(t.FailCodes, code) {
+			return out, code, err
+		}
+	}
+	return out, code, nil
+}
+
+// lint runs the tool as a linter and parses its output into diagnostics.
+// Returns false if the tool indicates problems through the exit code.
+func (t *ToolConfig) lint(ctx context.Context, dir string, vars *strings.Replacer) ([]Diagnostic, bool) {
+	out, code, err := t.run(ctx, dir, vars)
+	if err != nil {
+		return toolDiagnostics(t.Name, fmt.Sprintf("Error running %s: %v", t.Name, err), err, out), false
+	}
+
+	var diags []Diagnostic
+	for _, v := range strings.Split(out, "\n") {
+		// Remove blank and ignored lines.
+		if strings.TrimSpace(v) == "" || (t.ignore != nil && t.ignore.MatchString(v)) {
+			continue
+		}
+		r := t.regex.FindStringSubmatch(v)
+
+		// Unable to parse line. Include literally.
+		if r == nil {
+			diags = appendUnparsed(diags, t.Name, v)
+			continue
+		}
+		group := func(name string) string {
+			if i := t.regex.SubexpIndex(name); i >= 0 {
+				return r[i]
+			}
+			return ""
+		}
+		d := Diagnostic{
+			Tool:      t.Name,
+			Line:      atoi(group("line")),
+			Column:    atoi(group("col")),
+			EndLine:   atoi(group("endline")),
+			EndColumn: atoi(group("endcol")),
+			Severity:  group("severity"),
+			RuleID:    group("rule"),
+			Message:   group("message"),
+		}
+		if d.Severity == "" {
+			d.Severity = t.Severity
+		}
+		diags = append(diags, d)
+	}
+
+	// Make sure a failure exit code without any output still fails.
+	ok := containsInt(t.PassCodes, code)
+	if !ok && len(diags) == 0 {
+		diags = toolDiagnostics(t.Name, fmt.Sprintf("%s reported problems (exit code %d)", t.Name, code), nil, "")
+	}
+	return diags, ok
+}
@@ -0,0 +1,151 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLoadLanguagesExample(t *testing.T) {
+	langs, err := LoadLanguages("../config/languages.example.json")
+	if err != nil {
+		t.Fatalf("LoadLanguages returned error: %v", err)
+	}
+	ruby, ok := langs["ruby"]
+	if !ok || ruby.Display != "Ruby" || ruby.Linter == nil {
+		t.Errorf("LoadLanguages returned %+v, want a Ruby language", langs)
+	}
+}
+
+func TestLoadLanguagesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want string // Substring of the error message.
+	}{
+		{
+			name: "invalid json",
+			json: `{"languages": `,
+			want: "unexpected end of JSON input",
+		},
+		{
+			name: "missing extension",
+			json: `{"languages": {"x": {"display": "X", "linters": [{"command": ["x"], "regex": "(?P<message>.*)"}]}}}`,
+			want: "display and extension are mandatory",
+		},
+		{
+			name: "no tools",
+			json: `{"languages": {"x": {"display": "X", "extension": "x"}}}`,
+			want: "at least one formatter or linter",
+		},
+		{
+			name: "missing command",
+			json: `{"languages": {"x": {"display": "X", "extension": "x", "formatter": {}}}}`,
+			want: "formatter: command is mandatory",
+		},
+		{
+			name: "invalid regex",
+			json: `{"languages": {"x": {"display": "X", "extension": "x", "linters": [{"command": ["x"], "regex": "("}]}}}`,
+			want: "linter 0: error parsing regexp",
+		},
+		{
+			name: "no message group",
+			json: `{"languages": {"x": {"display": "X", "extension": "x", "linters": [{"command": ["x"], "regex": "(?P<line>[0-9]+)"}]}}}`,
+			want: `named group called "message"`,
+		},
+		{
+			name: "unknown group",
+			json: `{"languages": {"x": {"display": "X", "extension": "x", "linters": [{"command": ["x"], "regex": "(?P<file>.*): (?P<message>.*)"}]}}}`,
+			want: `unknown named group in regex: "file"`,
+		},
+		{
+			name: "invalid ignore regex",
+			json: `{"languages": {"x": {"display": "X", "extension": "x", "formatter": {"command": ["x"], "ignore": "["}}}}`,
+			want: "error parsing regexp",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fname := filepath.Join(t.TempDir(), "languages.json")
+			if err := os.WriteFile(fname, []byte(tt.json), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadLanguages(fname)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadLanguages returned error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolConfigLint(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		code   int
+		want   []Diagnostic
+		wantOK bool
+	}{
+		{
+			name:   "no problems",
+			wantOK: true,
+		},
+		{
+			name:   "problems",
+			output: "prog.x:3:5: W: Style/Foo: bad style\\nignored line\\n  context\\n",
+			code:   1,
+			want: []Diagnostic{{
+				Tool:     "xlint",
+				Line:     3,
+				Column:   5,
+				Severity: "W",
+				RuleID:   "Style/Foo",
+				Message:  "bad style",
+				Context:  []string{"  context"},
+			}},
+		},
+		{
+			name:   "default severity",
+			output: "prog.x:1:1: : Rule/X: message\\n",
+			want:   []Diagnostic{{Tool: "xlint", Line: 1, Column: 1, Severity: "warning", RuleID: "Rule/X", Message: "message"}},
+			wantOK: true,
+		},
+		{
+			name: "failure without output",
+			code: 1,
+			want: []Diagnostic{{Tool: "xlint", Severity: "error", Message: "xlint reported problems (exit code 1)"}},
+		},
+		{
+			name:   "unexpected exit code",
+			output: "crashed\\n",
+			code:   2,
+			want:   []Diagnostic{{Tool: "xlint", Severity: "error", Message: "Error running xlint: exit status 2", Context: []string{"crashed"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool := &ToolConfig{
+				Name:     "xlint",
+				Command:  []string{"sh", "-c", "printf '" + tt.output + "'; exit " + strconv.Itoa(tt.code)},
+				Regex:    `^[^:]+:(?P<line>[0-9]+):(?P<col>[0-9]+): (?P<severity>[A-Z]*): (?P<rule>[^:]+): (?P<message>.*)$`,
+				Ignore:   "^ignored",
+				Severity: "warning",
+				limits:   &DefaultLimits,
+			}
+			if err := tool.compile(true); err != nil {
+				t.Fatalf("compile returned error: %v", err)
+			}
+			got, ok := tool.lint(context.Background(), t.TempDir(), strings.NewReplacer())
+			if !reflect.DeepEqual(got, tt.want) || ok != tt.wantOK {
+				t.Errorf("lint = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -5,93 +5,102 @@
 package lang
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"log"
-	"net/http"
 	"os"
 	"regexp"
 	"strings"
-
-	"github.com/osprogramadores/op-web-linter/common"
-	"github.com/osprogramadores/op-web-linter/handlers"
 )
 
 // Regexp matching clang-tidy error lines.
 var clangTidyLineRegex = regexp.MustCompile("^([^:]+):([0-9]+):([0-9]+):[ ]*(.*)")
 
+// Regexp matching the message part of clang-tidy lines (severity, message and check).
+var clangTidyMessageRegex = regexp.MustCompile(`^(fatal error|error|warning|note):[ ]*(.*?)(?:[ ]+\[([^ \]]+)\])?$`)
+
 // Regexp matching clang-tidy cruft lines (to be removed).
 var clangTidyCruftRegex = regexp.MustCompile(`^(\d+ warnings generated|Suppressed \d+ warnings|Use -header-filter)`)
 
-// LintCPP lints programs written in C++. For now, only reformats code with indent.
-func LintCPP(w http.ResponseWriter, r *http.Request, req handlers.LintRequest) {
-	var clangChecks = []string{
-		"readability*",
-		"clang-analyzer-*",
-		"concurrency-*",
-		"cppcoreguidelines-*",
-		"google-*",
-		"-readability-identifier-length",
-		"-readability-magic-numbers",
-		"-cppcoreguidelines-avoid-magic-numbers",
+// Resource limits for the C++ tools.
+var cppLimits = DefaultLimits
+
+// FingerprintCPP identifies the versions of the C++ tools, for caching.
+var FingerprintCPP = FingerprintC
+
+// LintCPP lints programs written in C++ using clang-format and clang-tidy
+// (which also applies its fix-its, if requested). Multi-file requests are
+// linted by lintClangFiles.
+func LintCPP(ctx context.Context, req LintRequest) (LintResponse, error) {
+	if len(req.Files) > 0 {
+		return lintClangFiles(ctx, req, clangCPP)
 	}
 
 	// Save program text in request to file.
-	tempdir, tempfile, err := saveRequestToFile(req.Text, "*.cpp")
+	tempdir, tempfile, err := saveRequestToFile(ctx, req.Text, "*.cpp")
 	if err != nil {
-		common.HTTPError(w, err.Error(), http.StatusInternalServerError)
-		return
+		return LintResponse{}, err
 	}
 	defer os.RemoveAll(tempdir)
 
-	var messages []string
+	var diags []Diagnostic
 
 	// Reformat source code using clang-format. In case of errors, we move ahead
 	// with the old code and attempt linting anyway.
-	reformatted, err := Execute("clang-format", "--assume-filename=cpp",
-		"--style={BasedOnStyle: google, IndentWidth: 4}", tempfile)
+	reformatted, err := Execute(ctx, tempdir, cppLimits, "clang-format", "clang-format", "--assume-filename=cpp",
+		"--style="+clangFormatStyle, tempfile)
 	if err != nil {
-		messages = append(messages, fmt.Sprintf("Error reformatting C++ code: %v", err))
-		messages = append(messages, strings.Split(reformatted, "\n")...)
+		diags = append(diags, formatterDiagnostics("clang-format", fmt.Sprintf("Error reformatting C++ code: %v", err), err, reformatted)...)
 	} else {
 		// Rewrite reformatted program to tempfile.
 		if err := os.WriteFile(tempfile, []byte(reformatted), 0644); err != nil {
-			common.HTTPError(w, err.Error(), http.StatusInternalServerError)
-			return
+			return LintResponse{}, err
 		}
 	}
 	reformatErr := err
 
+	// Apply the clang-tidy fix-its, if requested. Fixed code is reformatted
+	// with the same style and linted below.
+	var fix fixResult
+	if req.Fix {
+		fix, err = runFixer(ctx, "clang-tidy", tempdir, tempfile, cppLimits, "clang-tidy", "--checks="+strings.Join(clangChecks, ","),
+			"--fix", "--format-style="+clangFormatStyle, tempfile, "--", "--std=c++14")
+		if err != nil {
+			return LintResponse{}, err
+		}
+		diags = append(diags, fix.diags...)
+	}
+
 	// clang-tidy returns an error code (1) on errors, but nothing on warnings.
-	// We want to indicate every situation, so we ignore it here and look for
-	// the output. Blank output means no errors.
-	out, _ := Execute("clang-tidy", "--checks="+strings.Join(clangChecks, ","), tempfile, "--", "--std=c++14")
-	lines := cppFilterOutput(strings.Split(out, "\n"), tempfile)
-	messages = append(messages, common.SlicePrefix(lines, "clang-tidy")...)
+	// We want to indicate every situation, so we ignore it here (unless a
+	// resource limit was exceeded) and look for the output. Blank output
+	// means no errors.
+	out, err := Execute(ctx, tempdir, cppLimits, "clang-tidy", "clang-tidy", "--checks="+strings.Join(clangChecks, ","), tempfile, "--", "--std=c++14")
+	diags = append(diags, cppFilterOutput(strings.Split(out, "\n"), "")...)
+	diags = append(diags, limitDiagnostics("clang-tidy", err)...)
 
 	// Pass if no messages from the reformatter or linter.
-	pass := len(messages) == 0
+	pass := len(diags) == 0
 
-	// Create response, convert to JSON and return.
-	resp := handlers.LintResponse{
+	// Create and return response.
+	return LintResponse{
 		Pass:            pass,
-		ErrorMessages:   messages,
+		ErrorMessages:   ErrorMessages(diags),
+		Diagnostics:     setSource(diags, textSource(reformatErr == nil, fix.fixed())),
 		Reformatted:     reformatted != req.Text && reformatErr == nil,
 		ReformattedText: reformatted,
-	}
-	jresp, err := json.Marshal(resp)
-	if err != nil {
-		common.HTTPError(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	log.Printf("JSON response:\n%s", prettyJSONString(jresp))
-	w.Write(jresp)
-	w.Write([]byte("\n"))
+		Formatter:       "clang-format",
+		Fixed:           fix.fixed(),
+		FixedText:       fix.text,
+		Fixes:           fix.edits,
+	}, nil
 }
 
-// cppFilterOutput remove undesirable messages from the clang-tidy output.
-func cppFilterOutput(list []string, tempfile string) []string {
-	var ret []string
+// cppFilterOutput remove undesirable messages from the clang-tidy output and
+// converts the remaining lines into diagnostics. For multi-file requests
+// (tempdir not empty), diagnostics are tagged with the path of their files
+// relative to tempdir.
+func cppFilterOutput(list []string, tempdir string) []Diagnostic {
+	var ret []Diagnostic
 	for i, v := range list {
 		// Don't emit last empty line.
 		if i == len(list)-1 && v == "" {
@@ -107,11 +116,26 @@ func cppFilterOutput(list []string, tempfile string) []string {
 		r := clangTidyLineRegex.FindStringSubmatch(v)
 
 		// Unable to parse line. Include literally.
-		if len(r) < 4 {
-			ret = append(ret, v)
+		if len(r) < 5 {
+			ret = appendUnparsed(ret, "clang-tidy", v)
 			continue
 		}
-		ret = append(ret, fmt.Sprintf("Line %s Col %s: %s", r[2], r[3], r[4]))
+		d := Diagnostic{
+			Tool:    "clang-tidy",
+			Line:    atoi(r[2]),
+			Column:  atoi(r[3]),
+			Message: r[4],
+		}
+		if tempdir != "" {
+			d.File = relativePath(tempdir, r[1])
+		}
+		// Split "severity: message [check]", if possible.
+		if m := clangTidyMessageRegex.FindStringSubmatch(r[4]); m != nil {
+			d.Severity = m[1]
+			d.Message = m[2]
+			d.RuleID = m[3]
+		}
+		ret = append(ret, d)
 	}
 	return ret
 }
@@ -0,0 +1,90 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCppFilterOutput(t *testing.T) {
+	tempfile := "/tmp/lint123/prog456.cpp"
+	out := strings.Join([]string{
+		"2 warnings generated.",
+		tempfile + ":3:5: warning: variable 'x' is not initialized [cppcoreguidelines-init-variables]",
+		"    int x;",
+		"        ^",
+		tempfile + ":7:1: error: unknown type name 'foo' [clang-diagnostic-error]",
+		tempfile + ":9:2: note: this is a note",
+		"Suppressed 10 warnings (10 in non-user code).",
+		"Use -header-filter=.* to display errors from all non-system headers.",
+		"",
+	}, "\n")
+
+	want := []Diagnostic{
+		{
+			Tool:     "clang-tidy",
+			Line:     3,
+			Column:   5,
+			Severity: "warning",
+			Message:  "variable 'x' is not initialized",
+			RuleID:   "cppcoreguidelines-init-variables",
+			Context:  []string{"    int x;", "        ^"},
+		},
+		{Tool: "clang-tidy", Line: 7, Column: 1, Severity: "error", Message: "unknown type name 'foo'", RuleID: "clang-diagnostic-error"},
+		{Tool: "clang-tidy", Line: 9, Column: 2, Severity: "note", Message: "this is a note"},
+	}
+	if got := cppFilterOutput(strings.Split(out, "\n"), ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("cppFilterOutput =\n%+v\nwant:\n%+v", got, want)
+	}
+
+	// Multi-file requests have the paths relative to the temporary directory.
+	for i := range want {
+		want[i].File = "prog456.cpp"
+	}
+	if got := cppFilterOutput(strings.Split(out, "\n"), "/tmp/lint123"); !reflect.DeepEqual(got, want) {
+		t.Errorf("cppFilterOutput with tempdir =\n%+v\nwant:\n%+v", got, want)
+	}
+}
+
+func TestToolDiagnostics(t *testing.T) {
+	got := toolDiagnostics("clang-format", "Error reformatting", nil, "line 1\n\n  \nline 2\n")
+	want := []Diagnostic{{
+		Tool:     "clang-format",
+		Severity: "error",
+		Message:  "Error reformatting",
+		Context:  []string{"line 1", "line 2"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("toolDiagnostics = %+v, want %+v", got, want)
+	}
+
+	// Limits set the rule ID.
+	got = toolDiagnostics("clang-format", "Error reformatting", &TimeoutError{Timeout: time.Second}, "")
+	want = []Diagnostic{{
+		Tool:     "clang-format",
+		Severity: "error",
+		RuleID:   RuleTimeout,
+		Message:  "Error reformatting",
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("toolDiagnostics with timeout = %+v, want %+v", got, want)
+	}
+
+	// So do failures that look like exceeding a limit from the output.
+	got = toolDiagnostics("clang-format", "Error reformatting", exec.Command("false").Run(), "Cannot allocate memory\n")
+	want = []Diagnostic{{
+		Tool:     "clang-format",
+		Severity: "error",
+		RuleID:   RuleResourceLimit,
+		Message:  "Error reformatting (memory limit exceeded?)",
+		Context:  []string{"Cannot allocate memory"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("toolDiagnostics with memory message = %+v, want %+v", got, want)
+	}
+}
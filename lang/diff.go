@@ -0,0 +1,324 @@
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// Number of unchanged lines shown around each change in diffs.
+	diffContext = 3
+
+	// Maximum number of edits computed by diffLines. Texts with more
+	// differences are shown as a full replacement.
+	maxDiffEdits = 1000
+)
+
+// Hunk is a group of nearby changes between two texts, as shown in unified
+// diffs. Start lines and line counts follow the unified diff header (when
+// a side has no lines, its start is the line just before the change).
+type Hunk struct {
+	OldStart int      // First line in the original text.
+	OldLines int      // Number of lines from the original text.
+	NewStart int      // First line in the new text.
+	NewLines int      // Number of lines from the new text.
+	Lines    []string // Lines prefixed with ' ' (unchanged), '-' (removed) or '+' (added).
+}
+
+// diffOp is one line in the edit script between two texts.
+type diffOp struct {
+	kind byte // ' ' (equal), '-' (delete) or '+' (insert).
+	old  int  // Index of the line in the old text (valid for ' ' and '-').
+	new  int  // Index of the line in the new text (valid for ' ' and '+').
+}
+
+// Diff returns a unified diff between the texts, and the same changes as a
+// list of hunks. Both are empty if the texts are equal.
+func Diff(oldName, newName, oldText, newText string) (string, []Hunk) {
+	a, b := splitLines(oldText), splitLines(newText)
+	hunks := diffHunks(a, b, diffLines(a, b))
+	if len(hunks) == 0 {
+		return "", nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	for i := range hunks {
+		h := &hunks[i]
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+		for _, line := range h.Lines {
+			sb.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		// Hunk lines are returned without line terminators.
+		for j, line := range h.Lines {
+			h.Lines[j] = strings.TrimSuffix(line, "\n")
+		}
+	}
+	return sb.String(), hunks
+}
+
+// hunkRange formats the start and length of one side of a hunk header. The
+// length is omitted when it is one.
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// splitLines splits text into lines, keeping the line terminators. The last
+// line has no terminator if the text doesn't end with a newline.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the edit script transforming a into b, using the Myers
+// algorithm after trimming the common prefix and suffix. If there are more
+// than maxDiffEdits differences, the middle part is deleted and inserted as
+// a whole.
+func diffLines(a, b []string) []diffOp {
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, diffOp{' ', i, i})
+	}
+	for _, op := range myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		op.old += prefix
+		op.new += prefix
+		ops = append(ops, op)
+	}
+	for i := suffix; i > 0; i-- {
+		ops = append(ops, diffOp{' ', len(a) - i, len(b) - i})
+	}
+	return ops
+}
+
+// myers returns the shortest edit script transforming a into b, or a full
+// replacement if it needs more than maxDiffEdits edits.
+func myers(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > maxDiffEdits {
+		max = maxDiffEdits
+	}
+
+	// v[k+off] holds the furthest x reached in diagonal k. trace[d] holds
+	// v (for diagonals -d..d) before step d, to find the path back.
+	off := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1+off] < v[k+1+off]) {
+				x = v[k+1+off] // Move down (insertion).
+			} else {
+				x = v[k-1+off] + 1 // Move right (deletion).
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+off] = x
+			if x >= n && y >= m {
+				return myersPath(trace, n, m)
+			}
+		}
+	}
+
+	// Too many differences: replace everything.
+	var ops []diffOp
+	for i := range a {
+		ops = append(ops, diffOp{'-', i, 0})
+	}
+	for i := range b {
+		ops = append(ops, diffOp{'+', 0, i})
+	}
+	return ops
+}
+
+// myersPath walks back the trace of the Myers algorithm from the end of both
+// texts, returning the edit script in order.
+func myersPath(trace [][]int, n, m int) []diffOp {
+	var rev []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d] // Diagonal k is at v[k+d].
+		k := x - y
+
+		prevK := k - 1
+		if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+			prevK = k + 1
+		}
+		prevX := v[prevK+d]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			rev = append(rev, diffOp{' ', x, y})
+		}
+		if prevK == k+1 {
+			y--
+			rev = append(rev, diffOp{'+', x, y})
+		} else {
+			x--
+			rev = append(rev, diffOp{'-', x, y})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		rev = append(rev, diffOp{' ', x, y})
+	}
+
+	ops := make([]diffOp, len(rev))
+	for i, op := range rev {
+		ops[len(rev)-1-i] = op
+	}
+	return ops
+}
+
+// lineMap returns the line number in the old text (starting at 1) for each
+// line in the new text. Lines changed in the new text are mapped to the first
+// line removed by the same change, and added lines to the line before them.
+func lineMap(oldText, newText string) []int {
+	a, b := splitLines(oldText), splitLines(newText)
+	ops := diffLines(a, b)
+
+	ret := make([]int, len(b))
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			ret[ops[i].new] = ops[i].old + 1
+			i++
+			continue
+		}
+		// Change: removed and added lines up to the next unchanged line.
+		j := i
+		line := -1
+		for ; j < len(ops) && ops[j].kind != ' '; j++ {
+			if line < 0 && ops[j].kind == '-' {
+				line = ops[j].old + 1
+			}
+		}
+		for ; i < j; i++ {
+			if ops[i].kind != '+' {
+				continue
+			}
+			switch {
+			case line > 0:
+				ret[ops[i].new] = line
+			case ops[i].old > 0:
+				ret[ops[i].new] = ops[i].old
+			default:
+				ret[ops[i].new] = 1
+			}
+		}
+	}
+	return ret
+}
+
+// diffHunks groups the edit script into hunks with diffContext lines of
+// context. Lines keep their terminators.
+func diffHunks(a, b []string, ops []diffOp) []Hunk {
+	var hunks []Hunk
+	for i := 0; i < len(ops); {
+		// Find the next change.
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		// Extend the hunk while changes are separated by at most
+		// 2*diffContext unchanged lines.
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContext {
+				break
+			}
+			end = next
+		}
+		stop := end + diffContext
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		var h Hunk
+		oldStart, newStart := -1, -1
+		for _, op := range ops[start:stop] {
+			switch op.kind {
+			case ' ':
+				h.Lines = append(h.Lines, " "+a[op.old])
+				h.OldLines++
+				h.NewLines++
+			case '-':
+				h.Lines = append(h.Lines, "-"+a[op.old])
+				h.OldLines++
+			case '+':
+				h.Lines = append(h.Lines, "+"+b[op.new])
+				h.NewLines++
+			}
+			if oldStart < 0 && op.kind != '+' {
+				oldStart = op.old
+			}
+			if newStart < 0 && op.kind != '-' {
+				newStart = op.new
+			}
+		}
+		h.OldStart = hunkStart(oldStart, h.OldLines, ops[start:stop], true)
+		h.NewStart = hunkStart(newStart, h.NewLines, ops[start:stop], false)
+		hunks = append(hunks, h)
+		i = stop
+	}
+	return hunks
+}
+
+// hunkStart returns the 1-based start line of one side of a hunk, given the
+// 0-based index of its first line. Sides without lines start at the line
+// just before the change, as in unified diffs.
+func hunkStart(first, lines int, ops []diffOp, old bool) int {
+	if lines > 0 {
+		return first + 1
+	}
+	// No lines on this side: the position is given by the ops of the
+	// other kind, which carry the index where this side is.
+	if old {
+		return ops[0].old
+	}
+	return ops[0].new
+}
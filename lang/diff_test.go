@@ -0,0 +1,281 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{
+			name: "equal",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name: "both empty",
+			want: "",
+		},
+		{
+			name: "changed line",
+			old:  "a\nb\nc\n",
+			new:  "a\nB\nc\n",
+			want: "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name: "old empty",
+			new:  "a\nb\n",
+			want: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "new empty",
+			old:  "a\nb\n",
+			want: "--- old\n+++ new\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "single line",
+			old:  "a\n",
+			new:  "b\n",
+			want: "--- old\n+++ new\n@@ -1 +1 @@\n-a\n+b\n",
+		},
+		{
+			name: "no trailing newline",
+			old:  "a\nb",
+			new:  "a\nc",
+			want: "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+		{
+			name: "trailing newline added",
+			old:  "a",
+			new:  "a\n",
+			want: "--- old\n+++ new\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+a\n",
+		},
+		{
+			name: "separate hunks",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			new:  "0\n2\n3\n4\n5\n6\n7\n8\n9\n11\n",
+			want: "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+0\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+11\n",
+		},
+		{
+			name: "merged hunks",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n",
+			new:  "0\n2\n3\n4\n5\n6\n7\n9\n",
+			want: "--- old\n+++ new\n@@ -1,8 +1,8 @@\n-1\n+0\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+9\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, hunks := Diff("old", "new", tt.old, tt.new)
+			if got != tt.want {
+				t.Errorf("Diff(%q, %q) =\n%s\nwant:\n%s", tt.old, tt.new, got, tt.want)
+			}
+			if (got == "") != (hunks == nil) {
+				t.Errorf("Diff(%q, %q) returned diff %q with hunks %v", tt.old, tt.new, got, hunks)
+			}
+		})
+	}
+}
+
+func TestDiffHunks(t *testing.T) {
+	_, hunks := Diff("old", "new", "a\nb\nc\n", "a\nc\nd\n")
+	want := []Hunk{{
+		OldStart: 1,
+		OldLines: 3,
+		NewStart: 1,
+		NewLines: 3,
+		Lines:    []string{" a", "-b", " c", "+d"},
+	}}
+	if !reflect.DeepEqual(hunks, want) {
+		t.Errorf("Diff hunks = %+v, want %+v", hunks, want)
+	}
+}
+
+// TestDiffLines checks that the edit scripts transform the old text into the
+// new one, and that they are minimal for small texts.
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		old, new string
+		edits    int
+	}{
+		{"", "", 0},
+		{"a\n", "", 1},
+		{"", "a\n", 1},
+		{"a\nb\nc\n", "a\nb\nc\n", 0},
+		{"a\nb\nc\na\nb\nb\na\n", "c\nb\na\nb\na\nc\n", 5},
+		{"x\na\ny\n", "a\nx\ny\n", 2},
+		{"a\nb", "a\nb\n", 2},
+	}
+	for _, tt := range tests {
+		a, b := splitLines(tt.old), splitLines(tt.new)
+		ops := diffLines(a, b)
+		if got := applyOps(a, b, ops); got != tt.new {
+			t.Errorf("diffLines(%q, %q) produces %q", tt.old, tt.new, got)
+		}
+		if got := countEdits(ops); got != tt.edits {
+			t.Errorf("diffLines(%q, %q) has %d edits, want %d", tt.old, tt.new, got, tt.edits)
+		}
+	}
+}
+
+// TestDiffLinesMaxEdits checks that texts with more than maxDiffEdits
+// differences are replaced as a whole, except for the common prefix and
+// suffix.
+func TestDiffLinesMaxEdits(t *testing.T) {
+	var old, new []string
+	old = append(old, "first\n")
+	new = append(new, "first\n")
+	for i := 0; i < maxDiffEdits; i++ {
+		old = append(old, fmt.Sprintf("old %d\n", i), "same\n")
+		new = append(new, fmt.Sprintf("new %d\n", i), "same\n")
+	}
+	old = append(old, "last\n")
+	new = append(new, "last\n")
+
+	ops := diffLines(old, new)
+	if got := applyOps(old, new, ops); got != strings.Join(new, "") {
+		t.Fatalf("diffLines with too many edits doesn't produce the new text")
+	}
+	if got, want := countEdits(ops), 2*(len(old)-3); got != want {
+		t.Errorf("diffLines with too many edits has %d edits, want %d (full replacement)", got, want)
+	}
+
+	_, hunks := Diff("old", "new", strings.Join(old, ""), strings.Join(new, ""))
+	if len(hunks) != 1 || hunks[0].OldStart != 1 || hunks[0].OldLines != len(old) || hunks[0].NewLines != len(new) {
+		t.Errorf("Diff with too many edits returned %d hunks, want a single one for the whole texts", len(hunks))
+	}
+}
+
+// applyOps returns the text produced by an edit script from a into b,
+// checking the line indices.
+func applyOps(a, b []string, ops []diffOp) string {
+	var sb strings.Builder
+	x, y := 0, 0
+	for _, op := range ops {
+		switch op.kind {
+		case ' ':
+			if op.old != x || op.new != y || a[x] != b[y] {
+				return fmt.Sprintf("invalid equal op %+v at %d,%d", op, x, y)
+			}
+			sb.WriteString(a[x])
+			x++
+			y++
+		case '-':
+			if op.old != x {
+				return fmt.Sprintf("invalid delete op %+v at %d,%d", op, x, y)
+			}
+			x++
+		case '+':
+			if op.new != y {
+				return fmt.Sprintf("invalid insert op %+v at %d,%d", op, x, y)
+			}
+			sb.WriteString(b[y])
+			y++
+		}
+	}
+	if x != len(a) || y != len(b) {
+		return fmt.Sprintf("incomplete edit script (stopped at %d,%d)", x, y)
+	}
+	return sb.String()
+}
+
+// countEdits returns the number of deletions and insertions in an edit
+// script.
+func countEdits(ops []diffOp) int {
+	n := 0
+	for _, op := range ops {
+		if op.kind != ' ' {
+			n++
+		}
+	}
+	return n
+}
+
+func TestLineMap(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     []int
+	}{
+		{"equal", "a\nb\nc\n", "a\nb\nc\n", []int{1, 2, 3}},
+		{"changed line", "a\nb\nc\n", "a\nB\nc\n", []int{1, 2, 3}},
+		{"split line", "a\nb c\nd\n", "a\nb\nc\nd\n", []int{1, 2, 2, 3}},
+		{"joined lines", "a\nb\nc\nd\n", "a\nb c\nd\n", []int{1, 2, 4}},
+		{"deleted line", "a\nb\nc\n", "a\nc\n", []int{1, 3}},
+		{"inserted at the top", "a\nb\n", "x\na\nb\n", []int{1, 1, 2}},
+		{"appended", "a\nb\n", "a\nb\nc\n", []int{1, 2, 2}},
+		{"old empty", "", "a\nb\n", []int{1, 1}},
+		{"new empty", "a\nb\n", "", []int{}},
+		{"no trailing newline", "a\nb", "a\nb\n", []int{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lineMap(tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lineMap(%q, %q) = %v, want %v", tt.old, tt.new, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLineMapMaxEdits checks that lines replaced as a whole (for having
+// more than maxDiffEdits differences) map to the first replaced line.
+func TestLineMapMaxEdits(t *testing.T) {
+	var old, new strings.Builder
+	old.WriteString("first\n")
+	new.WriteString("first\n")
+	for i := 0; i < maxDiffEdits; i++ {
+		fmt.Fprintf(&old, "old %d\nsame\n", i)
+		fmt.Fprintf(&new, "new %d\nsame\n", i)
+	}
+
+	got := lineMap(old.String(), new.String())
+	if len(got) != 2*maxDiffEdits+1 {
+		t.Fatalf("lineMap returned %d lines, want %d", len(got), 2*maxDiffEdits+1)
+	}
+	if got[0] != 1 {
+		t.Errorf("lineMap maps the first (unchanged) line to %d, want 1", got[0])
+	}
+	for i, line := range got[1 : len(got)-1] {
+		if line != 2 {
+			t.Fatalf("lineMap maps replaced line %d to %d, want 2", i+2, line)
+		}
+	}
+	if last := got[len(got)-1]; last != 2*maxDiffEdits+1 {
+		t.Errorf("lineMap maps the last (unchanged) line to %d, want %d", last, 2*maxDiffEdits+1)
+	}
+}
+
+func TestHunkStart(t *testing.T) {
+	// Lines 3 and 4 of the old text deleted, after line 2 of the new text.
+	deleted := []diffOp{{'-', 2, 2}, {'-', 3, 2}}
+	// Line 3 of the new text inserted, after line 5 of the old text.
+	inserted := []diffOp{{'+', 5, 2}}
+
+	tests := []struct {
+		name         string
+		first, lines int
+		ops          []diffOp
+		old          bool
+		want         int
+	}{
+		{"old side of deletion", 2, 2, deleted, true, 3},
+		{"new side of deletion", -1, 0, deleted, false, 2},
+		{"old side of insertion", -1, 0, inserted, true, 5},
+		{"new side of insertion", 2, 1, inserted, false, 3},
+		{"empty old text", -1, 0, []diffOp{{'+', 0, 0}}, true, 0},
+	}
+	for _, tt := range tests {
+		if got := hunkStart(tt.first, tt.lines, tt.ops, tt.old); got != tt.want {
+			t.Errorf("%s: hunkStart(%d, %d, %v, %v) = %d, want %d", tt.name, tt.first, tt.lines, tt.ops, tt.old, got, tt.want)
+		}
+	}
+}
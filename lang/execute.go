@@ -6,35 +6,160 @@ package lang
 
 import (
 	"context"
-	"log"
+	"io"
+	"os"
 	"os/exec"
 	"strings"
 	"syscall"
 	"time"
+
+	"github.com/osprogramadores/op-web-linter/common"
+	"github.com/osprogramadores/op-web-linter/metrics"
 )
 
 const (
 	execTimeout = time.Duration(15 * time.Second)
+
+	// Time to wait for the output pipes to close after the program exits.
+	waitDelay = time.Duration(2 * time.Second)
 )
 
 // Execute runs the program specified by name with the command-line specified
-// in slice args. Returns the error code and a string containing the program's
-// combined output (stdout/stderr).
-func Execute(name string, args ...string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+// in slice args, on behalf of the given tool (the logical name also used in
+// the diagnostics and to label the execution metrics), using dir as the working directory. Unless disabled, the
+// program runs inside a sandbox where only dir and the paths in
+// Sandbox.Writable are writable (and the paths in Sandbox.Overlay, through
+// an overlay discarded when the program exits). The program is subject to the resource
+// limits passed in limits. Returns the error code and a string containing
+// the program's combined output (stdout/stderr). Exceeding a limit returns
+// a *LimitError, and exceeding the execution timeout returns a
+// *TimeoutError. The program and all its children are killed when ctx is
+// cancelled.
+func Execute(ctx context.Context, dir string, limits Limits, tool, name string, args ...string) (string, error) {
+	out := &limitedBuffer{max: limits.Output}
+	_, err := execute(ctx, dir, execOptions{
+		tool:     tool,
+		limits:   limits,
+		timeout:  execTimeout,
+		stdout:   out,
+		stderr:   out,
+		writable: Sandbox.Writable,
+		overlay:  Sandbox.Overlay,
+	}, name, args...)
+	return string(out.buf), err
+}
+
+// execOptions holds the options for execute.
+type execOptions struct {
+	tool     string         // Logical tool name, used to label the metrics.
+	limits   Limits         // Resource limits.
+	timeout  time.Duration  // Maximum wall time.
+	stdin    io.Reader      // Standard input (no input if nil).
+	stdout   *limitedBuffer // Standard output.
+	stderr   *limitedBuffer // Standard error (may be the same as stdout).
+	writable []string       // Paths kept writable inside the sandbox, besides the working directory.
+	overlay  []string       // Paths writable inside the sandbox through an overlay discarded after the execution.
+	hidden   []string       // Paths replaced by empty directories inside the sandbox.
+	program  bool           // Running a program submitted for Run (see checkProgramLimits)?
+}
+
+// execute runs a program like Execute, with the given options. Returns the
+// peak resident memory of the program in bytes, or zero if unknown.
+func execute(ctx context.Context, dir string, opts execOptions, name string, args ...string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
 	defer cancel()
 
-	log.Printf("Executing %s %s", name, strings.Join(args, " "))
+	logger := common.Logger(ctx)
+	logger.Info("Executing", "tool", opts.tool, "command", name, "args", strings.Join(args, " "), "sandbox", Sandbox.Enabled)
 
-	cmd := exec.CommandContext(ctx, name, args...)
-	out, err := cmd.CombinedOutput()
+	spec := helperSpec{
+		Writable: append([]string{dir}, opts.writable...),
+		Hidden:   opts.hidden,
+		Limits:   opts.limits,
+	}
+	if Sandbox.Enabled && len(opts.overlay) > 0 {
+		overlayDir, err := os.MkdirTemp("", "overlay")
+		if err != nil {
+			return 0, err
+		}
+		defer os.RemoveAll(overlayDir)
+		spec.Overlay, spec.OverlayDir = opts.overlay, overlayDir
+	}
+	cmd, err := command(ctx, dir, spec, name, args...)
+	if err != nil {
+		return 0, err
+	}
+	// Kill the whole process group on cancellation, not only the direct
+	// child. Don't wait forever for processes that escaped the group and
+	// hold the output pipes open.
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+	cmd.WaitDelay = waitDelay
 
-	ret := string(out)
+	// Inside the sandbox, the helper reports the signal that killed the
+	// tool and its peak memory through a pipe.
+	var status *os.File
+	if Sandbox.Enabled {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return 0, err
+		}
+		defer r.Close()
+		cmd.ExtraFiles = []*os.File{w}
+		status = r
+	}
+
+	// Kill the program (through the context) if it exceeds the output limit.
+	stdout, stderr := opts.stdout, opts.stderr
+	stdout.onLimit, stderr.onLimit = cancel, cancel
+	cmd.Stdin = opts.stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	start := time.Now()
+	err = cmd.Run()
+	metrics.ExecuteDuration.Observe(time.Since(start).Seconds(), opts.tool)
+	ret := string(stderr.buf)
+	if stdout != stderr {
+		ret = string(stdout.buf) + ret
+	}
+	truncated := stdout.truncated || stderr.truncated
+	// Outside the sandbox, the peak memory of the process includes the
+	// memory of the server at the time it was forked.
+	sig := exitSignal(cmd.ProcessState)
+	var peak int64
+	if cmd.ProcessState != nil {
+		peak = peakMemory(cmd.ProcessState)
+	}
+	if status != nil {
+		cmd.ExtraFiles[0].Close()
+		if s, p, ok := toolStatus(status); ok {
+			sig, peak = s, p
+		}
+	}
+	if opts.program {
+		err = checkProgramLimits(opts.limits, cmd.ProcessState, peak, sig, err, truncated)
+	} else {
+		err = checkLimits(opts.limits, cmd.ProcessState, peak, sig, err, truncated)
+	}
+
+	// Report timeouts and cancellations (E.g. client went away) clearly,
+	// instead of the exit error from the killed program.
+	if !truncated {
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			err = &TimeoutError{Timeout: opts.timeout}
+			metrics.Timeouts.Inc(opts.tool)
+		case context.Canceled:
+			err = context.Canceled
+		}
+	}
 
-	log.Printf("Command returned error code: %v", err)
-	log.Printf("Command output:")
-	log.Println(ret)
-	return ret, err
+	logger.Info("Command returned", "tool", opts.tool, "error", err, "duration", time.Since(start))
+	logger.Debug("Command output", "tool", opts.tool, common.Redact("output", ret))
+	return peak, err
 }
 
 // Exitcode fetches the numeric return code from the return of exec.Run.
@@ -0,0 +1,192 @@
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/osprogramadores/op-web-linter/common"
+)
+
+// Limits for multi-file requests.
+const (
+	MaxFiles     = 200     // Maximum number of files.
+	MaxFilesSize = 5 << 20 // Maximum size of all files together, in bytes.
+)
+
+// ErrInvalidFiles is returned for multi-file requests with invalid paths or
+// exceeding the limits.
+var ErrInvalidFiles = errors.New("invalid files")
+
+// errTooManyFiles is returned for multi-file requests with too many files.
+var errTooManyFiles = fmt.Errorf("%w: too many files (maximum %d)", ErrInvalidFiles, MaxFiles)
+
+// File is a source file in a multi-file request.
+type File struct {
+	Path string `json:"path"` // Path relative to the program root, with forward slashes (E.g. "src/util.h").
+	Text string `json:"text"` // Text of the file (not escaped).
+}
+
+// FileResponse contains the results for one file in a multi-file request.
+// Fields have the same meaning as in LintResponse.
+type FileResponse struct {
+	Path            string // Path of the file, as in the request.
+	Reformatted     bool   // Was the file reformatted?
+	ReformattedText string // Reformatted file.
+	Diff            string `json:",omitempty"` // Unified diff from the file to ReformattedText.
+	Hunks           []Hunk `json:",omitempty"` // Changes in Diff, one entry per hunk.
+	Fixed           bool   // Were problems fixed automatically?
+	FixedText       string `json:",omitempty"` // File after reformatting and fixing.
+}
+
+// checkFiles returns an error wrapping ErrInvalidFiles if the files in a
+// multi-file request exceed the limits, or have paths that are not clean,
+// relative and inside the program root (E.g. "../etc/passwd"), or where a
+// path is both a file and a directory (E.g. "a" and "a/b").
+func checkFiles(files []File) error {
+	if len(files) > MaxFiles {
+		return errTooManyFiles
+	}
+	size := 0
+	seen := map[string]bool{}
+	for _, f := range files {
+		if err := checkPath(f.Path); err != nil {
+			return err
+		}
+		if seen[f.Path] {
+			return fmt.Errorf("%w: duplicate path %q", ErrInvalidFiles, f.Path)
+		}
+		seen[f.Path] = true
+		size += len(f.Text)
+	}
+	if size > MaxFilesSize {
+		return fmt.Errorf("%w: files larger than %d bytes", ErrInvalidFiles, MaxFilesSize)
+	}
+	for _, f := range files {
+		for dir := path.Dir(f.Path); dir != "."; dir = path.Dir(dir) {
+			if seen[dir] {
+				return fmt.Errorf("%w: path %q is both a file and a directory", ErrInvalidFiles, dir)
+			}
+		}
+	}
+	return nil
+}
+
+// checkPath returns an error wrapping ErrInvalidFiles unless p is a clean
+// relative path, with forward slashes, inside the program root.
+func checkPath(p string) error {
+	if p == "" || strings.ContainsAny(p, "\\\x00") || path.Clean(p) != p || !filepath.IsLocal(filepath.FromSlash(p)) {
+		return fmt.Errorf("%w: invalid path %q", ErrInvalidFiles, p)
+	}
+	return nil
+}
+
+// saveRequestFiles saves the files in a multi-file request into a new
+// temporary directory, keeping their layout. Returns the temporary directory
+// and the names of the saved files, in the same order.
+func saveRequestFiles(ctx context.Context, files []File) (string, []string, error) {
+	tempdir, err := os.MkdirTemp("", "")
+	if err != nil {
+		return "", nil, err
+	}
+	var names []string
+	for _, f := range files {
+		common.Logger(ctx).Debug("Program file", "path", f.Path, common.Redact("text", f.Text))
+
+		fname := filepath.Join(tempdir, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+			os.RemoveAll(tempdir)
+			return "", nil, err
+		}
+		if err := os.WriteFile(fname, []byte(f.Text), 0644); err != nil {
+			os.RemoveAll(tempdir)
+			return "", nil, err
+		}
+		names = append(names, fname)
+	}
+	return tempdir, names, nil
+}
+
+// relativePath returns the path of fname relative to tempdir, with forward
+// slashes, or "" if fname is not inside tempdir (E.g. system headers).
+func relativePath(tempdir, fname string) string {
+	rel, err := filepath.Rel(tempdir, fname)
+	if err != nil || !filepath.IsLocal(rel) {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// lintEachFile lints the files with the language extension in a multi-file
+// request one at a time, for languages without support for multi-file
+// requests. Other files are ignored. Diagnostics and fixes are tagged with
+// the path of their files.
+func lintEachFile(ctx context.Context, language Language, req LintRequest) (LintResponse, error) {
+	resp := LintResponse{Pass: true}
+	for _, f := range req.Files {
+		if path.Ext(f.Path) != "."+language.Extension {
+			continue
+		}
+		r, err := language.Linter.Lint(ctx, LintRequest{Text: f.Text, Lang: req.Lang, Fix: req.Fix})
+		if err != nil {
+			return LintResponse{}, fmt.Errorf("%s: %w", f.Path, err)
+		}
+		for _, d := range r.Diagnostics {
+			d.File = f.Path
+			resp.Diagnostics = append(resp.Diagnostics, d)
+		}
+		for _, e := range r.Fixes {
+			e.File = f.Path
+			resp.Fixes = append(resp.Fixes, e)
+		}
+		resp.Files = append(resp.Files, FileResponse{
+			Path:            f.Path,
+			Reformatted:     r.Reformatted,
+			ReformattedText: r.ReformattedText,
+			Fixed:           r.Fixed,
+			FixedText:       r.FixedText,
+		})
+		resp.Pass = resp.Pass && r.Pass
+		resp.Reformatted = resp.Reformatted || r.Reformatted
+		resp.Fixed = resp.Fixed || r.Fixed
+		if r.Formatter != "" {
+			resp.Formatter = r.Formatter
+		}
+	}
+	if resp.Files == nil {
+		return LintResponse{}, fmt.Errorf("%w: no files with extension .%s", ErrInvalidFiles, language.Extension)
+	}
+	resp.ErrorMessages = ErrorMessages(resp.Diagnostics)
+	return resp, nil
+}
+
+// setFile tags the diagnostics with the path of their file.
+func setFile(diags []Diagnostic, path string) []Diagnostic {
+	for i := range diags {
+		diags[i].File = path
+	}
+	return diags
+}
+
+// uniqueDiagnostics removes repeated diagnostics (E.g. problems in headers
+// included by several files), keeping the first one.
+func uniqueDiagnostics(diags []Diagnostic) []Diagnostic {
+	var ret []Diagnostic
+	seen := map[string]bool{}
+	for _, d := range diags {
+		key := fmt.Sprintf("%s\x00%d\x00%d\x00%s\x00%s", d.File, d.Line, d.Column, d.RuleID, d.Message)
+		if !seen[key] {
+			seen[key] = true
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,128 @@
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// fingerprints holds all the fingerprints returned by fingerprint, to be
+// computed by ComputeFingerprints.
+var (
+	fingerprintsMu sync.Mutex
+	fingerprints   []*toolFingerprint
+)
+
+// toolFingerprint identifies the versions of a set of tools and their
+// configuration files.
+type toolFingerprint struct {
+	cmds  [][]string      // Version commands.
+	files func() []string // Configuration files.
+
+	mu    sync.Mutex
+	value string // Empty until computed, or if a version command failed.
+}
+
+// fingerprint returns a function identifying the versions of a set of tools
+// (by the output of their version commands) and their configuration files.
+// Bare file names are looked up in the PATH. The function returns the value
+// computed by ComputeFingerprints, or "" before that or if any of the version
+// commands failed (so that responses are not cached).
+func fingerprint(cmds [][]string, files func() []string) func() string {
+	f := &toolFingerprint{cmds: cmds, files: files}
+
+	fingerprintsMu.Lock()
+	defer fingerprintsMu.Unlock()
+	fingerprints = append(fingerprints, f)
+	return f.get
+}
+
+// ComputeFingerprints runs the version commands of the tools of all
+// languages (inside the sandbox, if enabled) and examines their
+// configuration files, to identify them for caching. Call it once at
+// startup, after configuring the sandbox and loading additional languages.
+// Returns the errors from the version commands. Responses for languages
+// with failed commands are not cached.
+func ComputeFingerprints(ctx context.Context) error {
+	fingerprintsMu.Lock()
+	fps := fingerprints
+	fingerprintsMu.Unlock()
+
+	// Version commands may be slow (E.g. npx), so run them all at once.
+	var wg sync.WaitGroup
+	errs := make([]error, len(fps))
+	for i, f := range fps {
+		wg.Add(1)
+		go func(i int, f *toolFingerprint) {
+			defer wg.Done()
+			errs[i] = f.compute(ctx)
+		}(i, f)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// get returns the fingerprint.
+func (f *toolFingerprint) get() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.value
+}
+
+// compute runs the version commands and examines the files, saving the
+// resulting fingerprint.
+func (f *toolFingerprint) compute(ctx context.Context) error {
+	tempdir, err := os.MkdirTemp("", "")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempdir)
+
+	h := sha256.New()
+	for _, cmd := range f.cmds {
+		// Some runtimes (E.g. the JVM) fail to start with an address
+		// space limit.
+		out, err := Execute(ctx, tempdir, noMemoryLimit, filepath.Base(cmd[0]), cmd[0], cmd[1:]...)
+		if err != nil {
+			return fmt.Errorf("%s: %v: %s", strings.Join(cmd, " "), err, strings.TrimSpace(out))
+		}
+		fmt.Fprintf(h, "cmd %q: %s\n", cmd, out)
+	}
+	for _, fname := range f.files() {
+		fmt.Fprintf(h, "file %q: %s\n", fname, fileVersion(fname))
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.value = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// fileVersion returns a string identifying the contents of a file (size and
+// modification time).
+func fileVersion(fname string) string {
+	if path, err := exec.LookPath(fname); err == nil {
+		fname = path
+	}
+	fi, err := os.Stat(fname)
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("%d %v", fi.Size(), fi.ModTime().UnixNano())
+}
+
+// noFiles is used by fingerprints with version commands only.
+func noFiles() []string {
+	return nil
+}
@@ -0,0 +1,55 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFingerprint(t *testing.T) {
+	conf := filepath.Join(t.TempDir(), "tool.conf")
+	if err := os.WriteFile(conf, []byte("option = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files := func() []string { return []string{conf} }
+
+	// compute returns the fingerprint of a new set of tools.
+	compute := func(cmds [][]string, files func() []string) (string, error) {
+		f := &toolFingerprint{cmds: cmds, files: files}
+		if got := f.get(); got != "" {
+			t.Errorf("Fingerprint before compute = %s, want empty", got)
+		}
+		err := f.compute(context.Background())
+		return f.get(), err
+	}
+
+	first, err := compute([][]string{{"echo", "tool 1.0"}}, files)
+	if err != nil || first == "" {
+		t.Fatalf("compute returned %q and error %v, want a fingerprint", first, err)
+	}
+	if got, _ := compute([][]string{{"echo", "tool 1.0"}}, files); got != first {
+		t.Errorf("Second compute returned %s, want %s", got, first)
+	}
+
+	// Other versions and configuration files change the fingerprint.
+	if got, _ := compute([][]string{{"echo", "tool 1.1"}}, files); got == first {
+		t.Errorf("Fingerprint did not change with the tool version")
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(conf, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := compute([][]string{{"echo", "tool 1.0"}}, files); got == first {
+		t.Errorf("Fingerprint did not change with the configuration file")
+	}
+
+	// Missing tools have no fingerprint (and are not cached).
+	if got, err := compute([][]string{{"no-such-tool-xyz", "--version"}}, noFiles); got != "" || err == nil {
+		t.Errorf("compute for a missing tool returned %q and error %v, want empty and an error", got, err)
+	}
+}
@@ -0,0 +1,117 @@
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// FixEdit is a change made to the program by a tool in autofix mode. Line
+// numbers refer to the text before fixing (ReformattedText if the program
+// was reformatted, or the original text otherwise).
+type FixEdit struct {
+	Tool     string // Tool that made the change.
+	File     string `json:",omitempty"` // File changed (multi-file requests only).
+	Line     int    // First line replaced (for insertions, the line before them).
+	OldLines int    // Number of lines replaced.
+	NewLines int    // Number of lines inserted.
+	OldText  string // Replaced text.
+	NewText  string // Replacement text.
+}
+
+// fixResult holds the result of running a tool in autofix mode.
+type fixResult struct {
+	text  string       // Program text after fixing.
+	edits []FixEdit    // Changes made by the tool.
+	diags []Diagnostic // Problems running the tool.
+}
+
+// fixed returns true if the tool changed the program.
+func (f fixResult) fixed() bool {
+	return len(f.edits) > 0
+}
+
+// runFixer runs a tool that fixes the program in tempfile in place, and
+// returns the fixed text and the changes made. Exit codes are ignored, as
+// fixers use them to report the problems they could not fix (the linters
+// report those later).
+func runFixer(ctx context.Context, tool, dir, tempfile string, limits Limits, name string, args ...string) (fixResult, error) {
+	return fixFile(tool, tempfile, func() (string, error) {
+		out, err := Execute(ctx, dir, limits, tool, name, args...)
+		if _, ok := err.(*exec.ExitError); ok {
+			return out, nil
+		}
+		return out, err
+	})
+}
+
+// fixFile calls run to fix the program in tempfile and returns the fixed
+// text and the changes made. If run fails, the file is restored to its
+// previous contents and the failure is returned as diagnostics.
+func fixFile(tool, tempfile string, run func() (string, error)) (fixResult, error) {
+	before, err := os.ReadFile(tempfile)
+	if err != nil {
+		return fixResult{}, err
+	}
+
+	if out, err := run(); err != nil {
+		// Make sure a partially fixed file is not linted.
+		if err := os.WriteFile(tempfile, before, 0644); err != nil {
+			return fixResult{}, err
+		}
+		return fixResult{
+			text:  string(before),
+			diags: toolDiagnostics(tool, fmt.Sprintf("Fix failed: %v", err), err, out),
+		}, nil
+	}
+
+	after, err := os.ReadFile(tempfile)
+	if err != nil {
+		return fixResult{}, err
+	}
+	return fixResult{
+		text:  string(after),
+		edits: fixEdits(tool, string(before), string(after)),
+	}, nil
+}
+
+// fixEdits returns the changes between the texts before and after fixing,
+// one edit per group of consecutive changed lines.
+func fixEdits(tool, before, after string) []FixEdit {
+	a, b := splitLines(before), splitLines(after)
+	ops := diffLines(a, b)
+
+	var edits []FixEdit
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		e := FixEdit{Tool: tool, Line: ops[i].old}
+		var oldText, newText strings.Builder
+		for ; i < len(ops) && ops[i].kind != ' '; i++ {
+			switch ops[i].kind {
+			case '-':
+				oldText.WriteString(a[ops[i].old])
+				e.OldLines++
+			case '+':
+				newText.WriteString(b[ops[i].new])
+				e.NewLines++
+			}
+		}
+		// Line is the index of the first changed line (or the number of
+		// the line before an insertion).
+		if e.OldLines > 0 {
+			e.Line++
+		}
+		e.OldText, e.NewText = oldText.String(), newText.String()
+		edits = append(edits, e)
+	}
+	return edits
+}
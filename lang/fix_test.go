@@ -0,0 +1,139 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFixEdits(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		want          []FixEdit
+	}{
+		{
+			name:   "unchanged",
+			before: "a\nb\n",
+			after:  "a\nb\n",
+		},
+		{
+			name:   "changed line",
+			before: "a\nb\nc\n",
+			after:  "a\nB\nc\n",
+			want:   []FixEdit{{Tool: "fixer", Line: 2, OldLines: 1, NewLines: 1, OldText: "b\n", NewText: "B\n"}},
+		},
+		{
+			name:   "deleted lines",
+			before: "a\nb\nc\nd\n",
+			after:  "a\nd\n",
+			want:   []FixEdit{{Tool: "fixer", Line: 2, OldLines: 2, OldText: "b\nc\n"}},
+		},
+		{
+			name:   "inserted line",
+			before: "a\nc\n",
+			after:  "a\nb\nc\n",
+			want:   []FixEdit{{Tool: "fixer", Line: 1, NewLines: 1, NewText: "b\n"}},
+		},
+		{
+			name:   "inserted at the top",
+			before: "b\n",
+			after:  "a\nb\n",
+			want:   []FixEdit{{Tool: "fixer", Line: 0, NewLines: 1, NewText: "a\n"}},
+		},
+		{
+			name:   "separate changes",
+			before: "a\nb\nc\nd\n",
+			after:  "A\nb\nc\nD\n",
+			want: []FixEdit{
+				{Tool: "fixer", Line: 1, OldLines: 1, NewLines: 1, OldText: "a\n", NewText: "A\n"},
+				{Tool: "fixer", Line: 4, OldLines: 1, NewLines: 1, OldText: "d\n", NewText: "D\n"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fixEdits("fixer", tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fixEdits(%q, %q) =\n%+v\nwant:\n%+v", tt.before, tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixFile(t *testing.T) {
+	tempfile := filepath.Join(t.TempDir(), "prog.x")
+	if err := os.WriteFile(tempfile, []byte("a\nb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failures restore the file.
+	fix, err := fixFile("fixer", tempfile, func() (string, error) {
+		os.WriteFile(tempfile, []byte("partial"), 0644)
+		return "crashed\n", errors.New("exit status 2")
+	})
+	if err != nil {
+		t.Fatalf("fixFile returned error: %v", err)
+	}
+	wantDiags := []Diagnostic{{Tool: "fixer", Severity: "error", Message: "Fix failed: exit status 2", Context: []string{"crashed"}}}
+	if fix.fixed() || fix.text != "a\nb\n" || !reflect.DeepEqual(fix.diags, wantDiags) {
+		t.Errorf("Failed fixFile = %+v, want text %q and diagnostics %+v", fix, "a\nb\n", wantDiags)
+	}
+	if data, _ := os.ReadFile(tempfile); string(data) != "a\nb\n" {
+		t.Errorf("File contains %q after a failed fix, want %q", data, "a\nb\n")
+	}
+
+	fix, err = fixFile("fixer", tempfile, func() (string, error) {
+		return "", os.WriteFile(tempfile, []byte("a\nB\n"), 0644)
+	})
+	if err != nil {
+		t.Fatalf("fixFile returned error: %v", err)
+	}
+	wantEdits := []FixEdit{{Tool: "fixer", Line: 2, OldLines: 1, NewLines: 1, OldText: "b\n", NewText: "B\n"}}
+	if !fix.fixed() || fix.text != "a\nB\n" || !reflect.DeepEqual(fix.edits, wantEdits) || fix.diags != nil {
+		t.Errorf("fixFile = %+v, want text %q and edits %+v", fix, "a\nB\n", wantEdits)
+	}
+}
+
+// TestLanguageConfigFix checks that fixers in language definitions run
+// only when requested, and that the linters check the fixed program.
+func TestLanguageConfigFix(t *testing.T) {
+	lc := &LanguageConfig{
+		Display:   "Test",
+		Extension: "x",
+		Fixer:     &ToolConfig{Name: "upper", Command: []string{"sh", "-c", `tr a-z A-Z < "$1"`, "sh", "{file}"}},
+		Linters: []*ToolConfig{{
+			Name:    "lower",
+			Command: []string{"grep", "-n", "[a-z]", "{file}"},
+			Regex:   `^(?P<line>[0-9]+):(?P<message>.*)$`,
+			// grep exits with 1 when nothing matches.
+			PassCodes: []int{1},
+			FailCodes: []int{0},
+		}},
+	}
+	if err := lc.compile(); err != nil {
+		t.Fatalf("compile returned error: %v", err)
+	}
+
+	resp, err := lc.Lint(context.Background(), LintRequest{Text: "A\nb\n"})
+	if err != nil {
+		t.Fatalf("Lint returned error: %v", err)
+	}
+	if resp.Pass || resp.Fixed || len(resp.Diagnostics) != 1 {
+		t.Errorf("Lint without fix = %+v, want one problem and no fixes", resp)
+	}
+
+	resp, err = lc.Lint(context.Background(), LintRequest{Text: "A\nb\n", Fix: true})
+	if err != nil {
+		t.Fatalf("Lint returned error: %v", err)
+	}
+	wantEdits := []FixEdit{{Tool: "upper", Line: 2, OldLines: 1, NewLines: 1, OldText: "b\n", NewText: "B\n"}}
+	if !resp.Pass || !resp.Fixed || resp.FixedText != "A\nB\n" || !reflect.DeepEqual(resp.Fixes, wantEdits) {
+		t.Errorf("Lint with fix = %+v, want fixed text %q and edits %+v", resp, "A\nB\n", wantEdits)
+	}
+}
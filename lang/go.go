@@ -5,113 +5,298 @@
 package lang
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
-	"net/http"
+	"go/token"
 	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
-
-	"github.com/osprogramadores/op-web-linter/common"
-	"github.com/osprogramadores/op-web-linter/handlers"
 )
 
-// Regexp matching go build and go lint lines.
+// Regexp matching go build lines.
 var goLineRegex = regexp.MustCompile("^([^:]+):([0-9]+):([0-9]+):[ ]*(.*)")
 
-// LintGo lints programs written in Go.
-func LintGo(w http.ResponseWriter, r *http.Request, req handlers.LintRequest) {
+// Resource limits for the Go tools.
+var goLimits = DefaultLimits
+
+// DefaultGoChecks holds the default staticcheck checks: all of them (which
+// includes the stylecheck checks, similar to golint), except for the
+// package comment check, meaningless for single file programs.
+var DefaultGoChecks = []string{"all", "-ST1000"}
+
+// GoChecks holds the staticcheck checks run on Go programs, in the syntax
+// used by staticcheck -checks (E.g. "SA*", "-ST1003"). It should only be
+// changed at startup.
+var GoChecks = DefaultGoChecks
+
+// goToolsFingerprint identifies the versions of the Go tools.
+var goToolsFingerprint = fingerprint([][]string{{"go", "version"}, {"staticcheck", "-version"}}, noFiles)
+
+// FingerprintGo identifies the versions of the Go tools and the enabled
+// checks and analyzers, for caching.
+func FingerprintGo() string {
+	tools := goToolsFingerprint()
+	if tools == "" {
+		return ""
+	}
+	return tools + ":" + strings.Join(GoChecks, ",") + ":" + strings.Join(GoVetChecks, ",")
+}
+
+// staticcheckProblem is a single line in the output of staticcheck -f json.
+type staticcheckProblem struct {
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Location struct {
+		File   string `json:"file"`
+		Line   int    `json:"line"`
+		Column int    `json:"column"`
+	} `json:"location"`
+	End struct {
+		Line   int `json:"line"`
+		Column int `json:"column"`
+	} `json:"end"`
+	Message string `json:"message"`
+}
+
+// LintGo lints programs written in Go. Formatting, type checking and the go
+// vet analyzers (in GoVetChecks) run in the server process. Staticcheck
+// (with the checks in GoChecks) and go build only run on programs that type
+// check. Multi-file requests are linted as a single package.
+func LintGo(ctx context.Context, req LintRequest) (LintResponse, error) {
+	if len(req.Files) > 0 {
+		return lintGoFiles(ctx, req)
+	}
+
 	// Save program text in request to file.
-	tempdir, tempfile, err := saveRequestToFile(req.Text, "*.go")
+	tempdir, tempfile, err := saveRequestToFile(ctx, req.Text, "*.go")
 	if err != nil {
-		common.HTTPError(w, err.Error(), http.StatusInternalServerError)
-		return
+		return LintResponse{}, err
 	}
 	defer os.RemoveAll(tempdir)
 
-	var messages []string
+	// Reformat source (like gofmt -s). Programs with syntax errors can't be
+	// type checked either, so the formatter errors are all we report.
+	reformatted, diags := goFormat(req.Text)
+	if diags != nil {
+		return LintResponse{
+			ErrorMessages:   ErrorMessages(diags),
+			Diagnostics:     setSource(diags, SourceOriginal),
+			ReformattedText: reformatted,
+			Formatter:       "gofmt",
+		}, nil
+	}
+	// Rewrite reformatted program to tempfile.
+	if err := os.WriteFile(tempfile, []byte(reformatted), 0644); err != nil {
+		return LintResponse{}, err
+	}
+
+	diags, err = lintGoPackage(ctx, tempdir, []string{tempfile}, []string{reformatted})
+	if err != nil {
+		return LintResponse{}, err
+	}
+	diags = setFile(diags, "")
 
-	// Attempt to reformat source with gofmt (+simplify).
-	// Indicate formatting failure if necessary.
-	reformatted, gofmterr := Execute("gofmt", "-s", tempfile)
+	// Create and return response.
+	return LintResponse{
+		Pass:            len(diags) == 0,
+		ErrorMessages:   ErrorMessages(diags),
+		Diagnostics:     setSource(diags, SourceReformatted),
+		Reformatted:     reformatted != req.Text,
+		ReformattedText: reformatted,
+		Formatter:       "gofmt",
+	}, nil
+}
 
-	if gofmterr != nil {
-		messages = append(messages, fmt.Sprintf("Reformat failed: %v", err))
-	} else {
-		// Rewrite reformatted program to tempfile.
-		if err := os.WriteFile(tempfile, []byte(reformatted), 0644); err != nil {
-			common.HTTPError(w, err.Error(), http.StatusInternalServerError)
-			return
+// lintGoFiles lints the Go files in a multi-file request as a single package.
+// All Go files must be in the same directory. Test files are ignored.
+func lintGoFiles(ctx context.Context, req LintRequest) (LintResponse, error) {
+	var (
+		diags []Diagnostic
+		files []FileResponse
+		dir   string
+	)
+	// Save all files, with the Go files reformatted.
+	saved := append([]File{}, req.Files...)
+	var goFiles []int
+	for i, f := range req.Files {
+		if path.Ext(f.Path) != ".go" || strings.HasSuffix(f.Path, "_test.go") {
+			continue
+		}
+		if len(goFiles) > 0 && path.Dir(f.Path) != dir {
+			return LintResponse{}, fmt.Errorf("%w: all Go files must be in the same directory", ErrInvalidFiles)
 		}
+		dir = path.Dir(f.Path)
+		goFiles = append(goFiles, i)
+
+		reformatted, d := goFormat(f.Text)
+		diags = append(diags, setFile(d, f.Path)...)
+		files = append(files, FileResponse{
+			Path:            f.Path,
+			Reformatted:     d == nil && reformatted != f.Text,
+			ReformattedText: reformatted,
+		})
+		saved[i].Text = reformatted
+	}
+	if len(goFiles) == 0 {
+		return LintResponse{}, fmt.Errorf("%w: no Go files", ErrInvalidFiles)
+	}
+	reformatted := false
+	for _, f := range files {
+		reformatted = reformatted || f.Reformatted
+	}
+
+	// Programs with syntax errors can't be type checked.
+	if diags != nil {
+		return LintResponse{
+			ErrorMessages: ErrorMessages(diags),
+			Diagnostics:   setSource(diags, SourceOriginal),
+			Reformatted:   reformatted,
+			Formatter:     "gofmt",
+			Files:         files,
+		}, nil
 	}
 
-	// Golint.
-	m, ok, err := runGolint(tempfile)
+	tempdir, fnames, err := saveRequestFiles(ctx, saved)
 	if err != nil {
-		common.HTTPError(w, err.Error(), http.StatusInternalServerError)
-		return
+		return LintResponse{}, err
+	}
+	defer os.RemoveAll(tempdir)
+
+	var gofnames, texts []string
+	for _, i := range goFiles {
+		gofnames = append(gofnames, fnames[i])
+		texts = append(texts, saved[i].Text)
+	}
+	diags, err = lintGoPackage(ctx, tempdir, gofnames, texts)
+	if err != nil {
+		return LintResponse{}, err
+	}
+	// go build reports file names relative to the temporary directory.
+	for i := range diags {
+		if fname := diags[i].File; fname != "" {
+			if !filepath.IsAbs(fname) {
+				fname = filepath.Join(tempdir, fname)
+			}
+			diags[i].File = relativePath(tempdir, fname)
+		}
+	}
+
+	// Create and return response.
+	return LintResponse{
+		Pass:          len(diags) == 0,
+		ErrorMessages: ErrorMessages(diags),
+		Diagnostics:   setSource(diags, SourceReformatted),
+		Reformatted:   reformatted,
+		Formatter:     "gofmt",
+		Files:         files,
+	}, nil
+}
+
+// lintGoPackage type checks and lints the (reformatted) files of a Go
+// package, saved as fnames in tempdir. The diagnostics have the file names
+// reported by the tools in Diagnostic.File.
+func lintGoPackage(ctx context.Context, tempdir string, fnames, texts []string) ([]Diagnostic, error) {
+	// Type check and run the go vet analyzers.
+	fset := token.NewFileSet()
+	files, pkg, info, diags, err := goTypecheck(ctx, fset, fnames, texts)
+	if err != nil {
+		return nil, err
+	}
+	if diags != nil {
+		return diags, nil
+	}
+	diags = goAnalyze(fset, files, pkg, info)
+
+	// Staticcheck.
+	d, ok, err := runStaticcheck(ctx, tempdir, fnames)
+	if err != nil {
+		return nil, err
 	}
 	if !ok {
-		messages = append(messages, m...)
+		diags = append(diags, d...)
 	}
 
 	// Go Build.
-	m, ok = runGoBuild(tempdir, tempfile)
+	d, ok = runGoBuild(ctx, tempdir, fnames)
 	if !ok {
-		messages = append(messages, m...)
+		diags = append(diags, d...)
 	}
+	return diags, nil
+}
 
-	// Create response, convert to JSON and return.
-	resp := handlers.LintResponse{
-		Pass:            len(messages) == 0,
-		ErrorMessages:   messages,
-		Reformatted:     reformatted != req.Text && gofmterr == nil,
-		ReformattedText: reformatted,
+// runStaticcheck runs staticcheck on the source files with the checks in
+// GoChecks, and returns the diagnostics with the check code as the rule.
+func runStaticcheck(ctx context.Context, dirname string, fnames []string) ([]Diagnostic, bool, error) {
+	// Staticcheck returns an error code (1) when it finds problems. We look
+	// for the output instead.
+	args := append([]string{"-f", "json", "-checks", strings.Join(GoChecks, ",")}, fnames...)
+	o, err := Execute(ctx, dirname, goLimits, "staticcheck", "staticcheck", args...)
+
+	// Exceeding resource limits is a problem with the program, not the server.
+	if d := limitDiagnostics("staticcheck", err); d != nil {
+		return d, false, nil
 	}
-	jresp, err := json.Marshal(resp)
-	if err != nil {
-		common.HTTPError(w, err.Error(), http.StatusInternalServerError)
-		return
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return nil, false, err
 	}
-	log.Printf("JSON response:\n%s", prettyJSONString(jresp))
-	w.Write(jresp)
-	w.Write([]byte("\n"))
+	diags := staticcheckFilterOutput(strings.Split(o, "\n"))
+	return diags, len(diags) == 0, nil
 }
 
-// runGolint runs golint on the source file and returns the output.
-func runGolint(fname string) ([]string, bool, error) {
-	// Golint to always exits with code 0 (no error). Any output
-	// means the input program contains errors.
-	o, err := Execute("golint", fname)
-	out := strings.Split(o, "\n")
-
-	if err != nil {
-		return common.SlicePrefix(goFilterOutput(out), "golint"), false, err
-	}
-	// No errors in the program.
-	if len(out) == 0 {
-		return []string{}, true, nil
+// staticcheckFilterOutput converts the output of staticcheck -f json into
+// diagnostics. Compile errors are ignored (go build reports them).
+func staticcheckFilterOutput(list []string) []Diagnostic {
+	var ret []Diagnostic
+	for _, v := range list {
+		// Remove blank lines.
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		var p staticcheckProblem
+		if err := json.Unmarshal([]byte(v), &p); err != nil {
+			ret = appendUnparsed(ret, "staticcheck", v)
+			continue
+		}
+		if p.Code == "compile" {
+			continue
+		}
+		ret = append(ret, Diagnostic{
+			Tool:      "staticcheck",
+			File:      p.Location.File,
+			Line:      p.Location.Line,
+			Column:    p.Location.Column,
+			EndLine:   p.End.Line,
+			EndColumn: p.End.Column,
+			Severity:  p.Severity,
+			RuleID:    p.Code,
+			Message:   p.Message,
+		})
 	}
-	return common.SlicePrefix(goFilterOutput(out), "golint"), false, nil
+	return ret
 }
 
-// runGoBuild runs "go build" on the source file and returns the output.
-func runGoBuild(dirname, fname string) ([]string, bool) {
-	o, err := Execute("go", "build", "-o", dirname, fname)
-	out := strings.Split(o, "\n")
+// runGoBuild runs "go build" on the source files and returns the diagnostics.
+func runGoBuild(ctx context.Context, dirname string, fnames []string) ([]Diagnostic, bool) {
+	o, err := Execute(ctx, dirname, goLimits, "go build", "go", append([]string{"build", "-o", dirname}, fnames...)...)
 	retcode := Exitcode(err)
 
 	// No errors.
 	if retcode == 0 {
-		return []string{}, true
+		return nil, true
 	}
-	return common.SlicePrefix(goFilterOutput(out), "go build"), false
+	diags := goFilterOutput(strings.Split(o, "\n"), "go build", "error")
+	return append(diags, limitDiagnostics("go build", err)...), false
 }
 
-// goFilterOutput remove undesirable lines and formats the output from go build.
-func goFilterOutput(list []string) []string {
-	var ret []string
+// goFilterOutput remove undesirable lines from the output of go build (named
+// by tool) and converts the remaining lines into diagnostics with the given
+// severity, and the file names in Diagnostic.File.
+func goFilterOutput(list []string, tool, severity string) []Diagnostic {
+	var ret []Diagnostic
 	for _, v := range list {
 		// Go builds adds lines starting with #
 		if strings.HasPrefix(v, "#") {
@@ -121,17 +306,23 @@ func goFilterOutput(list []string) []string {
 		if strings.TrimSpace(v) == "" {
 			continue
 		}
-		// Go build and go lint prefix lines with filename:line:column. Remove
-		// the filename since it's a temp file anyway.
+		// Go build prefixes lines with filename:line:column.
 		r := goLineRegex.FindStringSubmatch(v)
 
 		// Unable to parse line. Include literally.
 		if len(r) < 5 {
-			ret = append(ret, v)
+			ret = appendUnparsed(ret, tool, v)
 			continue
 		}
 
-		ret = append(ret, fmt.Sprintf("Line %s Col %s: %s", r[2], r[3], r[4]))
+		ret = append(ret, Diagnostic{
+			Tool:     tool,
+			File:     r[1],
+			Line:     atoi(r[2]),
+			Column:   atoi(r[3]),
+			Severity: severity,
+			Message:  r[4],
+		})
 	}
 	return ret
 }
@@ -0,0 +1,60 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGoFilterOutput(t *testing.T) {
+	out := strings.Join([]string{
+		"# command-line-arguments",
+		"/tmp/lint123/prog456.go:4:2: undefined: fmt.Printx",
+		"/tmp/lint123/prog456.go:6:1: syntax error: unexpected }",
+		"\tcontinued message",
+		"",
+	}, "\n")
+
+	want := []Diagnostic{
+		{Tool: "go build", File: "/tmp/lint123/prog456.go", Line: 4, Column: 2, Severity: "error", Message: "undefined: fmt.Printx"},
+		{Tool: "go build", File: "/tmp/lint123/prog456.go", Line: 6, Column: 1, Severity: "error", Message: "syntax error: unexpected }", Context: []string{"\tcontinued message"}},
+	}
+	if got := goFilterOutput(strings.Split(out, "\n"), "go build", "error"); !reflect.DeepEqual(got, want) {
+		t.Errorf("goFilterOutput =\n%+v\nwant:\n%+v", got, want)
+	}
+
+	// Lines that can't be parsed become diagnostics without a position.
+	want = []Diagnostic{{Tool: "go build", Message: "unexpected output"}}
+	if got := goFilterOutput([]string{"unexpected output"}, "go build", "error"); !reflect.DeepEqual(got, want) {
+		t.Errorf("goFilterOutput with unparsed line = %+v, want %+v", got, want)
+	}
+}
+
+func TestStaticcheckFilterOutput(t *testing.T) {
+	out := []string{
+		`{"code":"compile","severity":"error","location":{"file":"/tmp/lint123/prog.go","line":3,"column":1},"message":"expected declaration"}`,
+		`{"code":"ST1003","severity":"warning","location":{"file":"/tmp/lint123/prog.go","line":4,"column":6},"end":{"file":"/tmp/lint123/prog.go","line":4,"column":14},"message":"should not use underscores in Go names"}`,
+		"",
+		"staticcheck: unexpected output",
+	}
+	want := []Diagnostic{
+		{
+			Tool:      "staticcheck",
+			File:      "/tmp/lint123/prog.go",
+			Line:      4,
+			Column:    6,
+			EndLine:   4,
+			EndColumn: 14,
+			Severity:  "warning",
+			RuleID:    "ST1003",
+			Message:   "should not use underscores in Go names",
+			Context:   []string{"staticcheck: unexpected output"},
+		},
+	}
+	if got := staticcheckFilterOutput(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("staticcheckFilterOutput =\n%+v\nwant:\n%+v", got, want)
+	}
+}
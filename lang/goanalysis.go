@@ -0,0 +1,527 @@
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/appends"
+	"golang.org/x/tools/go/analysis/passes/assign"
+	"golang.org/x/tools/go/analysis/passes/atomic"
+	"golang.org/x/tools/go/analysis/passes/bools"
+	"golang.org/x/tools/go/analysis/passes/composite"
+	"golang.org/x/tools/go/analysis/passes/copylock"
+	"golang.org/x/tools/go/analysis/passes/defers"
+	"golang.org/x/tools/go/analysis/passes/directive"
+	"golang.org/x/tools/go/analysis/passes/errorsas"
+	"golang.org/x/tools/go/analysis/passes/httpresponse"
+	"golang.org/x/tools/go/analysis/passes/ifaceassert"
+	"golang.org/x/tools/go/analysis/passes/loopclosure"
+	"golang.org/x/tools/go/analysis/passes/lostcancel"
+	"golang.org/x/tools/go/analysis/passes/nilfunc"
+	"golang.org/x/tools/go/analysis/passes/printf"
+	"golang.org/x/tools/go/analysis/passes/shift"
+	"golang.org/x/tools/go/analysis/passes/sigchanyzer"
+	"golang.org/x/tools/go/analysis/passes/slog"
+	"golang.org/x/tools/go/analysis/passes/stdmethods"
+	"golang.org/x/tools/go/analysis/passes/stringintconv"
+	"golang.org/x/tools/go/analysis/passes/structtag"
+	"golang.org/x/tools/go/analysis/passes/timeformat"
+	"golang.org/x/tools/go/analysis/passes/unmarshal"
+	"golang.org/x/tools/go/analysis/passes/unreachable"
+	"golang.org/x/tools/go/analysis/passes/unsafeptr"
+	"golang.org/x/tools/go/analysis/passes/unusedresult"
+
+	"github.com/osprogramadores/op-web-linter/metrics"
+)
+
+// goAnalyzers holds the analyzers run on Go programs: the go vet suite,
+// except for the ones checking assembly, cgo, build tags and tests (which
+// don't apply to single file programs).
+var goAnalyzers = []*analysis.Analyzer{
+	appends.Analyzer,
+	assign.Analyzer,
+	atomic.Analyzer,
+	bools.Analyzer,
+	composite.Analyzer,
+	copylock.Analyzer,
+	defers.Analyzer,
+	directive.Analyzer,
+	errorsas.Analyzer,
+	httpresponse.Analyzer,
+	ifaceassert.Analyzer,
+	loopclosure.Analyzer,
+	lostcancel.Analyzer,
+	nilfunc.Analyzer,
+	printf.Analyzer,
+	shift.Analyzer,
+	sigchanyzer.Analyzer,
+	slog.Analyzer,
+	stdmethods.Analyzer,
+	stringintconv.Analyzer,
+	structtag.Analyzer,
+	timeformat.Analyzer,
+	unmarshal.Analyzer,
+	unreachable.Analyzer,
+	unsafeptr.Analyzer,
+	unusedresult.Analyzer,
+}
+
+// DefaultGoVetChecks holds the default go vet analyzers: all of them.
+var DefaultGoVetChecks = []string{"all"}
+
+// GoVetChecks holds the go vet analyzers run on Go programs, in a syntax
+// similar to GoChecks: analyzer names (with "*" wildcards, E.g. "unused*"),
+// "all", and names prefixed by "-" to disable them, applied in order. It
+// should only be changed at startup, after validating it with
+// CheckGoVetChecks.
+var GoVetChecks = DefaultGoVetChecks
+
+// Import paths of standard library packages (more strict than the go
+// command, which only requires no dots in the first element).
+var goStdImportRegex = regexp.MustCompile(`^[a-z0-9_]+(/[a-z0-9_]+)*$`)
+
+// CheckGoVetChecks returns an error if any of the go vet checks doesn't
+// match any analyzer.
+func CheckGoVetChecks(checks []string) error {
+	_, err := selectGoAnalyzers(checks)
+	return err
+}
+
+// selectGoAnalyzers returns the analyzers in goAnalyzers selected by checks
+// (see GoVetChecks).
+func selectGoAnalyzers(checks []string) ([]*analysis.Analyzer, error) {
+	enabled := map[*analysis.Analyzer]bool{}
+	for _, check := range checks {
+		pattern, disable := strings.CutPrefix(strings.TrimSpace(check), "-")
+		if pattern == "" {
+			continue
+		}
+		if pattern == "all" {
+			pattern = "*"
+		}
+		found := false
+		for _, a := range goAnalyzers {
+			if ok, err := path.Match(pattern, a.Name); err != nil {
+				return nil, fmt.Errorf("invalid go vet check %q: %v", check, err)
+			} else if ok {
+				enabled[a] = !disable
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown go vet check %q", check)
+		}
+	}
+	var ret []*analysis.Analyzer
+	for _, a := range goAnalyzers {
+		if enabled[a] {
+			ret = append(ret, a)
+		}
+	}
+	return ret, nil
+}
+
+// goFormat reformats and simplifies a Go program like gofmt -s. On syntax
+// errors, returns the original text and one diagnostic per error.
+func goFormat(text string) (string, []Diagnostic) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", text, parser.ParseComments|parser.SkipObjectResolution)
+	if err == nil {
+		goSimplify(file)
+		var buf bytes.Buffer
+		if err = format.Node(&buf, fset, file); err == nil {
+			return buf.String(), nil
+		}
+	}
+	metrics.FormatterFailures.Inc("gofmt")
+	return text, goErrorDiagnostics("gofmt", err)
+}
+
+// goErrorDiagnostics converts parser errors into diagnostics.
+func goErrorDiagnostics(tool string, err error) []Diagnostic {
+	var list scanner.ErrorList
+	if !errors.As(err, &list) {
+		return []Diagnostic{{Tool: tool, Severity: "error", Message: err.Error()}}
+	}
+	var ret []Diagnostic
+	for _, e := range list {
+		ret = append(ret, Diagnostic{
+			Tool:     tool,
+			Line:     e.Pos.Line,
+			Column:   e.Pos.Column,
+			Severity: "error",
+			Message:  e.Msg,
+		})
+	}
+	return ret
+}
+
+// goTypecheck parses and type checks the files of a Go package (named
+// fnames). Only standard library packages can be imported, using the export
+// data built by the go command (see goExportData). Returns the type errors as
+// diagnostics, if any, with the file names in Diagnostic.File.
+func goTypecheck(ctx context.Context, fset *token.FileSet, fnames, texts []string) ([]*ast.File, *types.Package, *types.Info, []Diagnostic, error) {
+	var files []*ast.File
+	for i, fname := range fnames {
+		file, err := parser.ParseFile(fset, fname, texts[i], parser.ParseComments)
+		if err != nil {
+			return nil, nil, nil, setFile(goErrorDiagnostics("gotype", err), fname), nil
+		}
+		files = append(files, file)
+	}
+
+	diags := goImportDiagnostics(fset, files)
+	if diags != nil {
+		return nil, nil, nil, diags, nil
+	}
+	exports, err := goExportData(ctx)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	lookup := func(path string) (io.ReadCloser, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if exports[path] == "" {
+			return nil, errors.New("not in the standard library")
+		}
+		f, err := os.Open(exports[path])
+		if errors.Is(err, fs.ErrNotExist) {
+			resetGoExportData()
+		}
+		return f, err
+	}
+
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "gc", lookup),
+		Sizes:    types.SizesFor("gc", runtime.GOARCH),
+		Error: func(err error) {
+			var terr types.Error
+			if !errors.As(err, &terr) {
+				diags = append(diags, Diagnostic{Tool: "gotype", Severity: "error", Message: err.Error()})
+				return
+			}
+			// Some messages have details in the following lines (E.g.
+			// "have (number)" and "want ()").
+			pos := fset.Position(terr.Pos)
+			lines := strings.Split(terr.Msg, "\n")
+			diags = append(diags, Diagnostic{
+				Tool:     "gotype",
+				File:     pos.Filename,
+				Line:     pos.Line,
+				Column:   pos.Column,
+				Severity: "error",
+				Message:  lines[0],
+				Context:  lines[1:],
+			})
+		},
+	}
+	info := &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Instances:  map[*ast.Ident]types.Instance{},
+		Defs:       map[*ast.Ident]types.Object{},
+		Uses:       map[*ast.Ident]types.Object{},
+		Implicits:  map[ast.Node]types.Object{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+		Scopes:     map[ast.Node]*types.Scope{},
+	}
+	pkg, _ := conf.Check(files[0].Name.Name, fset, files, info)
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	sortDiagnostics(diags)
+	return files, pkg, info, diags, nil
+}
+
+// goImportDiagnostics returns one diagnostic per import of a package
+// outside the standard library (which can't be imported by single file
+// programs, or without a go.mod).
+func goImportDiagnostics(fset *token.FileSet, files []*ast.File) []Diagnostic {
+	var diags []Diagnostic
+	for _, file := range files {
+		for _, spec := range file.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil || !isStdImport(path) {
+				pos := fset.Position(spec.Path.Pos())
+				diags = append(diags, Diagnostic{
+					Tool:     "gotype",
+					File:     pos.Filename,
+					Line:     pos.Line,
+					Column:   pos.Column,
+					Severity: "error",
+					Message:  fmt.Sprintf("import of %s not supported (only standard library packages can be imported)", spec.Path.Value),
+				})
+			}
+		}
+	}
+	return diags
+}
+
+// isStdImport returns true if path is the import path of a (non internal)
+// standard library package.
+func isStdImport(path string) bool {
+	if !goStdImportRegex.MatchString(path) {
+		return false
+	}
+	for _, elem := range strings.Split(path, "/") {
+		if elem == "internal" || elem == "vendor" {
+			return false
+		}
+	}
+	return !strings.HasPrefix(path, "cmd/")
+}
+
+// goExportTimeout is the maximum wall time to build the export data of the
+// standard library (only the first time, with an empty build cache).
+var goExportTimeout = 5 * time.Minute
+
+// goStdExports memoizes the export data files of the standard library (see
+// goExportData).
+var goStdExports struct {
+	mu    sync.Mutex
+	files map[string]string // Export data files by import path (nil if not built).
+}
+
+// BuildGoExportData builds the export data of the standard library
+// packages, used to type check Go programs. Call it once at startup, after
+// configuring the sandbox. Otherwise, it's built by the first Go request.
+func BuildGoExportData(ctx context.Context) error {
+	_, err := goExportData(ctx)
+	return err
+}
+
+// goExportData runs go list (like any other tool) to build the export data
+// of the standard library packages, once. Returns the paths of the export
+// data files by import path. The go command must be the same version used
+// to build op-web-linter, to read the export data.
+func goExportData(ctx context.Context) (map[string]string, error) {
+	goStdExports.mu.Lock()
+	defer goStdExports.mu.Unlock()
+	if goStdExports.files != nil {
+		return goStdExports.files, nil
+	}
+
+	tempdir, err := os.MkdirTemp("", "")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempdir)
+
+	// The export data is kept in the build cache, so it's built with the
+	// paths in Sandbox.Overlay writable (they are covered by overlays for
+	// the other executions). Building it without a cache takes several
+	// CPU minutes.
+	limits := goLimits
+	limits.CPUTime = 0
+	out := &limitedBuffer{max: limits.Output}
+	_, err = execute(ctx, tempdir, execOptions{
+		tool:     "go list",
+		limits:   limits,
+		timeout:  goExportTimeout,
+		stdout:   out,
+		stderr:   out,
+		writable: append(append([]string{}, Sandbox.Writable...), Sandbox.Overlay...),
+	}, "go", "list", "-deps", "-export", "-f", "{{.ImportPath}}\t{{.Export}}", "std")
+	if err != nil {
+		return nil, fmt.Errorf("go list: %v: %s", err, out.buf)
+	}
+	files := map[string]string{}
+	for _, line := range strings.Split(string(out.buf), "\n") {
+		if path, export, ok := strings.Cut(line, "\t"); ok && export != "" {
+			files[path] = export
+		}
+	}
+	goStdExports.files = files
+	return files, nil
+}
+
+// resetGoExportData discards the memoized export data, to build it again
+// (E.g. if the build cache was trimmed).
+func resetGoExportData() {
+	goStdExports.mu.Lock()
+	defer goStdExports.mu.Unlock()
+	goStdExports.files = nil
+}
+
+// goFactKey identifies a fact exported by an analyzer, for an object or
+// package (obj is nil for package facts).
+type goFactKey struct {
+	obj types.Object
+	pkg *types.Package
+	typ reflect.Type
+}
+
+// goAnalyze runs the analyzers selected by GoVetChecks (and the analyzers
+// they require) on a type checked package, and returns the diagnostics with
+// the analyzer name as the rule and the file names in Diagnostic.File,
+// sorted by position. Facts are only kept for the package itself: the
+// imported packages are not analyzed.
+func goAnalyze(fset *token.FileSet, files []*ast.File, pkg *types.Package, info *types.Info) []Diagnostic {
+	analyzers, err := selectGoAnalyzers(GoVetChecks)
+	if err != nil {
+		return []Diagnostic{{Tool: "go vet", Severity: "error", Message: err.Error()}}
+	}
+	var (
+		diags    []Diagnostic
+		facts    = map[goFactKey]analysis.Fact{}
+		results  = map[*analysis.Analyzer]any{}
+		errs     = map[*analysis.Analyzer]error{}
+		selected = map[*analysis.Analyzer]bool{}
+	)
+	for _, a := range analyzers {
+		selected[a] = true
+	}
+	sizes := types.SizesFor("gc", runtime.GOARCH)
+
+	var run func(a *analysis.Analyzer) error
+	run = func(a *analysis.Analyzer) (err error) {
+		// Each analyzer runs only once (errs holds nil on success).
+		if err, ok := errs[a]; ok {
+			return err
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("analyzer %s panicked: %v", a.Name, r)
+			}
+			errs[a] = err
+		}()
+
+		resultOf := map[*analysis.Analyzer]any{}
+		for _, req := range a.Requires {
+			if err := run(req); err != nil {
+				return err
+			}
+			resultOf[req] = results[req]
+		}
+		pass := &analysis.Pass{
+			Analyzer:   a,
+			Fset:       fset,
+			Files:      files,
+			Pkg:        pkg,
+			TypesInfo:  info,
+			TypesSizes: sizes,
+			ResultOf:   resultOf,
+			Report: func(d analysis.Diagnostic) {
+				// Analyzers only required by others don't report.
+				if !selected[a] {
+					return
+				}
+				pos := fset.Position(d.Pos)
+				diag := Diagnostic{
+					Tool:     "go vet",
+					File:     pos.Filename,
+					Line:     pos.Line,
+					Column:   pos.Column,
+					Severity: "warning",
+					RuleID:   a.Name,
+					Message:  d.Message,
+				}
+				if d.End.IsValid() {
+					end := fset.Position(d.End)
+					diag.EndLine, diag.EndColumn = end.Line, end.Column
+				}
+				diags = append(diags, diag)
+			},
+			ReadFile: func(string) ([]byte, error) {
+				return nil, errors.New("reading files is not supported")
+			},
+			ImportObjectFact: func(obj types.Object, fact analysis.Fact) bool {
+				return importFact(facts, goFactKey{obj: obj, typ: reflect.TypeOf(fact)}, fact)
+			},
+			ImportPackageFact: func(p *types.Package, fact analysis.Fact) bool {
+				return importFact(facts, goFactKey{pkg: p, typ: reflect.TypeOf(fact)}, fact)
+			},
+			ExportObjectFact: func(obj types.Object, fact analysis.Fact) {
+				facts[goFactKey{obj: obj, typ: reflect.TypeOf(fact)}] = fact
+			},
+			ExportPackageFact: func(fact analysis.Fact) {
+				facts[goFactKey{pkg: pkg, typ: reflect.TypeOf(fact)}] = fact
+			},
+			AllObjectFacts: func() []analysis.ObjectFact {
+				var ret []analysis.ObjectFact
+				for k, f := range facts {
+					if k.obj != nil {
+						ret = append(ret, analysis.ObjectFact{Object: k.obj, Fact: f})
+					}
+				}
+				return ret
+			},
+			AllPackageFacts: func() []analysis.PackageFact {
+				var ret []analysis.PackageFact
+				for k, f := range facts {
+					if k.obj == nil {
+						ret = append(ret, analysis.PackageFact{Package: k.pkg, Fact: f})
+					}
+				}
+				return ret
+			},
+		}
+		res, err := a.Run(pass)
+		if err != nil {
+			return fmt.Errorf("analyzer %s: %v", a.Name, err)
+		}
+		results[a] = res
+		return nil
+	}
+
+	for _, a := range analyzers {
+		if err := run(a); err != nil {
+			diags = append(diags, Diagnostic{Tool: "go vet", Severity: "error", Message: err.Error()})
+		}
+	}
+	sortDiagnostics(diags)
+	return diags
+}
+
+// importFact copies the fact stored under key into fact. Returns false if
+// there is no such fact.
+func importFact(facts map[goFactKey]analysis.Fact, key goFactKey, fact analysis.Fact) bool {
+	f, ok := facts[key]
+	if !ok {
+		return false
+	}
+	reflect.ValueOf(fact).Elem().Set(reflect.ValueOf(f).Elem())
+	return true
+}
+
+// sortDiagnostics sorts diagnostics by file, position and rule.
+func sortDiagnostics(diags []Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].File != diags[j].File {
+			return diags[i].File < diags[j].File
+		}
+		if diags[i].Line != diags[j].Line {
+			return diags[i].Line < diags[j].Line
+		}
+		if diags[i].Column != diags[j].Column {
+			return diags[i].Column < diags[j].Column
+		}
+		return diags[i].RuleID < diags[j].RuleID
+	})
+}
@@ -0,0 +1,254 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"context"
+	"fmt"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGoFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		wantText  string
+		wantDiags []Diagnostic
+	}{
+		{
+			name:     "formatted",
+			text:     "package main\n\nfunc main() {}\n",
+			wantText: "package main\n\nfunc main() {}\n",
+		},
+		{
+			name:     "reformatted",
+			text:     "package main\nfunc main() {\nx := 1\n_ = x\n}\n",
+			wantText: "package main\n\nfunc main() {\n\tx := 1\n\t_ = x\n}\n",
+		},
+		{
+			name:     "simplified",
+			text:     "package main\n\nconst ()\n\nvar m = map[string][]int{\"a\": []int{1}}\nvar p = []*T{&T{}}\n\nfunc f(s []int) {\n\tfor _ = range s[1:len(s)] {\n\t}\n\tfor i, _ := range s {\n\t\t_ = i\n\t}\n}\n",
+			wantText: "package main\n\nvar m = map[string][]int{\"a\": {1}}\nvar p = []*T{{}}\n\nfunc f(s []int) {\n\tfor range s[1:] {\n\t}\n\tfor i := range s {\n\t\t_ = i\n\t}\n}\n",
+		},
+		{
+			name:     "not simplified",
+			text:     "package main\n\nvar m = map[string][]any{\"a\": []int{1}}\nvar s = t[1:len(u)]\n",
+			wantText: "package main\n\nvar m = map[string][]any{\"a\": []int{1}}\nvar s = t[1:len(u)]\n",
+		},
+		{
+			name:     "syntax error",
+			text:     "package main\n\nfunc main() {\n",
+			wantText: "package main\n\nfunc main() {\n",
+			wantDiags: []Diagnostic{
+				{Tool: "gofmt", Line: 3, Column: 15, Severity: "error", Message: "expected '}', found 'EOF'"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, diags := goFormat(tt.text)
+			if text != tt.wantText {
+				t.Errorf("goFormat(%q) text = %q, want %q", tt.text, text, tt.wantText)
+			}
+			if !reflect.DeepEqual(diags, tt.wantDiags) {
+				t.Errorf("goFormat(%q) diagnostics = %+v, want %+v", tt.text, diags, tt.wantDiags)
+			}
+		})
+	}
+}
+
+func TestGoTypecheckAndAnalyze(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Diagnostic
+	}{
+		{
+			name: "clean",
+			text: "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n",
+		},
+		{
+			name: "type error",
+			text: "package main\n\nfunc main() {\n\tx := 1\n}\n",
+			want: []Diagnostic{
+				{Tool: "gotype", File: "prog.go", Line: 4, Column: 2, Severity: "error", Message: "declared and not used: x", Context: []string{}},
+			},
+		},
+		{
+			name: "vet",
+			text: "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Printf(\"%d\\n\", \"x\")\n}\n",
+			want: []Diagnostic{
+				{Tool: "go vet", File: "prog.go", Line: 6, Column: 2, EndLine: 6, EndColumn: 25, Severity: "warning", RuleID: "printf", Message: "fmt.Printf format %d has arg \"x\" of wrong type string"},
+			},
+		},
+		{
+			name: "import outside the standard library",
+			text: "package main\n\nimport \"example.com/pkg\"\n\nfunc main() {\n\tpkg.F()\n}\n",
+			want: []Diagnostic{
+				{Tool: "gotype", File: "prog.go", Line: 3, Column: 8, Severity: "error", Message: "import of \"example.com/pkg\" not supported (only standard library packages can be imported)"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			files, pkg, info, diags, err := goTypecheck(context.Background(), fset, []string{"prog.go"}, []string{tt.text})
+			if err != nil {
+				t.Fatalf("goTypecheck returned error: %v", err)
+			}
+			if diags == nil {
+				diags = goAnalyze(fset, files, pkg, info)
+			}
+			if !reflect.DeepEqual(diags, tt.want) {
+				t.Errorf("diagnostics =\n%+v\nwant:\n%+v", diags, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsStdImport(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"fmt", true},
+		{"net/http", true},
+		{"example.com/pkg", false},
+		{"internal/cpu", false},
+		{"net/http/internal", false},
+		{"vendor/golang.org/x/net", false},
+		{"cmd/go", false},
+		{"../pkg", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isStdImport(tt.path); got != tt.want {
+			t.Errorf("isStdImport(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSelectGoAnalyzers(t *testing.T) {
+	tests := []struct {
+		checks  []string
+		want    []string // Analyzer names.
+		wantErr bool
+	}{
+		{checks: nil, want: nil},
+		{checks: []string{"printf"}, want: []string{"printf"}},
+		{checks: []string{"unused*"}, want: []string{"unusedresult"}},
+		{checks: []string{"all", "-printf"}, want: goAnalyzerNames(func(name string) bool { return name != "printf" })},
+		{checks: []string{"all"}, want: goAnalyzerNames(func(string) bool { return true })},
+		{checks: []string{"no-such-check"}, wantErr: true},
+		{checks: []string{"["}, wantErr: true},
+	}
+	for _, tt := range tests {
+		analyzers, err := selectGoAnalyzers(tt.checks)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("selectGoAnalyzers(%q) returned error %v, want error: %v", tt.checks, err, tt.wantErr)
+			continue
+		}
+		var got []string
+		for _, a := range analyzers {
+			got = append(got, a.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("selectGoAnalyzers(%q) = %q, want %q", tt.checks, got, tt.want)
+		}
+	}
+}
+
+// goAnalyzerNames returns the names of the analyzers in goAnalyzers matching
+// f.
+func goAnalyzerNames(f func(name string) bool) []string {
+	var ret []string
+	for _, a := range goAnalyzers {
+		if f(a.Name) {
+			ret = append(ret, a.Name)
+		}
+	}
+	return ret
+}
+
+// TestGoExportDataOnce checks that go list only runs once for several
+// programs, and again if the export data is removed from the build cache.
+func TestGoExportDataOnce(t *testing.T) {
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	// Wrapper counting the executions of the go command.
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$*\" >> %s\nexec %s \"$@\"\n", log, gobin)
+	if err := os.WriteFile(filepath.Join(dir, "go"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+	resetGoExportData()
+	t.Cleanup(resetGoExportData)
+
+	executions := func() int {
+		data, _ := os.ReadFile(log)
+		return strings.Count(string(data), "\n")
+	}
+	typecheck := func(text string) []Diagnostic {
+		t.Helper()
+		_, _, _, diags, err := goTypecheck(context.Background(), token.NewFileSet(), []string{"prog.go"}, []string{text})
+		if err != nil {
+			t.Fatalf("goTypecheck returned error: %v", err)
+		}
+		return diags
+	}
+
+	for _, text := range []string{
+		"package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println()\n}\n",
+		"package main\n\nimport \"os\"\n\nfunc main() {\n\tos.Exit(0)\n}\n",
+		"package main\n\nimport (\n\t\"fmt\"\n\t\"net/http\"\n)\n\nfunc main() {\n\tfmt.Println(http.StatusOK)\n}\n",
+	} {
+		if diags := typecheck(text); diags != nil {
+			t.Errorf("goTypecheck(%q) = %+v, want nil", text, diags)
+		}
+	}
+	if got := executions(); got != 1 {
+		t.Errorf("go command executed %d times, want 1", got)
+	}
+
+	// A removed export data file builds the export data again.
+	goStdExports.mu.Lock()
+	goStdExports.files["fmt"] = filepath.Join(dir, "missing")
+	goStdExports.mu.Unlock()
+	const text = "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println()\n}\n"
+	if diags := typecheck(text); len(diags) == 0 {
+		t.Errorf("goTypecheck(%q) with missing export data = nil, want an import error", text)
+	}
+	if diags := typecheck(text); diags != nil {
+		t.Errorf("goTypecheck(%q) after rebuilding = %+v, want nil", text, diags)
+	}
+	if got := executions(); got != 2 {
+		t.Errorf("go command executed %d times, want 2", got)
+	}
+}
+
+// TestGoAnalyzeSelected checks that disabled analyzers don't report.
+func TestGoAnalyzeSelected(t *testing.T) {
+	defer func(checks []string) { GoVetChecks = checks }(GoVetChecks)
+	GoVetChecks = []string{"all", "-printf"}
+
+	const text = "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Printf(\"%d\\n\", \"x\")\n}\n"
+	fset := token.NewFileSet()
+	files, pkg, info, diags, err := goTypecheck(context.Background(), fset, []string{"prog.go"}, []string{text})
+	if err != nil || diags != nil {
+		t.Fatalf("goTypecheck returned %v and error %v", diags, err)
+	}
+	if diags := goAnalyze(fset, files, pkg, info); diags != nil {
+		t.Errorf("goAnalyze with printf disabled = %+v, want nil", diags)
+	}
+}
@@ -0,0 +1,138 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+//
+// The simplifications are adapted from cmd/gofmt/simplify.go (gofmt -s),
+// which can't be imported. Copyright 2010 The Go Authors. All rights
+// reserved. Use of that source code is governed by a BSD-style license
+// that can be found in the LICENSE file of the Go distribution.
+
+package lang
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// goSimplifier simplifies the code like gofmt -s.
+type goSimplifier struct{}
+
+// Visit implements ast.Visitor.
+func (s goSimplifier) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.CompositeLit:
+		// Array, slice and map composite literals may omit the element (and
+		// key) types.
+		var keyType, eltType ast.Expr
+		switch typ := n.Type.(type) {
+		case *ast.ArrayType:
+			eltType = typ.Elt
+		case *ast.MapType:
+			keyType = typ.Key
+			eltType = typ.Value
+		}
+		if eltType == nil {
+			break
+		}
+		for i, x := range n.Elts {
+			px := &n.Elts[i]
+			if kv, ok := x.(*ast.KeyValueExpr); ok {
+				if keyType != nil {
+					s.simplifyLiteral(keyType, kv.Key, &kv.Key)
+				}
+				x, px = kv.Value, &kv.Value
+			}
+			s.simplifyLiteral(eltType, x, px)
+		}
+		// The elements were simplified above.
+		return nil
+
+	case *ast.SliceExpr:
+		// s[a:len(s)] can be simplified to s[a:], if s is an identifier (and
+		// len isn't redeclared, which is very unlikely).
+		if n.Max != nil {
+			break
+		}
+		if x, ok := n.X.(*ast.Ident); ok {
+			if call, ok := n.High.(*ast.CallExpr); ok && len(call.Args) == 1 && !call.Ellipsis.IsValid() {
+				fun, ok1 := call.Fun.(*ast.Ident)
+				arg, ok2 := call.Args[0].(*ast.Ident)
+				if ok1 && ok2 && fun.Name == "len" && arg.Name == x.Name {
+					n.High = nil
+				}
+			}
+		}
+
+	case *ast.RangeStmt:
+		// "for x, _ = range v" can be simplified to "for x = range v", and
+		// "for _ = range v" to "for range v".
+		if isBlankIdent(n.Value) {
+			n.Value = nil
+		}
+		if isBlankIdent(n.Key) && n.Value == nil {
+			n.Key = nil
+		}
+	}
+	return s
+}
+
+// simplifyLiteral simplifies the element x (stored at px) of a composite
+// literal with element type typ.
+func (s goSimplifier) simplifyLiteral(typ, x ast.Expr, px *ast.Expr) {
+	ast.Walk(s, x)
+
+	// A composite literal of the element type may omit the type.
+	if inner, ok := x.(*ast.CompositeLit); ok && sameTypeExpr(typ, inner.Type) {
+		inner.Type = nil
+	}
+	// If the element type is *T, &T{...} may be simplified to {...}.
+	if ptr, ok := typ.(*ast.StarExpr); ok {
+		if addr, ok := x.(*ast.UnaryExpr); ok && addr.Op == token.AND {
+			if inner, ok := addr.X.(*ast.CompositeLit); ok && sameTypeExpr(ptr.X, inner.Type) {
+				inner.Type = nil
+				*px = inner
+			}
+		}
+	}
+}
+
+// sameTypeExpr returns true if the type expressions a and b are written
+// the same way.
+func sameTypeExpr(a, b ast.Expr) bool {
+	return a != nil && b != nil && types.ExprString(a) == types.ExprString(b)
+}
+
+// isBlankIdent returns true if x is the blank identifier.
+func isBlankIdent(x ast.Expr) bool {
+	ident, ok := x.(*ast.Ident)
+	return ok && ident.Name == "_"
+}
+
+// goSimplify simplifies the code of a parsed file like gofmt -s.
+func goSimplify(f *ast.File) {
+	// Remove empty declarations, like "const ()", without comments.
+	i := 0
+	for _, d := range f.Decls {
+		if g, ok := d.(*ast.GenDecl); !ok || !isEmptyDecl(f, g) {
+			f.Decls[i] = d
+			i++
+		}
+	}
+	f.Decls = f.Decls[:i]
+
+	ast.Walk(goSimplifier{}, f)
+}
+
+// isEmptyDecl returns true if the declaration g in f has no specs and no
+// comments.
+func isEmptyDecl(f *ast.File, g *ast.GenDecl) bool {
+	if g.Doc != nil || g.Specs != nil {
+		return false
+	}
+	for _, c := range f.Comments {
+		if g.Pos() <= c.Pos() && c.End() <= g.End() {
+			return false
+		}
+	}
+	return true
+}
@@ -5,47 +5,48 @@
 package lang
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"log"
-	"net/http"
 	"os"
+)
+
+// Resource limits for the Java tools. The JVM reserves a large amount of
+// virtual memory at startup, so we can't limit the address space.
+var javaLimits = noMemoryLimit
 
-	"github.com/osprogramadores/op-web-linter/common"
-	"github.com/osprogramadores/op-web-linter/handlers"
+// Java runtime and google-java-format jar file.
+const (
+	javaBinary          = "/usr/lib/jvm/java-17-openjdk/bin/java"
+	googleJavaFormatJar = "/home/op/google-java-format-1.24.0-all-deps.jar"
 )
 
+// FingerprintJava identifies the versions of the Java tools, for caching.
+var FingerprintJava = fingerprint([][]string{{javaBinary, "-version"}}, func() []string { return []string{googleJavaFormatJar} })
+
 // LintJava lints programs written in Java. For now, only reformats code with google-java-format.
-func LintJava(w http.ResponseWriter, r *http.Request, req handlers.LintRequest) {
+func LintJava(ctx context.Context, req LintRequest) (LintResponse, error) {
 	// Save program text in request to file.
-	tempdir, tempfile, err := saveRequestToFile(req.Text, "*.java")
+	tempdir, tempfile, err := saveRequestToFile(ctx, req.Text, "*.java")
 	if err != nil {
-		common.HTTPError(w, err.Error(), http.StatusInternalServerError)
-		return
+		return LintResponse{}, err
 	}
 	defer os.RemoveAll(tempdir)
 
-	var messages []string
+	var diags []Diagnostic
 
 	// Reformat source code with google-java-format.
-	reformatted, err := Execute("/usr/lib/jvm/java-17-openjdk/bin/java", "-jar", "/home/op/google-java-format-1.24.0-all-deps.jar", tempfile)
+	reformatted, err := Execute(ctx, tempdir, javaLimits, "google-java-format", javaBinary, "-jar", googleJavaFormatJar, tempfile)
 	if err != nil {
-		messages = append(messages, fmt.Sprintf("Reformat failed: %v", err))
+		diags = append(diags, formatterDiagnostics("google-java-format", fmt.Sprintf("Reformat failed: %v", err), err, reformatted)...)
 	}
 
-	// Create response, convert to JSON and return.
-	resp := handlers.LintResponse{
+	// Create and return response.
+	return LintResponse{
 		Pass:            err == nil,
-		ErrorMessages:   messages,
+		ErrorMessages:   ErrorMessages(diags),
+		Diagnostics:     diags,
 		Reformatted:     reformatted != req.Text && err == nil,
 		ReformattedText: reformatted,
-	}
-	jresp, err := json.Marshal(resp)
-	if err != nil {
-		common.HTTPError(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	log.Printf("JSON response:\n%s", prettyJSONString(jresp))
-	w.Write(jresp)
-	w.Write([]byte("\n"))
+		Formatter:       "google-java-format",
+	}, nil
 }
@@ -5,55 +5,111 @@
 package lang
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"log"
-	"net/http"
 	"os"
 	"regexp"
 	"strings"
-
-	"github.com/osprogramadores/op-web-linter/common"
-	"github.com/osprogramadores/op-web-linter/handlers"
 )
 
 // Regexp matching eslint lines.
+// Sample line:   1:7  error  'x' is assigned a value but never used  no-unused-vars
 var eslintLineRegex = regexp.MustCompile("^[ \t]*([0-9]+):([0-9]+)[ ]*(.*)")
 
-// LintJavascript lints programs written in Javascript.
-func LintJavascript(w http.ResponseWriter, r *http.Request, req handlers.LintRequest) {
-	tempdir, tempfile, err := saveRequestToFile(req.Text, "*.js")
+// Regexp matching the message part of eslint lines (severity, message and rule).
+var eslintMessageRegex = regexp.MustCompile(`^(error|warning)[ ]+(.*?)(?:[ ]{2,}([^ ]+))?$`)
+
+// Regexp matching syntax errors in the prettier output.
+// Sample line: [error] /tmp/123/456.js: SyntaxError: Unexpected token (3:5)
+var prettierErrorRegex = regexp.MustCompile(`SyntaxError: (.*) \(([0-9]+):([0-9]+)\)`)
+
+// Regexp matching the eslint summary line (E.g. "✖ 3 problems (3 errors, 0 warnings)").
+var eslintSummaryRegex = regexp.MustCompile(`^✖ [0-9]+ problems?`)
+
+// Resource limits for the Javascript tools. V8 reserves a large amount of
+// virtual memory at startup, so we can't limit the address space.
+var javascriptLimits = noMemoryLimit
+
+// FingerprintJavascript identifies the versions of the Javascript tools and
+// configuration, for caching.
+var FingerprintJavascript = fingerprint([][]string{{"npx", "prettier", "--version"}, {"npx", "eslint", "--version"}}, func() []string {
+	homedir := os.Getenv("HOME")
+	return []string{homedir + "/op-web-linter/config/prettierrc.json", homedir + "/op-web-linter/config/eslintrc.json"}
+})
+
+// LintJavascript lints programs written in Javascript. Programs are
+// reformatted with prettier, using settings matching the eslint style rules.
+func LintJavascript(ctx context.Context, req LintRequest) (LintResponse, error) {
+	tempdir, tempfile, err := saveRequestToFile(ctx, req.Text, "*.js")
 	if err != nil {
-		common.HTTPError(w, err.Error(), http.StatusInternalServerError)
-		return
+		return LintResponse{}, err
 	}
 	defer os.RemoveAll(tempdir)
 
 	homedir := os.Getenv("HOME")
+	var diags []Diagnostic
+
+	// Reformat source code using prettier. In case of errors, we move ahead
+	// with the old code and attempt linting anyway.
+	reformatted := req.Text
+	out, reformatErr := Execute(ctx, tempdir, javascriptLimits, "prettier", "npx", "prettier", "--no-editorconfig",
+		"--config", homedir+"/op-web-linter/config/prettierrc.json", tempfile)
+	if reformatErr != nil {
+		diags = append(diags, prettierDiagnostics(reformatErr, out)...)
+	} else {
+		// Rewrite reformatted program to tempfile.
+		reformatted = out
+		if err := os.WriteFile(tempfile, []byte(reformatted), 0644); err != nil {
+			return LintResponse{}, err
+		}
+	}
+
+	// Apply the eslint fixes, if requested. The fixed program is linted below.
+	var fix fixResult
+	if req.Fix {
+		fix, err = runFixer(ctx, "eslint", tempdir, tempfile, javascriptLimits, "npx", "eslint", "--fix", "-c", homedir+"/op-web-linter/config/eslintrc.json", tempfile)
+		if err != nil {
+			return LintResponse{}, err
+		}
+		diags = append(diags, fix.diags...)
+	}
+	pass := len(diags) == 0
 
 	// eslint.
 	// --max-warnings 0 makes eslint a return code for any warnings.
-	o, err := Execute("npx", "eslint", "--max-warnings", "0", "-c", homedir+"/op-web-linter/config/eslintrc.json", tempfile)
-	out := strings.Split(o, "\n")
+	o, err := Execute(ctx, tempdir, javascriptLimits, "eslint", "npx", "eslint", "--max-warnings", "0", "-c", homedir+"/op-web-linter/config/eslintrc.json", tempfile)
+	diags = append(diags, JavascriptFilterOutput(strings.Split(o, "\n"), tempfile)...)
+	diags = append(diags, limitDiagnostics("eslint", err)...)
 
-	// Create response, convert to JSON and return.
-	resp := handlers.LintResponse{
-		Pass:          err == nil,
-		ErrorMessages: common.SlicePrefix(JavascriptFilterOutput(out, tempfile), "eslint"),
-	}
-	jresp, err := json.Marshal(resp)
-	if err != nil {
-		common.HTTPError(w, err.Error(), http.StatusInternalServerError)
-		return
+	// Create and return response.
+	return LintResponse{
+		Pass:            pass && err == nil,
+		ErrorMessages:   ErrorMessages(diags),
+		Diagnostics:     setSource(diags, textSource(reformatErr == nil, fix.fixed())),
+		Reformatted:     reformatted != req.Text,
+		ReformattedText: reformatted,
+		Formatter:       "prettier",
+		Fixed:           fix.fixed(),
+		FixedText:       fix.text,
+		Fixes:           fix.edits,
+	}, nil
+}
+
+// prettierDiagnostics returns the diagnostics for a prettier failure. Syntax
+// errors are reported at the position given in the output.
+func prettierDiagnostics(err error, output string) []Diagnostic {
+	diags := formatterDiagnostics("prettier", fmt.Sprintf("Error reformatting Javascript code: %v", err), err, output)
+	if r := prettierErrorRegex.FindStringSubmatch(output); r != nil {
+		diags[0].Line, diags[0].Column = atoi(r[2]), atoi(r[3])
+		diags[0].Message = "Syntax error: " + r[1]
 	}
-	log.Printf("JSON response:\n%s", prettyJSONString(jresp))
-	w.Write(jresp)
-	w.Write([]byte("\n"))
+	return diags
 }
 
-// JavascriptFilterOutput remove undesirable messages from the eslint output.
-func JavascriptFilterOutput(list []string, tempfile string) []string {
-	var ret []string
+// JavascriptFilterOutput remove undesirable messages from the eslint output
+// and converts the remaining lines into diagnostics.
+func JavascriptFilterOutput(list []string, tempfile string) []Diagnostic {
+	var ret []Diagnostic
 	for _, v := range list {
 		// eslint adds a line with the filename.
 		if strings.HasPrefix(v, tempfile) {
@@ -63,19 +119,36 @@ func JavascriptFilterOutput(list []string, tempfile string) []string {
 		if strings.TrimSpace(v) == "" {
 			continue
 		}
-		// Remove lines recommending the --fix option.
+		// Remove lines recommending the --fix option (fixes are
+		// applied with the fix option in the request).
 		if strings.Contains(v, "fixable with the `--fix` option") {
 			continue
 		}
+		// Remove the summary line (the diagnostics already tell the story).
+		if eslintSummaryRegex.MatchString(v) {
+			continue
+		}
 		// Parse line:column message error lines.
 		r := eslintLineRegex.FindStringSubmatch(v)
 
 		// Unable to parse line. Include literally.
 		if len(r) < 4 {
-			ret = append(ret, v)
+			ret = appendUnparsed(ret, "eslint", v)
 			continue
 		}
-		ret = append(ret, fmt.Sprintf("Line %s Col %s: %s", r[1], r[2], r[3]))
+		d := Diagnostic{
+			Tool:    "eslint",
+			Line:    atoi(r[1]),
+			Column:  atoi(r[2]),
+			Message: r[3],
+		}
+		// Split "severity  message  rule", if possible.
+		if m := eslintMessageRegex.FindStringSubmatch(r[3]); m != nil {
+			d.Severity = m[1]
+			d.Message = m[2]
+			d.RuleID = m[3]
+		}
+		ret = append(ret, d)
 	}
 	return ret
 }
@@ -0,0 +1,162 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJavascriptFilterOutput(t *testing.T) {
+	tempfile := "/tmp/lint123/prog456.js"
+	out := strings.Join([]string{
+		"",
+		tempfile,
+		"  1:7   error    'x' is assigned a value but never used  no-unused-vars",
+		"  2:1   warning  Unexpected console statement            no-console",
+		"  3:10  error    Parsing error: Unexpected token",
+		"",
+		"✖ 3 problems (2 errors, 1 warning)",
+		"  1 error and 0 warnings potentially fixable with the `--fix` option.",
+		"",
+	}, "\n")
+
+	want := []Diagnostic{
+		{Tool: "eslint", Line: 1, Column: 7, Severity: "error", Message: "'x' is assigned a value but never used", RuleID: "no-unused-vars"},
+		{Tool: "eslint", Line: 2, Column: 1, Severity: "warning", Message: "Unexpected console statement", RuleID: "no-console"},
+		{Tool: "eslint", Line: 3, Column: 10, Severity: "error", Message: "Parsing error: Unexpected token"},
+	}
+	if got := JavascriptFilterOutput(strings.Split(out, "\n"), tempfile); !reflect.DeepEqual(got, want) {
+		t.Errorf("JavascriptFilterOutput =\n%+v\nwant:\n%+v", got, want)
+	}
+}
+
+func TestPrettierDiagnostics(t *testing.T) {
+	exitErr := exec.Command("false").Run()
+	tests := []struct {
+		name   string
+		output string
+		want   Diagnostic
+	}{
+		{
+			name:   "syntax error",
+			output: "[error] /tmp/123/456.js: SyntaxError: Unexpected token (3:5)\n[error]   1 | x = (\n",
+			want: Diagnostic{
+				Tool:     "prettier",
+				Line:     3,
+				Column:   5,
+				Severity: "error",
+				Message:  "Syntax error: Unexpected token",
+				Context:  []string{"[error] /tmp/123/456.js: SyntaxError: Unexpected token (3:5)", "[error]   1 | x = ("},
+			},
+		},
+		{
+			name:   "other error",
+			output: "npm ERR! could not determine executable to run\n",
+			want: Diagnostic{
+				Tool:     "prettier",
+				Severity: "error",
+				Message:  "Error reformatting Javascript code: exit status 1",
+				Context:  []string{"npm ERR! could not determine executable to run"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := prettierDiagnostics(exitErr, tt.output)
+			if want := []Diagnostic{tt.want}; !reflect.DeepEqual(got, want) {
+				t.Errorf("prettierDiagnostics =\n%+v\nwant:\n%+v", got, want)
+			}
+		})
+	}
+}
+
+// fakeNpx installs an npx script in the PATH running fake versions of
+// prettier (collapsing repeated spaces, failing on "(") and eslint (always
+// passing).
+func fakeNpx(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	script := `#!/bin/sh
+tool=$1
+eval "file=\${$#}"
+case $tool in
+prettier)
+	if grep -q '(' "$file"; then
+		echo "[error] $file: SyntaxError: Unexpected token (1:5)"
+		exit 2
+	fi
+	tr -s ' ' < "$file"
+	;;
+eslint)
+	;;
+*)
+	exit 127
+	;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "npx"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+	t.Setenv("HOME", t.TempDir())
+}
+
+func TestLintJavascript(t *testing.T) {
+	fakeNpx(t)
+	tests := []struct {
+		name            string
+		text            string
+		wantPass        bool
+		wantReformatted bool
+		wantText        string // Reformatted text (not checked if empty).
+		wantMessage     string // Message of the first diagnostic, if any.
+	}{
+		{
+			name:     "formatted",
+			text:     "let x = 1;\n",
+			wantPass: true,
+			wantText: "let x = 1;\n",
+		},
+		{
+			name:            "reformatted",
+			text:            "let  x =  1;\n",
+			wantPass:        true,
+			wantReformatted: true,
+			wantText:        "let x = 1;\n",
+		},
+		{
+			name:        "syntax error",
+			text:        "x = (\n",
+			wantText:    "x = (\n",
+			wantMessage: "Line 1 Col 5: error: Syntax error: Unexpected token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := LintJavascript(context.Background(), LintRequest{Text: tt.text})
+			if err != nil {
+				t.Fatalf("LintJavascript returned error: %v", err)
+			}
+			if resp.Pass != tt.wantPass || resp.Reformatted != tt.wantReformatted || resp.Formatter != "prettier" {
+				t.Errorf("LintJavascript(%q) = %+v, want Pass=%v Reformatted=%v", tt.text, resp, tt.wantPass, tt.wantReformatted)
+			}
+			if tt.wantText != "" && resp.ReformattedText != tt.wantText {
+				t.Errorf("LintJavascript(%q) returned reformatted text %q, want %q", tt.text, resp.ReformattedText, tt.wantText)
+			}
+			var msg string
+			if len(resp.Diagnostics) > 0 {
+				msg = resp.Diagnostics[0].String()
+			}
+			if msg != tt.wantMessage {
+				t.Errorf("LintJavascript(%q) returned first diagnostic %q, want %q", tt.text, msg, tt.wantMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Limits holds the resource limits for a program run by Execute. Zero means
+// no limit.
+type Limits struct {
+	AddressSpace uint64 `json:"addressSpace"` // Maximum address space, in bytes.
+	CPUTime      uint64 `json:"cpuTime"`      // Maximum CPU time, in seconds.
+	Processes    uint64 `json:"processes"`    // Maximum number of processes/threads.
+	FileSize     uint64 `json:"fileSize"`     // Maximum size of files written, in bytes.
+	Output       int    `json:"output"`       // Maximum captured output (stdout + stderr), in bytes.
+}
+
+// DefaultLimits holds the limits for most tools. Languages with special needs
+// define their own limits based on these.
+var DefaultLimits = Limits{
+	AddressSpace: 2 << 30,
+	CPUTime:      10,
+	Processes:    256,
+	FileSize:     64 << 20,
+	Output:       256 << 10,
+}
+
+// noMemoryLimit holds limits for runtimes that reserve large amounts of
+// virtual memory upfront (E.g. V8 and the JVM) and fail to start with an
+// address space limit.
+var noMemoryLimit = Limits{
+	CPUTime:   DefaultLimits.CPUTime,
+	Processes: DefaultLimits.Processes,
+	FileSize:  DefaultLimits.FileSize,
+	Output:    DefaultLimits.Output,
+}
+
+// Regexps matching typical messages printed by programs when they run out of
+// memory, processes or file size. Limits on those resources make system calls
+// fail instead of killing the program, but the output may echo the program
+// (E.g. in diagnostics), so these are only a last resort (see outputLimit).
+var (
+	memoryLimitRegex  = regexp.MustCompile(`(?i)(out of memory|cannot allocate memory|bad_alloc|memory exhausted|MemoryError)`)
+	processLimitRegex = regexp.MustCompile(`(?i)(resource temporarily unavailable|cannot fork|fork: retry|failed to create new OS thread)`)
+	fileSizeRegex     = regexp.MustCompile(`(?i)(file too large|file size limit exceeded)`)
+)
+
+// LimitError is returned by Execute when a program exceeds one of its
+// resource limits.
+type LimitError struct {
+	Limit string // Limit exceeded (E.g. "CPU time").
+	Value string // Value of the limit, in human readable form.
+}
+
+// Error returns the error message.
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded (%s)", e.Limit, e.Value)
+}
+
+// TimeoutError is returned by Execute when a program runs for longer than
+// the timeout.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+// Error returns the error message.
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %v", e.Timeout)
+}
+
+// SignalError is returned for programs run by Run that were killed by a
+// signal, other than for exceeding the limits (E.g. segmentation faults).
+type SignalError struct {
+	Signal syscall.Signal
+}
+
+// Error returns the error message.
+func (e *SignalError) Error() string {
+	return fmt.Sprintf("killed by signal: %v", e.Signal)
+}
+
+// Programs that fail with a peak resident memory of at least this percentage
+// of the address space limit have exceeded the memory limit. Some runtimes
+// (E.g. Go) reserve much more address space than they use.
+const memoryLimitPercent = 40
+
+// checkLimits examines the outcome of a command, killed by sig (zero if it
+// exited normally) after using up to peak bytes of resident memory, and
+// returns a *LimitError if the command exceeded one of the limits. Limits are
+// only detected from the kernel (signals and resource usage), never from the
+// output. Returns the original error otherwise.
+func checkLimits(limits Limits, state *os.ProcessState, peak int64, sig syscall.Signal, err error, truncated bool) error {
+	if truncated {
+		return &LimitError{Limit: "output", Value: byteCount(uint64(limits.Output))}
+	}
+	if err == nil || state == nil {
+		return err
+	}
+	// Shells (and other wrappers) exit with 128 plus the number of the
+	// signal that killed their child. The kernel only sends SIGXCPU and
+	// SIGXFSZ for exceeding the limits.
+	if code := state.ExitCode(); sig == 0 && code > 128 {
+		switch s := syscall.Signal(code - 128); s {
+		case sigXCPU, sigXFSZ:
+			sig = s
+		}
+	}
+
+	switch {
+	case cpuLimitExceeded(limits, state, sig):
+		return &LimitError{Limit: "CPU time", Value: fmt.Sprintf("%ds", limits.CPUTime)}
+	case limits.FileSize > 0 && sig == sigXFSZ:
+		return &LimitError{Limit: "file size", Value: byteCount(limits.FileSize)}
+	case limits.AddressSpace > 0 && uint64(peak) >= limits.AddressSpace/100*memoryLimitPercent:
+		return &LimitError{Limit: "memory", Value: byteCount(limits.AddressSpace)}
+	}
+	return err
+}
+
+// checkProgramLimits is like checkLimits, for the programs run by Run. Other
+// signals (E.g. segmentation faults) are returned as a *SignalError.
+func checkProgramLimits(limits Limits, state *os.ProcessState, peak int64, sig syscall.Signal, err error, truncated bool) error {
+	err = checkLimits(limits, state, peak, sig, err, truncated)
+	if _, ok := err.(*LimitError); !ok && err != nil && sig != 0 {
+		return &SignalError{Signal: sig}
+	}
+	return err
+}
+
+// outputLimit returns the limit that a tool that failed with err seems to
+// have exceeded (E.g. "memory"), going by its output, or "" if none. The
+// output may echo the program, so only use it for tools that failed without
+// reporting any diagnostics.
+func outputLimit(err error, out string) string {
+	if _, ok := err.(*exec.ExitError); !ok {
+		return ""
+	}
+	switch {
+	case memoryLimitRegex.MatchString(out):
+		return "memory"
+	case processLimitRegex.MatchString(out):
+		return "process count"
+	case fileSizeRegex.MatchString(out):
+		return "file size"
+	}
+	return ""
+}
+
+// exitSignal returns the signal that killed a process, or zero if it exited
+// normally (or didn't start).
+func exitSignal(state *os.ProcessState) syscall.Signal {
+	if state == nil {
+		return 0
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return status.Signal()
+	}
+	return 0
+}
+
+// cpuLimitExceeded returns true if a process killed by sig exceeded its CPU
+// time limit: the soft limit sends SIGXCPU, and the hard limit SIGKILL.
+func cpuLimitExceeded(limits Limits, state *os.ProcessState, sig syscall.Signal) bool {
+	cpu := state.UserTime() + state.SystemTime()
+	return limits.CPUTime > 0 && (sig == sigXCPU || (sig == syscall.SIGKILL && cpu >= time.Duration(limits.CPUTime)*time.Second))
+}
+
+// limitDiagnostics returns a diagnostic for the tool if err indicates that
+// it exceeded a resource limit or timed out, or nil otherwise. Use it where
+// the errors returned by Execute would be otherwise ignored.
+func limitDiagnostics(tool string, err error) []Diagnostic {
+	var msg string
+	switch err.(type) {
+	case *LimitError:
+		msg = fmt.Sprintf("%s aborted: %v", tool, err)
+	case *TimeoutError:
+		msg = fmt.Sprintf("%s %v", tool, err)
+	default:
+		return nil
+	}
+	return []Diagnostic{{
+		Tool:     tool,
+		Severity: "error",
+		RuleID:   limitRuleID(err),
+		Message:  msg,
+	}}
+}
+
+// limitRuleID returns the diagnostic rule ID for errors indicating that a
+// tool exceeded a resource limit or timed out, or "" for other errors.
+func limitRuleID(err error) string {
+	switch err.(type) {
+	case *LimitError:
+		return RuleResourceLimit
+	case *TimeoutError:
+		return RuleTimeout
+	}
+	return ""
+}
+
+// byteCount returns a human readable representation of a number of bytes.
+func byteCount(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// limitedBuffer is an io.Writer that keeps up to max bytes and calls
+// onLimit (once) when more data is written. Writes never fail, so the
+// program is not disturbed before being killed.
+type limitedBuffer struct {
+	mu        sync.Mutex
+	buf       []byte
+	max       int
+	truncated bool
+	onLimit   func()
+}
+
+// Write appends data to the buffer, up to the limit.
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.max <= 0 || len(b.buf)+len(p) <= b.max {
+		b.buf = append(b.buf, p...)
+		return len(p), nil
+	}
+	b.buf = append(b.buf, p[:b.max-len(b.buf)]...)
+	if !b.truncated {
+		b.truncated = true
+		if b.onLimit != nil {
+			b.onLimit()
+		}
+	}
+	return len(p), nil
+}
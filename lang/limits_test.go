@@ -0,0 +1,348 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/osprogramadores/op-web-linter/metrics"
+)
+
+func TestCheckLimits(t *testing.T) {
+	limits := Limits{AddressSpace: 1 << 30, CPUTime: 5, Processes: 10, FileSize: 1 << 20, Output: 1024}
+
+	tests := []struct {
+		name      string
+		script    string
+		limits    Limits
+		peak      int64
+		truncated bool
+		want      *LimitError // nil means the original error.
+	}{
+		{
+			name:   "success",
+			script: "exit 0",
+			limits: limits,
+		},
+		{
+			name:   "plain failure",
+			script: "echo failed; exit 1",
+			limits: limits,
+		},
+		{
+			name:      "output",
+			script:    "exit 0",
+			limits:    limits,
+			truncated: true,
+			want:      &LimitError{Limit: "output", Value: "1.0 KiB"},
+		},
+		{
+			name:   "cpu time",
+			script: "kill -XCPU $$",
+			limits: limits,
+			want:   &LimitError{Limit: "CPU time", Value: "5s"},
+		},
+		{
+			name:   "file size",
+			script: "kill -XFSZ $$",
+			limits: limits,
+			want:   &LimitError{Limit: "file size", Value: "1.0 MiB"},
+		},
+		{
+			name:   "file size in a child",
+			script: "exit 153", // 128 + SIGXFSZ, like shells do.
+			limits: limits,
+			want:   &LimitError{Limit: "file size", Value: "1.0 MiB"},
+		},
+		{
+			name:   "peak memory",
+			script: "kill -SEGV $$",
+			limits: limits,
+			peak:   512 << 20,
+			want:   &LimitError{Limit: "memory", Value: "1.0 GiB"},
+		},
+		{
+			name:   "segmentation fault below the memory limit",
+			script: "kill -SEGV $$",
+			limits: limits,
+			peak:   16 << 20,
+		},
+		{
+			name:   "memory message is not trusted",
+			script: "echo 'fatal: Cannot allocate memory'; exit 1",
+			limits: limits,
+		},
+		{
+			name:   "process message is not trusted",
+			script: "echo 'sh: fork: retry: Resource temporarily unavailable'; exit 1",
+			limits: limits,
+		},
+		{
+			name:   "signal without limit",
+			script: "kill -SEGV $$",
+			peak:   512 << 20,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command("sh", "-c", tt.script)
+			_, err := cmd.CombinedOutput()
+			got := checkLimits(tt.limits, cmd.ProcessState, tt.peak, exitSignal(cmd.ProcessState), err, tt.truncated)
+
+			if tt.want == nil {
+				if got != err {
+					t.Errorf("checkLimits(%q) = %v, want %v", tt.script, got, err)
+				}
+				return
+			}
+			var lerr *LimitError
+			if !errors.As(got, &lerr) || *lerr != *tt.want {
+				t.Errorf("checkLimits(%q) = %v, want %v", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputLimit(t *testing.T) {
+	exitErr := exec.Command("false").Run()
+	tests := []struct {
+		err  error
+		out  string
+		want string
+	}{
+		{exitErr, "fatal: Cannot allocate memory", "memory"},
+		{exitErr, "terminate called after throwing an instance of 'std::bad_alloc'", "memory"},
+		{exitErr, "sh: fork: retry: Resource temporarily unavailable", "process count"},
+		{exitErr, "write: File too large", "file size"},
+		{exitErr, "syntax error", ""},
+		{nil, "out of memory", ""},
+		{errors.New("not found"), "out of memory", ""},
+	}
+	for _, tt := range tests {
+		if got := outputLimit(tt.err, tt.out); got != tt.want {
+			t.Errorf("outputLimit(%v, %q) = %q, want %q", tt.err, tt.out, got, tt.want)
+		}
+	}
+}
+
+func TestCheckProgramLimits(t *testing.T) {
+	limits := Limits{AddressSpace: 100 << 20, CPUTime: 5, FileSize: 1 << 20, Output: 1024}
+
+	tests := []struct {
+		name      string
+		script    string
+		peak      int64
+		truncated bool
+		want      error // nil means the original error.
+	}{
+		{
+			name:   "success",
+			script: "exit 0",
+		},
+		{
+			name:   "plain failure",
+			script: "exit 1",
+		},
+		{
+			name:   "output message is not trusted",
+			script: "echo 'Cannot allocate memory'; exit 1",
+		},
+		{
+			name:      "output",
+			script:    "exit 0",
+			truncated: true,
+			want:      &LimitError{Limit: "output", Value: "1.0 KiB"},
+		},
+		{
+			name:   "cpu time",
+			script: "kill -XCPU $$",
+			want:   &LimitError{Limit: "CPU time", Value: "5s"},
+		},
+		{
+			name:   "file size",
+			script: "kill -XFSZ $$",
+			want:   &LimitError{Limit: "file size", Value: "1.0 MiB"},
+		},
+		{
+			name:   "peak memory",
+			script: "exit 1",
+			peak:   64 << 20,
+			want:   &LimitError{Limit: "memory", Value: "100.0 MiB"},
+		},
+		{
+			name:   "peak memory below the limit",
+			script: "exit 1",
+			peak:   16 << 20,
+		},
+		{
+			name:   "segmentation fault",
+			script: "kill -SEGV $$",
+			want:   &SignalError{Signal: syscall.SIGSEGV},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command("sh", "-c", tt.script)
+			_, err := cmd.CombinedOutput()
+			got := checkProgramLimits(limits, cmd.ProcessState, tt.peak, exitSignal(cmd.ProcessState), err, tt.truncated)
+
+			want := tt.want
+			if want == nil {
+				want = err
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("checkProgramLimits(%q) = %v, want %v", tt.script, got, want)
+			}
+		})
+	}
+}
+
+func TestToolStatus(t *testing.T) {
+	tests := []struct {
+		in     string
+		sig    syscall.Signal
+		peak   int64
+		wantOK bool
+	}{
+		{"", 0, 0, false},
+		{"0 1048576", 0, 1 << 20, true},
+		{"11 4096", syscall.SIGSEGV, 4096, true},
+		{"11", 0, 0, false},
+		{"junk", 0, 0, false},
+	}
+	for _, tt := range tests {
+		sig, peak, ok := toolStatus(strings.NewReader(tt.in))
+		if sig != tt.sig || peak != tt.peak || ok != tt.wantOK {
+			t.Errorf("toolStatus(%q) = %v, %d, %v, want %v, %d, %v", tt.in, sig, peak, ok, tt.sig, tt.peak, tt.wantOK)
+		}
+	}
+}
+
+func TestExecuteLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		script string
+		want   string // Limit exceeded.
+	}{
+		{
+			name:   "output",
+			limits: Limits{Output: 100},
+			script: "while :; do echo output; done",
+			want:   "output",
+		},
+		{
+			name:   "cpu time",
+			limits: Limits{CPUTime: 1},
+			script: "while :; do :; done",
+			want:   "CPU time",
+		},
+		{
+			name:   "file size",
+			limits: Limits{FileSize: 1000},
+			script: "head -c 2000 /dev/zero > big",
+			want:   "file size",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Execute(context.Background(), t.TempDir(), tt.limits, "sh", "sh", "-c", tt.script)
+			var lerr *LimitError
+			if !errors.As(err, &lerr) || lerr.Limit != tt.want {
+				t.Fatalf("Execute(%q) = %v, want %s limit exceeded", tt.script, err, tt.want)
+			}
+			if tt.limits.Output > 0 && len(out) > tt.limits.Output {
+				t.Errorf("Execute(%q) returned %d bytes of output, want at most %d", tt.script, len(out), tt.limits.Output)
+			}
+		})
+	}
+}
+
+func TestExecuteMetrics(t *testing.T) {
+	if _, err := Execute(context.Background(), t.TempDir(), Limits{}, "test-tool", "/bin/sh", "-c", "true"); err != nil {
+		t.Fatalf("Execute() = %v, want nil", err)
+	}
+
+	var buf bytes.Buffer
+	if err := metrics.WriteTo(&buf); err != nil {
+		t.Fatalf("metrics.WriteTo() = %v", err)
+	}
+	want := `op_web_linter_execute_duration_seconds_count{tool="test-tool"} 1`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("metrics do not contain %q:\n%s", want, buf.String())
+	}
+}
+
+func TestLimitDiagnostics(t *testing.T) {
+	tests := []struct {
+		err  error
+		want []Diagnostic
+	}{
+		{nil, nil},
+		{errors.New("exit status 1"), nil},
+		{
+			&LimitError{Limit: "memory", Value: "2.0 GiB"},
+			[]Diagnostic{{Tool: "gcc", Severity: "error", RuleID: RuleResourceLimit, Message: "gcc aborted: memory limit exceeded (2.0 GiB)"}},
+		},
+		{
+			&TimeoutError{Timeout: 15 * time.Second},
+			[]Diagnostic{{Tool: "gcc", Severity: "error", RuleID: RuleTimeout, Message: "gcc timed out after 15s"}},
+		},
+	}
+	for _, tt := range tests {
+		if got := limitDiagnostics("gcc", tt.err); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("limitDiagnostics(%v) = %+v, want %+v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestByteCount(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{64 << 20, "64.0 MiB"},
+		{2 << 30, "2.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := byteCount(tt.n); got != tt.want {
+			t.Errorf("byteCount(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	calls := 0
+	b := &limitedBuffer{max: 5, onLimit: func() { calls++ }}
+	for _, s := range []string{"abc", "def", "ghi"} {
+		if n, err := b.Write([]byte(s)); n != len(s) || err != nil {
+			t.Errorf("Write(%q) = %d, %v, want %d, nil", s, n, err, len(s))
+		}
+	}
+	if got := string(b.buf); got != "abcde" {
+		t.Errorf("buffer = %q, want %q", got, "abcde")
+	}
+	if !b.truncated || calls != 1 {
+		t.Errorf("truncated = %v, onLimit calls = %d, want true, 1", b.truncated, calls)
+	}
+
+	// No limit.
+	b = &limitedBuffer{}
+	b.Write([]byte("abcdef"))
+	if got := string(b.buf); got != "abcdef" || b.truncated {
+		t.Errorf("buffer without limit = %q (truncated: %v), want %q", got, b.truncated, "abcdef")
+	}
+}
@@ -0,0 +1,301 @@
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/osprogramadores/op-web-linter/common"
+)
+
+// ErrUnknownLanguage is returned when linting programs in unsupported languages.
+var ErrUnknownLanguage = errors.New("unknown language")
+
+// LintRequest contains a request to lint a source program.
+type LintRequest struct {
+	Text string `json:"text"` // Text of the program (not escaped).
+	Lang string `json:"lang"` // Language (must be one of the supported languages).
+	Fix  bool   `json:"fix"`  // Run the autofix modes of the linters (where available).
+
+	// Files of a multi-file program, used instead of Text.
+	Files []File `json:"files,omitempty"`
+
+	// Challenge whose house rules the program must follow (optional).
+	Challenge string `json:"challenge,omitempty"`
+}
+
+// LintResponse contains a response to a lint request.
+type LintResponse struct {
+	Pass            bool           // Pass or not?
+	ErrorMessages   []string       // Human readable messages (derived from Diagnostics).
+	Diagnostics     []Diagnostic   // Structured messages from the reformatter and linters.
+	Reformatted     bool           // Was the program reformatted?
+	ReformattedText string         // Reformatted program code.
+	Formatter       string         // Tool used to reformat the program (if any).
+	Diff            string         `json:",omitempty"` // Unified diff from the program to ReformattedText.
+	Hunks           []Hunk         `json:",omitempty"` // Changes in Diff, one entry per hunk.
+	Fixed           bool           // Were problems fixed automatically (only if requested)?
+	FixedText       string         `json:",omitempty"` // Program code after reformatting and fixing.
+	Fixes           []FixEdit      `json:",omitempty"` // Changes made by the fixers, in order.
+	Files           []FileResponse `json:",omitempty"` // Results per file (multi-file requests only).
+	Cached          bool           // Response served from the cache?
+}
+
+// Rule IDs for diagnostics reporting that a tool was aborted.
+const (
+	RuleTimeout       = "timeout"        // Tool ran for too long.
+	RuleResourceLimit = "resource-limit" // Tool exceeded a resource limit.
+)
+
+// Diagnostic contains a single message emitted by one of the tools. Line
+// and column numbers start at 1. A zero means the tool did not report it.
+type Diagnostic struct {
+	Tool            string   // Tool that emitted the message (E.g. "clang-tidy").
+	File            string   // File the message refers to (multi-file requests only).
+	Line            int      // Line number.
+	Column          int      // Column number.
+	EndLine         int      // Line number where the affected region ends.
+	EndColumn       int      // Column number where the affected region ends.
+	Severity        string   // Severity ("error", "warning", "note", etc).
+	RuleID          string   // Rule or check that triggered the message.
+	Message         string   // Message text, as emitted by the tool.
+	Context         []string // Additional lines emitted by the tool (source excerpts, notes).
+	Source          string   // Text the positions refer to (one of the Source constants).
+	OriginalLine    int      // Line translated to the original text.
+	OriginalEndLine int      // EndLine translated to the original text.
+}
+
+// Texts that diagnostic positions refer to.
+const (
+	SourceOriginal    = "original"    // Program text as submitted.
+	SourceReformatted = "reformatted" // Program text after reformatting (ReformattedText).
+	SourceFixed       = "fixed"       // Program text after reformatting and fixing (FixedText).
+)
+
+// String returns the diagnostic formatted as a single line of text.
+func (d Diagnostic) String() string {
+	var sb strings.Builder
+	if d.File != "" {
+		sb.WriteString(d.File + ": ")
+	}
+	switch {
+	case d.Line > 0 && d.Column > 0:
+		fmt.Fprintf(&sb, "Line %d Col %d: ", d.Line, d.Column)
+	case d.Line > 0:
+		fmt.Fprintf(&sb, "Line %d: ", d.Line)
+	}
+	if d.Severity != "" {
+		sb.WriteString(d.Severity + ": ")
+	}
+	sb.WriteString(d.Message)
+	if d.RuleID != "" {
+		fmt.Fprintf(&sb, " [%s]", d.RuleID)
+	}
+	return sb.String()
+}
+
+// ErrorMessages converts a slice of diagnostics into human readable messages,
+// prefixed by the name of the tool that emitted them. Used to fill the
+// ErrorMessages field in LintResponse.
+func ErrorMessages(diags []Diagnostic) []string {
+	var ret []string
+	for _, d := range diags {
+		lines := append([]string{d.String()}, d.Context...)
+		ret = append(ret, common.SlicePrefix(lines, d.Tool)...)
+	}
+	return ret
+}
+
+// Linter lints programs written in one language.
+type Linter interface {
+	Lint(ctx context.Context, req LintRequest) (LintResponse, error)
+}
+
+// LinterFunc adapts an ordinary function to the Linter interface.
+type LinterFunc func(ctx context.Context, req LintRequest) (LintResponse, error)
+
+// Lint calls f(ctx, req).
+func (f LinterFunc) Lint(ctx context.Context, req LintRequest) (LintResponse, error) {
+	return f(ctx, req)
+}
+
+// Language contains details for a single language.
+type Language struct {
+	Display     string        // User visible name.
+	Extension   string        // File extension (without the dot).
+	Linter      Linter        // Linter for the language.
+	Fingerprint func() string // Identifies tool versions and configuration (optional, used for caching; "" if unknown).
+	MultiFile   bool          // Linter lints the files of multi-file requests together (otherwise, one at a time).
+	Runner      Runner        // Builds and runs programs against test cases (optional).
+}
+
+// Languages holds a set of supported languages, keyed by name.
+type Languages map[string]Language
+
+// DefaultLanguages returns a new set containing the built-in languages.
+func DefaultLanguages() Languages {
+	return Languages{
+		"bash":       {Display: "Bash", Extension: "sh", Linter: LinterFunc(LintBash), Fingerprint: FingerprintBash},
+		"c":          {Display: "C", Extension: "c", Linter: LinterFunc(LintC), Fingerprint: FingerprintC, MultiFile: true, Runner: cRunner},
+		"cpp":        {Display: "C++", Extension: "cpp", Linter: LinterFunc(LintCPP), Fingerprint: FingerprintCPP, MultiFile: true, Runner: cppRunner},
+		"golang":     {Display: "Go", Extension: "go", Linter: LinterFunc(LintGo), Fingerprint: FingerprintGo, MultiFile: true, Runner: goRunner},
+		"java":       {Display: "Java  (reformat only)", Extension: "java", Linter: LinterFunc(LintJava), Fingerprint: FingerprintJava, Runner: javaRunner},
+		"javascript": {Display: "Javascript", Extension: "js", Linter: LinterFunc(LintJavascript), Fingerprint: FingerprintJavascript, Runner: javascriptRunner},
+		"python":     {Display: "Python", Extension: "py", Linter: LinterFunc(LintPython), Fingerprint: FingerprintPython, Runner: pythonRunner},
+		"rust":       {Display: "Rust", Extension: "rs", Linter: LinterFunc(LintRust), Fingerprint: FingerprintRust},
+		"typescript": {Display: "TypeScript", Extension: "ts", Linter: LinterFunc(LintTypescript), Fingerprint: FingerprintTypescript},
+	}
+}
+
+// Built-in languages, used by Lint.
+var defaultLanguages = DefaultLanguages()
+
+// Lint lints a program written in one of the built-in languages, as given
+// by req.Lang. Returns ErrUnknownLanguage for unsupported languages.
+func Lint(ctx context.Context, req LintRequest) (LintResponse, error) {
+	return defaultLanguages.Lint(ctx, req)
+}
+
+// Lint lints a program written in one of the languages in the set, as given
+// by req.Lang. If the program was reformatted, the response includes the
+// differences, and diagnostic lines are translated back to the original
+// text. Multi-file requests (with Files instead of Text) have the
+// differences in each file. Requests selecting a challenge are also checked
+// against its house rules. Returns ErrUnknownLanguage for unsupported
+// languages, ErrUnknownChallenge for unknown challenges, and ErrInvalidFiles
+// for invalid multi-file requests.
+func (l Languages) Lint(ctx context.Context, req LintRequest) (LintResponse, error) {
+	language, ok := l.Get(req.Lang)
+	if !ok {
+		return LintResponse{}, fmt.Errorf("%w: %q", ErrUnknownLanguage, req.Lang)
+	}
+	challenge, err := lookupChallenge(req.Challenge)
+	if err != nil {
+		return LintResponse{}, err
+	}
+	if len(req.Files) > 0 {
+		return l.lintFiles(ctx, language, challenge, req)
+	}
+	resp, err := language.Linter.Lint(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	checkChallenge(&resp, challenge, req.Lang, []File{{Text: req.Text}})
+	if resp.Reformatted {
+		resp.Diff, resp.Hunks = Diff("original", "reformatted", req.Text, resp.ReformattedText)
+	}
+	mapOriginalLines(&resp, func(string) (string, string, string) {
+		return req.Text, resp.ReformattedText, resp.FixedText
+	})
+	return resp, nil
+}
+
+// lintFiles lints a multi-file request.
+func (l Languages) lintFiles(ctx context.Context, language Language, challenge *Challenge, req LintRequest) (LintResponse, error) {
+	if err := checkFiles(req.Files); err != nil {
+		return LintResponse{}, err
+	}
+	var (
+		resp LintResponse
+		err  error
+	)
+	if language.MultiFile {
+		resp, err = language.Linter.Lint(ctx, req)
+	} else {
+		resp, err = lintEachFile(ctx, language, req)
+	}
+	if err != nil {
+		return resp, err
+	}
+	checkChallenge(&resp, challenge, req.Lang, req.Files)
+
+	original := map[string]string{}
+	for _, f := range req.Files {
+		original[f.Path] = f.Text
+	}
+	files := map[string]*FileResponse{}
+	for i := range resp.Files {
+		f := &resp.Files[i]
+		if f.Reformatted {
+			f.Diff, f.Hunks = Diff(f.Path, f.Path, original[f.Path], f.ReformattedText)
+		}
+		files[f.Path] = f
+	}
+	mapOriginalLines(&resp, func(path string) (string, string, string) {
+		if f, ok := files[path]; ok {
+			return original[path], f.ReformattedText, f.FixedText
+		}
+		return original[path], "", ""
+	})
+	return resp, nil
+}
+
+// Get returns the named language. Returns false if the language is not in
+// the set or has no linter.
+func (l Languages) Get(name string) (Language, bool) {
+	language, ok := l[name]
+	return language, ok && language.Linter != nil
+}
+
+// Names returns the sorted names of all languages in the set.
+func (l Languages) Names() []string {
+	var names []string
+	for name, language := range l {
+		if language.Linter != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mapOriginalLines fills the original line numbers of all diagnostics in the
+// response, translating lines that refer to the reformatted or fixed text.
+// Lines added by the tools are translated to the closest line in the
+// original text. The texts function returns the original, reformatted and
+// fixed texts of a file (given by Diagnostic.File).
+func mapOriginalLines(resp *LintResponse, texts func(file string) (string, string, string)) {
+	lines := map[[2]string][]int{}
+	for i := range resp.Diagnostics {
+		d := &resp.Diagnostics[i]
+		if d.Source == "" {
+			d.Source = SourceOriginal
+		}
+		if d.Source == SourceOriginal {
+			d.OriginalLine, d.OriginalEndLine = d.Line, d.EndLine
+			continue
+		}
+		key := [2]string{d.File, d.Source}
+		if lines[key] == nil {
+			original, reformatted, fixed := texts(d.File)
+			text := reformatted
+			if d.Source == SourceFixed {
+				text = fixed
+			}
+			lines[key] = lineMap(original, text)
+		}
+		d.OriginalLine = translateLine(lines[key], d.Line)
+		d.OriginalEndLine = translateLine(lines[key], d.EndLine)
+	}
+}
+
+// translateLine translates a line number using a map returned by lineMap.
+// Lines past the end of the text (E.g. "unexpected EOF") keep their distance
+// to the last line.
+func translateLine(lines []int, line int) int {
+	switch {
+	case line <= 0:
+		return 0
+	case line > len(lines) && len(lines) > 0:
+		return lines[len(lines)-1] + line - len(lines)
+	case line > len(lines):
+		return line
+	}
+	return lines[line-1]
+}
@@ -0,0 +1,276 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// headerLinter is a fake linter that reformats programs by adding a header
+// line, and reports a problem on the first line of the original program
+// (the second line of the reformatted text).
+var headerLinter = LinterFunc(func(ctx context.Context, req LintRequest) (LintResponse, error) {
+	if strings.Contains(req.Text, "fail") {
+		return LintResponse{}, errors.New("linter failed")
+	}
+	text := "// header\n" + req.Text
+	diags := []Diagnostic{{
+		Tool:     "fake",
+		Line:     2,
+		Severity: "warning",
+		Message:  "first line",
+		Source:   SourceReformatted,
+	}}
+	return LintResponse{
+		Diagnostics:     diags,
+		ErrorMessages:   ErrorMessages(diags),
+		Reformatted:     true,
+		ReformattedText: text,
+		Formatter:       "fake",
+	}, nil
+})
+
+// testLanguages returns a set of fake languages for the tests.
+func testLanguages() Languages {
+	return Languages{
+		"fake":   {Display: "Fake", Extension: "fk", Linter: headerLinter},
+		"multi":  {Display: "Multi", Extension: "fk", Linter: headerLinter, MultiFile: true},
+		"nolint": {Display: "No linter", Extension: "nl"},
+	}
+}
+
+func TestLanguagesGet(t *testing.T) {
+	languages := testLanguages()
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"fake", true},
+		{"nolint", false},
+		{"unknown", false},
+	}
+	for _, tt := range tests {
+		if _, got := languages.Get(tt.name); got != tt.want {
+			t.Errorf("Get(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if got, want := languages.Names(), []string{"fake", "multi"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+}
+
+func TestDefaultLanguages(t *testing.T) {
+	want := []string{"bash", "c", "cpp", "golang", "java", "javascript", "python", "rust", "typescript"}
+	if got := DefaultLanguages().Names(); !reflect.DeepEqual(got, want) {
+		t.Errorf("DefaultLanguages().Names() = %v, want %v", got, want)
+	}
+}
+
+func TestLint(t *testing.T) {
+	resp, err := testLanguages().Lint(context.Background(), LintRequest{Text: "a\nb\n", Lang: "fake"})
+	if err != nil {
+		t.Fatalf("Lint returned error: %v", err)
+	}
+	if want := "// header\na\nb\n"; !resp.Reformatted || resp.ReformattedText != want {
+		t.Errorf("Lint returned reformatted text %q, want %q", resp.ReformattedText, want)
+	}
+	if want := []string{"[fake] Line 2: warning: first line"}; !reflect.DeepEqual(resp.ErrorMessages, want) {
+		t.Errorf("Lint returned messages %q, want %q", resp.ErrorMessages, want)
+	}
+	if want := "--- original\n+++ reformatted\n@@ -1,2 +1,3 @@\n+// header\n a\n b\n"; resp.Diff != want {
+		t.Errorf("Lint diff =\n%s\nwant:\n%s", resp.Diff, want)
+	}
+	if len(resp.Hunks) != 1 {
+		t.Errorf("Lint returned %d hunks, want 1", len(resp.Hunks))
+	}
+	if len(resp.Diagnostics) != 1 {
+		t.Fatalf("Lint returned %d diagnostics, want 1", len(resp.Diagnostics))
+	}
+	if d := resp.Diagnostics[0]; d.Line != 2 || d.OriginalLine != 1 {
+		t.Errorf("Lint diagnostic has line %d (original %d), want 2 (original 1)", d.Line, d.OriginalLine)
+	}
+
+	if _, err := testLanguages().Lint(context.Background(), LintRequest{Text: "fail\n", Lang: "fake"}); err == nil {
+		t.Errorf("Lint with a failing linter returned no error")
+	}
+}
+
+func TestLintErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		req  LintRequest
+		want error
+	}{
+		{
+			name: "unknown language",
+			req:  LintRequest{Text: "a\n", Lang: "unknown"},
+			want: ErrUnknownLanguage,
+		},
+		{
+			name: "language without linter",
+			req:  LintRequest{Text: "a\n", Lang: "nolint"},
+			want: ErrUnknownLanguage,
+		},
+		{
+			name: "unknown challenge",
+			req:  LintRequest{Text: "a\n", Lang: "fake", Challenge: "no-such-challenge"},
+			want: ErrUnknownChallenge,
+		},
+		{
+			name: "invalid path",
+			req:  LintRequest{Lang: "fake", Files: []File{{Path: "../a.fk", Text: "a\n"}}},
+			want: ErrInvalidFiles,
+		},
+		{
+			name: "absolute path",
+			req:  LintRequest{Lang: "fake", Files: []File{{Path: "/a.fk", Text: "a\n"}}},
+			want: ErrInvalidFiles,
+		},
+		{
+			name: "unclean path",
+			req:  LintRequest{Lang: "fake", Files: []File{{Path: "a/./b.fk", Text: "a\n"}}},
+			want: ErrInvalidFiles,
+		},
+		{
+			name: "duplicate path",
+			req:  LintRequest{Lang: "fake", Files: []File{{Path: "a.fk", Text: "a\n"}, {Path: "a.fk", Text: "b\n"}}},
+			want: ErrInvalidFiles,
+		},
+		{
+			name: "file and directory",
+			req:  LintRequest{Lang: "multi", Files: []File{{Path: "a", Text: "a\n"}, {Path: "a/b/c.fk", Text: "b\n"}}},
+			want: ErrInvalidFiles,
+		},
+		{
+			name: "too many files",
+			req:  LintRequest{Lang: "fake", Files: make([]File, MaxFiles+1)},
+			want: ErrInvalidFiles,
+		},
+		{
+			name: "files too large",
+			req:  LintRequest{Lang: "fake", Files: []File{{Path: "a.fk", Text: strings.Repeat("a", MaxFilesSize+1)}}},
+			want: ErrInvalidFiles,
+		},
+		{
+			name: "no files with the extension",
+			req:  LintRequest{Lang: "fake", Files: []File{{Path: "a.txt", Text: "a\n"}}},
+			want: ErrInvalidFiles,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := testLanguages().Lint(context.Background(), tt.req); !errors.Is(err, tt.want) {
+				t.Errorf("Lint returned error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestLintEachFile checks that multi-file requests for languages without
+// MultiFile lint the files with the language extension one at a time.
+func TestLintEachFile(t *testing.T) {
+	req := LintRequest{
+		Lang: "fake",
+		Files: []File{
+			{Path: "a.fk", Text: "a\n"},
+			{Path: "README", Text: "ignored\n"},
+			{Path: "src/b.fk", Text: "b\nc\n"},
+		},
+	}
+	resp, err := testLanguages().Lint(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Lint returned error: %v", err)
+	}
+	var paths []string
+	for _, f := range resp.Files {
+		paths = append(paths, f.Path)
+		if want := "// header\n"; !strings.HasPrefix(f.ReformattedText, want) || f.Diff == "" {
+			t.Errorf("Lint file %s has reformatted text %q and diff %q", f.Path, f.ReformattedText, f.Diff)
+		}
+	}
+	if want := []string{"a.fk", "src/b.fk"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("Lint returned files %v, want %v", paths, want)
+	}
+	var files []string
+	for _, d := range resp.Diagnostics {
+		files = append(files, d.File)
+		if d.OriginalLine != 1 {
+			t.Errorf("Lint diagnostic in %s has original line %d, want 1", d.File, d.OriginalLine)
+		}
+	}
+	if want := []string{"a.fk", "src/b.fk"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("Lint returned diagnostics for files %v, want %v", files, want)
+	}
+	if want := "a.fk: Line 2: warning: first line"; len(resp.ErrorMessages) == 0 || !strings.Contains(resp.ErrorMessages[0], want) {
+		t.Errorf("Lint returned messages %q, want the first one to contain %q", resp.ErrorMessages, want)
+	}
+	if !resp.Reformatted || resp.Formatter != "fake" {
+		t.Errorf("Lint returned Reformatted=%v Formatter=%q, want true and %q", resp.Reformatted, resp.Formatter, "fake")
+	}
+
+	req.Files = append(req.Files, File{Path: "fail.fk", Text: "fail\n"})
+	if _, err := testLanguages().Lint(context.Background(), req); err == nil || !strings.HasPrefix(err.Error(), "fail.fk: ") {
+		t.Errorf("Lint with a failing file returned error %v, want one prefixed by the path", err)
+	}
+}
+
+func TestMapOriginalLines(t *testing.T) {
+	resp := LintResponse{
+		ReformattedText: "// header\na\nb\n",
+		FixedText:       "// header\n// fixed\na\nb\n",
+		Diagnostics: []Diagnostic{
+			{Line: 4, Source: SourceFixed},
+			{Line: 3, EndLine: 3},
+			{Line: 3, EndLine: 5, Source: SourceReformatted},
+			{Line: 1, Source: SourceReformatted},
+			{Source: SourceReformatted},
+		},
+	}
+	mapOriginalLines(&resp, func(string) (string, string, string) {
+		return "a\nb\n", resp.ReformattedText, resp.FixedText
+	})
+
+	want := []Diagnostic{
+		{Line: 4, Source: SourceFixed, OriginalLine: 2},
+		{Line: 3, EndLine: 3, Source: SourceOriginal, OriginalLine: 3, OriginalEndLine: 3},
+		{Line: 3, EndLine: 5, Source: SourceReformatted, OriginalLine: 2, OriginalEndLine: 4},
+		{Line: 1, Source: SourceReformatted, OriginalLine: 1},
+		{Source: SourceReformatted},
+	}
+	if !reflect.DeepEqual(resp.Diagnostics, want) {
+		t.Errorf("mapOriginalLines =\n%+v\nwant:\n%+v", resp.Diagnostics, want)
+	}
+}
+
+func TestDiagnosticString(t *testing.T) {
+	tests := []struct {
+		d    Diagnostic
+		want string
+	}{
+		{Diagnostic{Message: "message"}, "message"},
+		{Diagnostic{Line: 3, Column: 7, Message: "message"}, "Line 3 Col 7: message"},
+		{Diagnostic{Line: 3, Column: 7, Severity: "error", Message: "message", RuleID: "rule"}, "Line 3 Col 7: error: message [rule]"},
+		{Diagnostic{Severity: "warning", Message: "message"}, "warning: message"},
+	}
+	for _, tt := range tests {
+		if got := tt.d.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestErrorMessages(t *testing.T) {
+	diags := []Diagnostic{
+		{Tool: "eslint", Line: 1, Column: 2, Severity: "error", Message: "bad", Context: []string{"context"}},
+		{Tool: "pylint", Message: "global"},
+	}
+	want := []string{"[eslint] Line 1 Col 2: error: bad", "[eslint] context", "[pylint] global"}
+	if got := ErrorMessages(diags); !reflect.DeepEqual(got, want) {
+		t.Errorf("ErrorMessages = %q, want %q", got, want)
+	}
+}
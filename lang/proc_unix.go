@@ -0,0 +1,48 @@
+//go:build unix
+
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// Signals sent by the kernel when a program exceeds its CPU time and file
+// size limits.
+var (
+	sigXCPU = syscall.SIGXCPU
+	sigXFSZ = syscall.SIGXFSZ
+)
+
+// setProcessGroup makes the command start in a new process group, so it can
+// be killed together with all its children.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// killProcessGroup kills the process group started by cmd.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// peakMemory returns the peak resident memory of a finished process, in
+// bytes, or zero if unknown.
+func peakMemory(state *os.ProcessState) int64 {
+	// Maxrss is in kilobytes on Linux (but bytes on macOS).
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	if runtime.GOOS == "darwin" {
+		return int64(rusage.Maxrss)
+	}
+	return int64(rusage.Maxrss) << 10
+}
@@ -0,0 +1,31 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Windows has no equivalent to the CPU time and file size signals.
+var (
+	sigXCPU = syscall.Signal(-1)
+	sigXFSZ = syscall.Signal(-1)
+)
+
+// setProcessGroup does nothing on Windows.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the process started by cmd (Windows has no process
+// groups).
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// peakMemory returns zero: Windows doesn't report the peak memory through
+// os.ProcessState.
+func peakMemory(state *os.ProcessState) int64 {
+	return 0
+}
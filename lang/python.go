@@ -5,55 +5,144 @@
 package lang
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"log"
-	"net/http"
 	"os"
+	"os/exec"
 	"regexp"
 	"strings"
-
-	"github.com/osprogramadores/op-web-linter/common"
-	"github.com/osprogramadores/op-web-linter/handlers"
 )
 
-// Regexp matching eslint lines.
+// Regexp matching pylint lines.
 // Sample line: /tmp/smartcd.py:187:0: W0311: Bad indentation. Found 4 spaces, expected 8 (bad-indentation)
 var pylintLineRegex = regexp.MustCompile("^[^:]+:([0-9]+):([0-9]+):[ ]*(.*)")
 
+// Regexp matching the message part of pylint lines (code, message and symbol).
+var pylintMessageRegex = regexp.MustCompile(`^([CRWEFI])[0-9]{4}:[ ]*(.*?)(?:[ ]+\(([a-z0-9-]+)\))?$`)
+
+// pylintSeverity maps the first letter of pylint message codes to severities.
+var pylintSeverity = map[string]string{
+	"C": "convention",
+	"R": "refactor",
+	"W": "warning",
+	"E": "error",
+	"F": "fatal",
+	"I": "info",
+}
+
+// Resource limits for the Python tools.
+var pythonLimits = DefaultLimits
+
+// FingerprintPython identifies the versions of the Python tools and
+// configuration, for caching.
+var FingerprintPython = fingerprint([][]string{{"ruff", "--version"}, {"black", "--version"}, {"pylint", "--version"}, {"autopep8", "--version"}}, func() []string {
+	return []string{os.Getenv("HOME") + "/op-web-linter/config/pylint3.rc"}
+})
+
+// Python formatters, in order of preference. The first one found in the
+// PATH is used. Both rewrite the file given at the end of the command line.
+var pythonFormatters = [][]string{
+	{"ruff", "format", "--quiet", "--line-length", "100"},
+	{"black", "--quiet", "--line-length", "100"},
+}
+
+// Regexp matching the position of syntax errors in the formatter output.
+// Sample lines:
+// error: cannot format /tmp/123/456.py: Cannot parse: 1:7: def f(:
+// error: Failed to parse /tmp/123/456.py:1:7: Expected ')', found ':'
+var pythonFormatErrorRegex = regexp.MustCompile(`[: ]([0-9]+):([0-9]+): `)
+
 // LintPython lints programs written in Python (v3).
-func LintPython(w http.ResponseWriter, r *http.Request, req handlers.LintRequest) {
-	tempdir, tempfile, err := saveRequestToFile(req.Text, "*.py")
+func LintPython(ctx context.Context, req LintRequest) (LintResponse, error) {
+	tempdir, tempfile, err := saveRequestToFile(ctx, req.Text, "*.py")
 	if err != nil {
-		common.HTTPError(w, err.Error(), http.StatusInternalServerError)
-		return
+		return LintResponse{}, err
 	}
 	defer os.RemoveAll(tempdir)
 
+	var diags []Diagnostic
+
+	// Reformat source code (in place). In case of errors, we move ahead with
+	// the old code and attempt linting anyway.
+	formatter := pythonFormatter()
+	reformatted := req.Text
+	out, reformatErr := Execute(ctx, tempdir, pythonLimits, formatter[0], formatter[0], append(formatter[1:], tempfile)...)
+	if reformatErr != nil {
+		diags = append(diags, pythonFormatterDiagnostics(formatter[0], reformatErr, out)...)
+		// The formatter may have written a partially formatted file.
+		if err := os.WriteFile(tempfile, []byte(req.Text), 0644); err != nil {
+			return LintResponse{}, err
+		}
+	} else {
+		data, err := os.ReadFile(tempfile)
+		if err != nil {
+			return LintResponse{}, err
+		}
+		reformatted = string(data)
+	}
+
+	// Apply the autopep8 fixes, if requested. The fixed program is linted below.
+	var fix fixResult
+	if req.Fix {
+		fix, err = runFixer(ctx, "autopep8", tempdir, tempfile, pythonLimits, "autopep8", "--in-place", "--max-line-length=100", tempfile)
+		if err != nil {
+			return LintResponse{}, err
+		}
+		diags = append(diags, fix.diags...)
+	}
+	pass := len(diags) == 0
+
 	// pylint.
 	homedir := os.Getenv("HOME")
-	out, err := Execute("pylint", "--rcfile="+homedir+"/op-web-linter/config/pylint3.rc", tempfile)
+	out, err = Execute(ctx, tempdir, pythonLimits, "pylint", "pylint", "--rcfile="+homedir+"/op-web-linter/config/pylint3.rc", tempfile)
+	diags = append(diags, PythonFilterOutput(out, tempfile)...)
+	diags = append(diags, limitDiagnostics("pylint", err)...)
 
-	// Create response, convert to JSON and return.
-	resp := handlers.LintResponse{
-		Pass:          err == nil,
-		ErrorMessages: common.SlicePrefix(PythonFilterOutput(out, tempfile), "pylint"),
+	// Create and return response.
+	return LintResponse{
+		Pass:            pass && err == nil,
+		ErrorMessages:   ErrorMessages(diags),
+		Diagnostics:     setSource(diags, textSource(reformatErr == nil, fix.fixed())),
+		Reformatted:     reformatted != req.Text,
+		ReformattedText: reformatted,
+		Formatter:       formatter[0],
+		Fixed:           fix.fixed(),
+		FixedText:       fix.text,
+		Fixes:           fix.edits,
+	}, nil
+}
+
+// pythonFormatter returns the command line of the first formatter in
+// pythonFormatters found in the PATH (or the last one, if none is found).
+func pythonFormatter() []string {
+	for _, cmd := range pythonFormatters {
+		if _, err := exec.LookPath(cmd[0]); err == nil {
+			return cmd
+		}
 	}
-	jresp, err := json.Marshal(resp)
-	if err != nil {
-		common.HTTPError(w, err.Error(), http.StatusInternalServerError)
-		return
+	return pythonFormatters[len(pythonFormatters)-1]
+}
+
+// pythonFormatterDiagnostics returns the diagnostics for a formatter failure.
+// The formatters fail on syntax errors, which are reported at the position
+// given in the output, if any.
+func pythonFormatterDiagnostics(tool string, err error, output string) []Diagnostic {
+	diags := formatterDiagnostics(tool, fmt.Sprintf("Error reformatting Python code: %v", err), err, output)
+	if _, ok := err.(*exec.ExitError); !ok {
+		return diags
 	}
-	log.Printf("JSON response:\n%s", prettyJSONString(jresp))
-	w.Write(jresp)
-	w.Write([]byte("\n"))
+	if r := pythonFormatErrorRegex.FindStringSubmatch(output); r != nil {
+		diags[0].Line, diags[0].Column = atoi(r[1]), atoi(r[2])
+		diags[0].Message = "Syntax error: unable to reformat the program"
+	}
+	return diags
 }
 
-// PythonFilterOutput remove undesirable messages from the pylint output.
-// pylint3 is very verbose. Limit output to the lines starting with our
-// filename.
-func PythonFilterOutput(output string, tempfile string) []string {
-	var ret []string
+// PythonFilterOutput remove undesirable messages from the pylint output and
+// converts the remaining lines into diagnostics. pylint3 is very verbose.
+// Limit output to the lines starting with our filename.
+func PythonFilterOutput(output string, tempfile string) []Diagnostic {
+	var ret []Diagnostic
 	for _, v := range strings.Split(output, "\n") {
 		if !strings.HasPrefix(v, tempfile) {
 			continue
@@ -67,10 +156,23 @@ func PythonFilterOutput(output string, tempfile string) []string {
 
 		// Unable to parse line, Include literally (this should not happen).
 		if len(r) < 4 {
-			ret = append(ret, v)
+			ret = appendUnparsed(ret, "pylint", v)
 			continue
 		}
-		ret = append(ret, fmt.Sprintf("Line %s Col %s: %s", r[1], r[2], r[3]))
+		// pylint columns start at zero.
+		d := Diagnostic{
+			Tool:    "pylint",
+			Line:    atoi(r[1]),
+			Column:  atoi(r[2]) + 1,
+			Message: r[3],
+		}
+		// Split "code: message (symbol)", if possible.
+		if m := pylintMessageRegex.FindStringSubmatch(r[3]); m != nil {
+			d.Severity = pylintSeverity[m[1]]
+			d.Message = m[2]
+			d.RuleID = m[3]
+		}
+		ret = append(ret, d)
 	}
 	return ret
 }
@@ -0,0 +1,134 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPythonFilterOutput(t *testing.T) {
+	tempfile := "/tmp/lint123/prog456.py"
+	out := "************* Module prog456\n" +
+		tempfile + ":1:0: C0114: Missing module docstring (missing-module-docstring)\n" +
+		tempfile + ":3:4: W0311: Bad indentation. Found 4 spaces, expected 8 (bad-indentation)\n" +
+		tempfile + ":5:0: E0001: Parsing failed\n" +
+		"\n" +
+		"------------------------------------------------------------------\n" +
+		"Your code has been rated at 2.50/10\n"
+
+	want := []Diagnostic{
+		{Tool: "pylint", Line: 1, Column: 1, Severity: "convention", Message: "Missing module docstring", RuleID: "missing-module-docstring"},
+		{Tool: "pylint", Line: 3, Column: 5, Severity: "warning", Message: "Bad indentation. Found 4 spaces, expected 8", RuleID: "bad-indentation"},
+		{Tool: "pylint", Line: 5, Column: 1, Severity: "error", Message: "Parsing failed"},
+	}
+	if got := PythonFilterOutput(out, tempfile); !reflect.DeepEqual(got, want) {
+		t.Errorf("PythonFilterOutput =\n%+v\nwant:\n%+v", got, want)
+	}
+}
+
+func TestPythonFormatter(t *testing.T) {
+	tests := []struct {
+		name  string
+		tools []string // Tools in the PATH.
+		want  string
+	}{
+		{"ruff", []string{"ruff", "black"}, "ruff"},
+		{"black", []string{"black"}, "black"},
+		{"none", nil, "black"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, tool := range tt.tools {
+				if err := os.WriteFile(filepath.Join(dir, tool), []byte("#!/bin/sh\n"), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			t.Setenv("PATH", dir)
+			if got := pythonFormatter(); got[0] != tt.want {
+				t.Errorf("pythonFormatter() = %q, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPythonFormatterDiagnostics(t *testing.T) {
+	// An *exec.ExitError, as returned for syntax errors.
+	exitErr := exec.Command("false").Run()
+
+	tests := []struct {
+		name   string
+		tool   string
+		err    error
+		output string
+		want   Diagnostic
+	}{
+		{
+			name:   "black syntax error",
+			tool:   "black",
+			err:    exitErr,
+			output: "error: cannot format /tmp/123/456.py: Cannot parse: 1:7: def f(:\n",
+			want: Diagnostic{
+				Tool:     "black",
+				Line:     1,
+				Column:   7,
+				Severity: "error",
+				Message:  "Syntax error: unable to reformat the program",
+				Context:  []string{"error: cannot format /tmp/123/456.py: Cannot parse: 1:7: def f(:"},
+			},
+		},
+		{
+			name:   "ruff syntax error",
+			tool:   "ruff",
+			err:    exitErr,
+			output: "error: Failed to parse /tmp/123/456.py:3:12: Expected ')', found ':'\n",
+			want: Diagnostic{
+				Tool:     "ruff",
+				Line:     3,
+				Column:   12,
+				Severity: "error",
+				Message:  "Syntax error: unable to reformat the program",
+				Context:  []string{"error: Failed to parse /tmp/123/456.py:3:12: Expected ')', found ':'"},
+			},
+		},
+		{
+			name:   "no position",
+			tool:   "black",
+			err:    exitErr,
+			output: "error: something else\n",
+			want: Diagnostic{
+				Tool:     "black",
+				Severity: "error",
+				Message:  "Error reformatting Python code: exit status 1",
+				Context:  []string{"error: something else"},
+			},
+		},
+		{
+			name:   "timeout",
+			tool:   "black",
+			err:    &TimeoutError{Timeout: 15 * time.Second},
+			output: "partial 1:2: output\n",
+			want: Diagnostic{
+				Tool:     "black",
+				Severity: "error",
+				RuleID:   RuleTimeout,
+				Message:  "Error reformatting Python code: timed out after 15s",
+				Context:  []string{"partial 1:2: output"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pythonFormatterDiagnostics(tt.tool, tt.err, tt.output)
+			if want := []Diagnostic{tt.want}; !reflect.DeepEqual(got, want) {
+				t.Errorf("pythonFormatterDiagnostics =\n%+v\nwant:\n%+v", got, want)
+			}
+		})
+	}
+}
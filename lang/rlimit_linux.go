@@ -0,0 +1,9 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+// rlimitNproc is RLIMIT_NPROC (not defined in the syscall package).
+const rlimitNproc = 0x6
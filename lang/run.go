@@ -0,0 +1,554 @@
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Limits for run requests.
+const (
+	MaxCases    = 100              // Maximum number of test cases.
+	MaxCaseSize = 1 << 20          // Maximum size of the input or expected output of a test case, in bytes.
+	caseTimeout = 10 * time.Second // Maximum wall time of the program in each test case (unless lower in the request).
+	caseDiffMax = 200              // Maximum number of diff lines reported for each failed case.
+)
+
+// runTimeout is the maximum wall time of all the test cases of a request
+// together. Cases beyond it are not run. Variable for tests.
+var runTimeout = 60 * time.Second
+
+// Name of the executable built by compiled languages.
+const programName = "program"
+
+// Java compiler (from the same JDK as javaBinary).
+const javacBinary = "/usr/lib/jvm/java-17-openjdk/bin/javac"
+
+var (
+	// ErrNotRunnable is returned for run requests in languages that can't
+	// be run.
+	ErrNotRunnable = errors.New("language can't be run")
+
+	// ErrInvalidCases is returned for run requests with invalid test cases.
+	ErrInvalidCases = errors.New("invalid test cases")
+)
+
+// Regexps matching compiler messages: file:line[:column]: [severity:]
+// message, or the location line of Python syntax errors. Messages from node
+// and Python have the location in the first line, and the error (matched by
+// errorLineRegex) in the following lines, except for Python indentation
+// errors (E.g. "Sorry: IndentationError: message (file, line N)").
+var (
+	compilerLineRegex = regexp.MustCompile(`^([^:\s][^:]*):([0-9]+)(?::([0-9]+))?(?::|$)\s*(?:(fatal error|error|warning|note):\s*)?(.*)`)
+	pythonLineRegex   = regexp.MustCompile(`^\s*File "([^"]+)", line ([0-9]+)`)
+	pythonSorryRegex  = regexp.MustCompile(`^Sorry: (.*) \(([^,()]+), line ([0-9]+)\)$`)
+	errorLineRegex    = regexp.MustCompile(`^[A-Za-z]*Error: `)
+)
+
+// Name of the public class in Java programs.
+var javaClassRegex = regexp.MustCompile(`(?m)^\s*public\s+(?:(?:final|abstract)\s+)*class\s+([A-Za-z_$][A-Za-z0-9_$]*)`)
+
+// RunRequest contains a request to build a program and run it against a
+// set of test cases.
+type RunRequest struct {
+	Text  string     `json:"text"`  // Text of the program (not escaped).
+	Lang  string     `json:"lang"`  // Language (must be one of the runnable languages).
+	Cases []TestCase `json:"cases"` // Test cases.
+
+	// Files of a multi-file program, used instead of Text.
+	Files []File `json:"files,omitempty"`
+
+	// Challenge providing the test cases (if Cases is empty) and the time
+	// limit (if TimeLimit is zero). Optional.
+	Challenge string `json:"challenge,omitempty"`
+
+	// Maximum wall time of each test case, in seconds (optional, at most
+	// 10).
+	TimeLimit float64 `json:"timeLimit,omitempty"`
+}
+
+// TestCase holds the input of a program and its expected output.
+type TestCase struct {
+	Name     string `json:"name"`     // Name shown in the results (optional).
+	Stdin    string `json:"stdin"`    // Standard input.
+	Expected string `json:"expected"` // Expected standard output.
+}
+
+// RunResponse contains the response to a run request.
+type RunResponse struct {
+	Pass        bool         // Did the program build and pass all test cases?
+	Built       bool         // Did the program build?
+	BuildOutput string       `json:",omitempty"` // Compiler output.
+	Diagnostics []Diagnostic // Compiler messages and house rules of the challenge broken by the program.
+	Cases       []CaseResult // Results per test case (only if built).
+}
+
+// CaseResult contains the outcome of a single test case.
+type CaseResult struct {
+	Name       string // Test case name.
+	Pass       bool   // Did the program exit successfully with the expected output?
+	ExitCode   int    // Exit code of the program.
+	Error      string `json:",omitempty"` // Why the program was aborted (E.g. timeout, resource limit or signal).
+	Signal     string `json:",omitempty"` // Signal that killed the program, other than for the limits (E.g. "segmentation fault").
+	Stdout     string // Standard output.
+	Stderr     string `json:",omitempty"` // Standard error.
+	Diff       string `json:",omitempty"` // Unified diff from the expected output to Stdout (failures only).
+	RuntimeMs  int64  // Wall time, in milliseconds.
+	PeakMemory int64  // Peak resident memory, in bytes.
+	Hidden     bool   `json:",omitempty"` // Case of a challenge, without Stdout, Stderr and Diff (which would reveal it).
+}
+
+// Runner builds and runs programs written in one language.
+type Runner interface {
+	Run(ctx context.Context, req RunRequest) (RunResponse, error)
+}
+
+// RunnerFunc adapts an ordinary function to the Runner interface.
+type RunnerFunc func(ctx context.Context, req RunRequest) (RunResponse, error)
+
+// Run calls f(ctx, req).
+func (f RunnerFunc) Run(ctx context.Context, req RunRequest) (RunResponse, error) {
+	return f(ctx, req)
+}
+
+// Run builds and runs a program written in one of the built-in languages, as
+// given by req.Lang.
+func Run(ctx context.Context, req RunRequest) (RunResponse, error) {
+	return defaultLanguages.Run(ctx, req)
+}
+
+// Run builds a program written in one of the languages in the set (as given
+// by req.Lang) and runs it against the test cases in the request, or in the
+// challenge selected by the request (without revealing their input and
+// output: see CaseResult.Hidden). Returns ErrUnknownLanguage for
+// unsupported languages, ErrNotRunnable for languages without a runner,
+// ErrUnknownChallenge for unknown challenges, and ErrInvalidFiles or
+// ErrInvalidCases for invalid requests.
+func (l Languages) Run(ctx context.Context, req RunRequest) (RunResponse, error) {
+	language, ok := l.Get(req.Lang)
+	if !ok {
+		return RunResponse{}, fmt.Errorf("%w: %q", ErrUnknownLanguage, req.Lang)
+	}
+	if language.Runner == nil {
+		return RunResponse{}, fmt.Errorf("%w: %q", ErrNotRunnable, req.Lang)
+	}
+	if len(req.Files) > 0 {
+		if err := checkFiles(req.Files); err != nil {
+			return RunResponse{}, err
+		}
+	}
+	challenge, err := lookupChallenge(req.Challenge)
+	if err != nil {
+		return RunResponse{}, err
+	}
+	hidden := challenge != nil && len(req.Cases) == 0
+	if hidden {
+		req.Cases = challenge.Cases
+	}
+	if challenge != nil && req.TimeLimit == 0 {
+		req.TimeLimit = challenge.TimeLimit
+	}
+	if req.TimeLimit < 0 || req.TimeLimit > caseTimeout.Seconds() {
+		return RunResponse{}, fmt.Errorf("%w: time limit must be between 0 and %v seconds", ErrInvalidCases, caseTimeout.Seconds())
+	}
+	if err := checkCases(req.Cases); err != nil {
+		return RunResponse{}, err
+	}
+	resp, err := language.Runner.Run(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+
+	// The test cases of challenges are not revealed: only report whether
+	// the program passed them (and how it failed).
+	if hidden {
+		for i := range resp.Cases {
+			c := &resp.Cases[i]
+			c.Stdout, c.Stderr, c.Diff, c.Hidden = "", "", "", true
+		}
+	}
+
+	// Programs breaking the house rules of the challenge don't pass, even
+	// if the output is right.
+	files := req.Files
+	if len(files) == 0 {
+		files = []File{{Text: req.Text}}
+	}
+	if diags := challengeDiagnostics(challenge, req.Lang, files); len(diags) > 0 {
+		resp.Diagnostics = append(resp.Diagnostics, diags...)
+		resp.Pass = false
+	}
+	return resp, nil
+}
+
+// programRunner builds programs with the command returned by build (if not
+// nil), and runs each test case with the command returned by run. Both
+// commands run in the directory holding the program files, and receive
+// the source files (the files with one of the extensions in sources).
+type programRunner struct {
+	tool    string                                  // Compiler, for diagnostics.
+	sources []string                                // Extensions of the source files.
+	main    func(text string) string                // File name of single file programs.
+	build   func(sources []File) (string, []string) // Build command.
+	run     func(sources []File) (string, []string) // Run command.
+	limits  Limits                                  // Resource limits for the build and the program.
+}
+
+// Runners for the built-in languages.
+var (
+	cRunner = programRunner{
+		tool:    "clang",
+		sources: clangC.sources,
+		main:    fixedName("main.c"),
+		build: func(sources []File) (string, []string) {
+			return "clang", append(append([]string{"-O2", "-I.", "-o", programName}, filePaths(sources)...), "-lm")
+		},
+		run:    runProgram,
+		limits: cLimits,
+	}
+	cppRunner = programRunner{
+		tool:    "clang++",
+		sources: clangCPP.sources,
+		main:    fixedName("main.cpp"),
+		build: func(sources []File) (string, []string) {
+			return "clang++", append([]string{"-O2", "--std=c++14", "-I.", "-o", programName}, filePaths(sources)...)
+		},
+		run:    runProgram,
+		limits: cppLimits,
+	}
+	goRunner = programRunner{
+		tool:    "go build",
+		sources: []string{".go"},
+		main:    fixedName("main.go"),
+		build: func(sources []File) (string, []string) {
+			return "go", append([]string{"build", "-o", programName}, filePaths(sources)...)
+		},
+		run:    runProgram,
+		limits: goLimits,
+	}
+	javaRunner = programRunner{
+		tool:    "javac",
+		sources: []string{".java"},
+		main:    javaFileName,
+		build: func(sources []File) (string, []string) {
+			return javacBinary, append([]string{"-encoding", "UTF-8", "-d", "."}, filePaths(sources)...)
+		},
+		run: func(sources []File) (string, []string) {
+			return javaBinary, []string{"-cp", ".", javaMainClass(sources)}
+		},
+		limits: javaLimits,
+	}
+	javascriptRunner = programRunner{
+		tool:    "node",
+		sources: []string{".js"},
+		main:    fixedName("main.js"),
+		build: func(sources []File) (string, []string) {
+			return "node", []string{"--check", entryFile(sources, "main.js", "index.js")}
+		},
+		run: func(sources []File) (string, []string) {
+			return "node", []string{entryFile(sources, "main.js", "index.js")}
+		},
+		limits: javascriptLimits,
+	}
+	pythonRunner = programRunner{
+		tool:    "python3",
+		sources: []string{".py"},
+		main:    fixedName("main.py"),
+		build: func(sources []File) (string, []string) {
+			return "python3", append([]string{"-m", "py_compile"}, filePaths(sources)...)
+		},
+		run: func(sources []File) (string, []string) {
+			return "python3", []string{entryFile(sources, "main.py", "__main__.py")}
+		},
+		limits: pythonLimits,
+	}
+)
+
+// Run builds the program and runs it against each test case, in order.
+// Programs that fail to build are not run, and the compiler messages are
+// returned as diagnostics.
+func (p programRunner) Run(ctx context.Context, req RunRequest) (RunResponse, error) {
+	// Single file programs are saved with a fixed name, and diagnostics
+	// refer to the program text.
+	files := req.Files
+	if len(files) == 0 {
+		files = []File{{Path: p.main(req.Text), Text: req.Text}}
+	}
+	tempdir, _, err := saveRequestFiles(ctx, files)
+	if err != nil {
+		return RunResponse{}, err
+	}
+	defer os.RemoveAll(tempdir)
+
+	var sources []File
+	for _, f := range files {
+		if containsString(p.sources, path.Ext(f.Path)) && !strings.HasSuffix(f.Path, "_test.go") {
+			sources = append(sources, f)
+		}
+	}
+	if len(sources) == 0 {
+		return RunResponse{}, fmt.Errorf("%w: no source files (%s)", ErrInvalidFiles, strings.Join(p.sources, ", "))
+	}
+
+	// Build the program. The build leaves the executable (if any) in the
+	// temporary directory.
+	if p.build != nil {
+		name, args := p.build(sources)
+		out, err := Execute(ctx, tempdir, p.limits, p.tool, name, args...)
+		if ctx.Err() != nil {
+			return RunResponse{}, ctx.Err()
+		}
+		if err != nil {
+			diags := compilerFilterOutput(strings.Split(out, "\n"), p.tool, tempdir)
+			diags = append(diags, limitDiagnostics(p.tool, err)...)
+			if len(diags) == 0 {
+				diags = toolDiagnostics(p.tool, fmt.Sprintf("Build failed: %v", err), err, "")
+			}
+			for i := range diags {
+				diags[i].OriginalLine, diags[i].OriginalEndLine = diags[i].Line, diags[i].EndLine
+			}
+			if len(req.Files) == 0 {
+				diags = setFile(diags, "")
+			}
+			return RunResponse{
+				BuildOutput: out,
+				Diagnostics: setSource(diags, SourceOriginal),
+			}, nil
+		}
+	}
+
+	timeout := caseTimeout
+	if req.TimeLimit > 0 {
+		timeout = time.Duration(req.TimeLimit * float64(time.Second))
+	}
+	resp := RunResponse{Pass: true, Built: true}
+	name, args := p.run(sources)
+	deadline := time.Now().Add(runTimeout)
+	for i, tc := range req.Cases {
+		result := CaseResult{Name: tc.Name, Error: fmt.Sprintf("not run: test cases took longer than %v", runTimeout)}
+		if remaining := time.Until(deadline); remaining > 0 {
+			if result, err = runCase(ctx, tempdir, p.limits, min(timeout, remaining.Round(time.Millisecond)), tc, name, args...); err != nil {
+				return RunResponse{}, err
+			}
+		}
+		if result.Name == "" {
+			result.Name = fmt.Sprintf("case %d", i+1)
+		}
+		resp.Cases = append(resp.Cases, result)
+		resp.Pass = resp.Pass && result.Pass
+	}
+	return resp, nil
+}
+
+// runCase runs the program with the input of a test case for up to timeout,
+// and compares its output with the expected output. Only dir is writable
+// for the program (not Sandbox.Writable, nor the tool caches in
+// Sandbox.Overlay), and the other
+// temporary directories, the home directory and Sandbox.Hidden are hidden.
+func runCase(ctx context.Context, dir string, limits Limits, timeout time.Duration, tc TestCase, name string, args ...string) (CaseResult, error) {
+	stdout := &limitedBuffer{max: limits.Output}
+	stderr := &limitedBuffer{max: limits.Output}
+
+	start := time.Now()
+	peak, err := execute(ctx, dir, execOptions{
+		tool:    "program",
+		limits:  limits,
+		timeout: timeout,
+		stdin:   strings.NewReader(tc.Stdin),
+		stdout:  stdout,
+		stderr:  stderr,
+		hidden:  programHidden(),
+		program: true,
+	}, name, args...)
+	ret := CaseResult{
+		Name:       tc.Name,
+		ExitCode:   Exitcode(err),
+		Stdout:     string(stdout.buf),
+		Stderr:     string(stderr.buf),
+		RuntimeMs:  time.Since(start).Milliseconds(),
+		PeakMemory: peak,
+	}
+	switch e := err.(type) {
+	case nil, *exec.ExitError:
+	case *SignalError:
+		ret.Error = err.Error()
+		ret.Signal = e.Signal.String()
+	case *LimitError, *TimeoutError:
+		ret.Error = err.Error()
+	default:
+		return CaseResult{}, err
+	}
+
+	if !sameOutput(tc.Expected, ret.Stdout) {
+		ret.Diff, _ = Diff("expected", "output", tc.Expected, ret.Stdout)
+		ret.Diff = truncateLines(ret.Diff, caseDiffMax)
+	}
+	ret.Pass = ret.ExitCode == 0 && ret.Error == "" && ret.Diff == ""
+	return ret, nil
+}
+
+// sameOutput returns true if the program output matches the expected
+// output. Trailing spaces in each line and trailing empty lines are ignored.
+func sameOutput(expected, output string) bool {
+	return normalizeOutput(expected) == normalizeOutput(output)
+}
+
+// normalizeOutput removes trailing spaces from each line, and trailing empty
+// lines.
+func normalizeOutput(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// truncateLines returns the first max lines of s.
+func truncateLines(s string, max int) string {
+	lines := strings.SplitAfter(s, "\n")
+	if len(lines) <= max {
+		return s
+	}
+	return strings.Join(lines[:max], "") + fmt.Sprintf("... (%d more lines)\n", len(lines)-max)
+}
+
+// checkCases returns an error wrapping ErrInvalidCases if the request has
+// no test cases, or too many or too large test cases.
+func checkCases(cases []TestCase) error {
+	if len(cases) == 0 {
+		return fmt.Errorf("%w: no test cases", ErrInvalidCases)
+	}
+	if len(cases) > MaxCases {
+		return fmt.Errorf("%w: more than %d test cases", ErrInvalidCases, MaxCases)
+	}
+	for i, tc := range cases {
+		if len(tc.Stdin) > MaxCaseSize || len(tc.Expected) > MaxCaseSize {
+			return fmt.Errorf("%w: case %d larger than %d bytes", ErrInvalidCases, i+1, MaxCaseSize)
+		}
+	}
+	return nil
+}
+
+// compilerFilterOutput converts the output of a compiler (named by tool)
+// into diagnostics, with the file names relative to tempdir in
+// Diagnostic.File. Messages without a severity are errors.
+func compilerFilterOutput(list []string, tool, tempdir string) []Diagnostic {
+	var ret []Diagnostic
+	for _, v := range list {
+		// Remove blank lines and go build package headers.
+		if strings.TrimSpace(v) == "" || strings.HasPrefix(v, "#") {
+			continue
+		}
+		r := compilerLineRegex.FindStringSubmatch(v)
+		if m := pythonLineRegex.FindStringSubmatch(v); m != nil {
+			r = []string{v, m[1], m[2], "", "", ""}
+		}
+		if m := pythonSorryRegex.FindStringSubmatch(v); m != nil {
+			r = []string{v, m[2], m[3], "", "", m[1]}
+		}
+
+		// Unable to parse line. Include literally.
+		if r == nil {
+			ret = appendUnparsed(ret, tool, v)
+			continue
+		}
+		d := Diagnostic{
+			Tool:     tool,
+			File:     path.Clean(r[1]),
+			Line:     atoi(r[2]),
+			Column:   atoi(r[3]),
+			Severity: strings.TrimPrefix(r[4], "fatal "),
+			Message:  r[5],
+		}
+		if filepath.IsAbs(d.File) {
+			d.File = relativePath(tempdir, d.File)
+		}
+		if d.Severity == "" {
+			d.Severity = "error"
+		}
+		ret = append(ret, d)
+	}
+
+	// Use the error line as the message when the first line only has the
+	// location.
+	for i := range ret {
+		d := &ret[i]
+		for j, line := range d.Context {
+			if d.Message == "" && errorLineRegex.MatchString(line) {
+				d.Message = line
+				d.Context = append(d.Context[:j:j], d.Context[j+1:]...)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// runProgram returns the command to run the executable built by compiled
+// languages.
+func runProgram([]File) (string, []string) {
+	return "./" + programName, nil
+}
+
+// fixedName returns a function returning name, for the file names of single
+// file programs.
+func fixedName(name string) func(string) string {
+	return func(string) string {
+		return name
+	}
+}
+
+// filePaths returns the paths of the files.
+func filePaths(files []File) []string {
+	var ret []string
+	for _, f := range files {
+		ret = append(ret, f.Path)
+	}
+	return ret
+}
+
+// entryFile returns the path of the first file named like one of names
+// (in order of preference), or the first file.
+func entryFile(files []File, names ...string) string {
+	for _, name := range names {
+		for _, f := range files {
+			if path.Base(f.Path) == name {
+				return f.Path
+			}
+		}
+	}
+	return files[0].Path
+}
+
+// javaFileName returns the file name for a single file Java program, named
+// after its public class (Main, if none).
+func javaFileName(text string) string {
+	if m := javaClassRegex.FindStringSubmatch(text); m != nil {
+		return m[1] + ".java"
+	}
+	return "Main.java"
+}
+
+// javaMainClass returns the name of the class with the main method, assuming
+// that the package of each class matches its directory.
+func javaMainClass(files []File) string {
+	main := files[0]
+	for _, f := range files {
+		if strings.Contains(f.Text, "static void main") {
+			main = f
+			break
+		}
+	}
+	return strings.ReplaceAll(strings.TrimSuffix(main.Path, ".java"), "/", ".")
+}
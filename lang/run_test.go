@@ -0,0 +1,316 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompilerFilterOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		tool string
+		out  []string
+		want []Diagnostic
+	}{
+		{
+			name: "gcc",
+			tool: "clang",
+			out: []string{
+				"/tmp/run123/main.c:1:21: error: use of undeclared identifier 'x'",
+				"    1 | int main() { return x; }",
+				"/tmp/run123/src/util.c:3:1: warning: non-void function does not return a value",
+				"",
+			},
+			want: []Diagnostic{
+				{Tool: "clang", File: "main.c", Line: 1, Column: 21, Severity: "error", Message: "use of undeclared identifier 'x'", Context: []string{"    1 | int main() { return x; }"}},
+				{Tool: "clang", File: "src/util.c", Line: 3, Column: 1, Severity: "warning", Message: "non-void function does not return a value"},
+			},
+		},
+		{
+			name: "go build",
+			tool: "go build",
+			out:  []string{"# command-line-arguments", "./main.go:2:15: undefined: x"},
+			want: []Diagnostic{
+				{Tool: "go build", File: "main.go", Line: 2, Column: 15, Severity: "error", Message: "undefined: x"},
+			},
+		},
+		{
+			name: "python syntax error",
+			tool: "python3",
+			out:  []string{`  File "main.py", line 1`, "    print(", "         ^", "SyntaxError: '(' was never closed"},
+			want: []Diagnostic{
+				{Tool: "python3", File: "main.py", Line: 1, Severity: "error", Message: "SyntaxError: '(' was never closed", Context: []string{"    print(", "         ^"}},
+			},
+		},
+		{
+			name: "python indentation error",
+			tool: "python3",
+			out:  []string{"Sorry: IndentationError: expected an indented block (main.py, line 2)"},
+			want: []Diagnostic{
+				{Tool: "python3", File: "main.py", Line: 2, Severity: "error", Message: "IndentationError: expected an indented block"},
+			},
+		},
+		{
+			name: "node",
+			tool: "node",
+			out:  []string{"/tmp/run123/main.js:2", "", "SyntaxError: Unexpected end of input", "    at wrapSafe (node:internal/modules/cjs/loader:1464:18)"},
+			want: []Diagnostic{
+				{Tool: "node", File: "main.js", Line: 2, Severity: "error", Message: "SyntaxError: Unexpected end of input", Context: []string{"    at wrapSafe (node:internal/modules/cjs/loader:1464:18)"}},
+			},
+		},
+		{
+			name: "unparsed",
+			tool: "javac",
+			out:  []string{"error: no source files"},
+			want: []Diagnostic{{Tool: "javac", Message: "error: no source files"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compilerFilterOutput(tt.out, tt.tool, "/tmp/run123"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compilerFilterOutput =\n%+v\nwant:\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameOutput(t *testing.T) {
+	tests := []struct {
+		expected, output string
+		want             bool
+	}{
+		{"1\n2\n", "1\n2\n", true},
+		{"1\n2\n", "1\n2", true},
+		{"1\n2\n", "1  \n2\t\n\n\n", true},
+		{"1\r\n2\r\n", "1\n2\n", true},
+		{"1\n2\n", "1\n3\n", false},
+		{"1 2\n", "1  2\n", false},
+		{"\n1\n", "1\n", false},
+	}
+	for _, tt := range tests {
+		if got := sameOutput(tt.expected, tt.output); got != tt.want {
+			t.Errorf("sameOutput(%q, %q) = %v, want %v", tt.expected, tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateLines(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"a\nb\n", 3, "a\nb\n"},
+		{"a\nb\nc\nd\n", 2, "a\nb\n... (3 more lines)\n"},
+	}
+	for _, tt := range tests {
+		if got := truncateLines(tt.s, tt.max); got != tt.want {
+			t.Errorf("truncateLines(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestProgramFiles(t *testing.T) {
+	if got, want := javaFileName("import java.util.*;\n\npublic final class Solution {\n}\n"), "Solution.java"; got != want {
+		t.Errorf("javaFileName = %q, want %q", got, want)
+	}
+	if got, want := javaFileName("class A {}\n"), "Main.java"; got != want {
+		t.Errorf("javaFileName without public class = %q, want %q", got, want)
+	}
+
+	files := []File{
+		{Path: "com/example/Util.java", Text: "class Util {}"},
+		{Path: "com/example/App.java", Text: "class App { public static void main(String[] args) {} }"},
+	}
+	if got, want := javaMainClass(files), "com.example.App"; got != want {
+		t.Errorf("javaMainClass = %q, want %q", got, want)
+	}
+
+	files = []File{{Path: "lib/util.py"}, {Path: "app/__main__.py"}, {Path: "main.py"}}
+	if got, want := entryFile(files, "main.py", "__main__.py"), "main.py"; got != want {
+		t.Errorf("entryFile = %q, want %q", got, want)
+	}
+	if got, want := entryFile(files[:1], "main.py"), "lib/util.py"; got != want {
+		t.Errorf("entryFile without entry file = %q, want %q", got, want)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	languages := Languages{
+		"python": {Display: "Python", Extension: "py", Linter: headerLinter, Runner: pythonRunner},
+		"fake":   {Display: "Fake", Extension: "fk", Linter: headerLinter},
+	}
+	cases := []TestCase{{Stdin: "", Expected: "ok\n"}}
+	tests := []struct {
+		name string
+		req  RunRequest
+		want error
+	}{
+		{
+			name: "unknown language",
+			req:  RunRequest{Text: "a", Lang: "unknown", Cases: cases},
+			want: ErrUnknownLanguage,
+		},
+		{
+			name: "not runnable",
+			req:  RunRequest{Text: "a", Lang: "fake", Cases: cases},
+			want: ErrNotRunnable,
+		},
+		{
+			name: "no cases",
+			req:  RunRequest{Text: "a", Lang: "python"},
+			want: ErrInvalidCases,
+		},
+		{
+			name: "too many cases",
+			req:  RunRequest{Text: "a", Lang: "python", Cases: make([]TestCase, MaxCases+1)},
+			want: ErrInvalidCases,
+		},
+		{
+			name: "case too large",
+			req:  RunRequest{Text: "a", Lang: "python", Cases: []TestCase{{Stdin: strings.Repeat("a", MaxCaseSize+1)}}},
+			want: ErrInvalidCases,
+		},
+		{
+			name: "invalid path",
+			req:  RunRequest{Lang: "python", Files: []File{{Path: "../main.py", Text: "a"}}, Cases: cases},
+			want: ErrInvalidFiles,
+		},
+		{
+			name: "no source files",
+			req:  RunRequest{Lang: "python", Files: []File{{Path: "README", Text: "a"}}, Cases: cases},
+			want: ErrInvalidFiles,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := languages.Run(context.Background(), tt.req); !errors.Is(err, tt.want) {
+				t.Errorf("Run returned error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestProgramRunner builds and runs Python programs (the compiler checks the
+// syntax only).
+func TestProgramRunner(t *testing.T) {
+	const echo = "import sys\nfor line in sys.stdin:\n    print(line.strip().upper())\n"
+	tests := []struct {
+		name      string
+		req       RunRequest
+		wantBuilt bool
+		wantDiags []Diagnostic
+		want      []CaseResult // Without the runtime and peak memory.
+	}{
+		{
+			name:      "pass",
+			req:       RunRequest{Text: echo, Cases: []TestCase{{Name: "upper", Stdin: "a\nb\n", Expected: "A\nB\n"}, {Stdin: "", Expected: ""}}},
+			wantBuilt: true,
+			want: []CaseResult{
+				{Name: "upper", Pass: true, Stdout: "A\nB\n"},
+				{Name: "case 2", Pass: true},
+			},
+		},
+		{
+			name:      "wrong output",
+			req:       RunRequest{Text: echo, Cases: []TestCase{{Stdin: "a\n", Expected: "B\n"}}},
+			wantBuilt: true,
+			want: []CaseResult{
+				{Name: "case 1", Stdout: "A\n", Diff: "--- expected\n+++ output\n@@ -1 +1 @@\n-B\n+A\n"},
+			},
+		},
+		{
+			name:      "exit code",
+			req:       RunRequest{Text: "import sys\nprint('A')\nsys.exit(3)\n", Cases: []TestCase{{Expected: "A\n"}}},
+			wantBuilt: true,
+			want: []CaseResult{
+				{Name: "case 1", ExitCode: 3, Stdout: "A\n"},
+			},
+		},
+		{
+			name: "multi-file",
+			req: RunRequest{
+				Files: []File{
+					{Path: "main.py", Text: "from lib import util\nutil.hello()\n"},
+					{Path: "lib/util.py", Text: "def hello():\n    print('hello')\n"},
+				},
+				Cases: []TestCase{{Expected: "hello\n"}},
+			},
+			wantBuilt: true,
+			want:      []CaseResult{{Name: "case 1", Pass: true, Stdout: "hello\n"}},
+		},
+		{
+			name: "build failure",
+			req:  RunRequest{Text: "print(\n", Cases: []TestCase{{Expected: "A\n"}}},
+			wantDiags: []Diagnostic{{
+				Tool:         "python3",
+				Line:         1,
+				Severity:     "error",
+				Message:      "SyntaxError: '(' was never closed",
+				Context:      []string{"    print(", "         ^"},
+				Source:       SourceOriginal,
+				OriginalLine: 1,
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := pythonRunner.Run(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+			if resp.Built != tt.wantBuilt {
+				t.Errorf("Run returned Built=%v, want %v (output %q)", resp.Built, tt.wantBuilt, resp.BuildOutput)
+			}
+			if !reflect.DeepEqual(resp.Diagnostics, tt.wantDiags) {
+				t.Errorf("Run diagnostics =\n%+v\nwant:\n%+v", resp.Diagnostics, tt.wantDiags)
+			}
+			pass := tt.wantBuilt
+			for i := range resp.Cases {
+				resp.Cases[i].RuntimeMs, resp.Cases[i].PeakMemory = 0, 0
+				pass = pass && resp.Cases[i].Pass
+			}
+			if !reflect.DeepEqual(resp.Cases, tt.want) {
+				t.Errorf("Run cases =\n%+v\nwant:\n%+v", resp.Cases, tt.want)
+			}
+			if resp.Pass != pass {
+				t.Errorf("Run returned Pass=%v, want %v", resp.Pass, pass)
+			}
+		})
+	}
+}
+
+// TestProgramRunnerTimeout checks that the cases left when the total time of
+// the request runs out are not run.
+func TestProgramRunnerTimeout(t *testing.T) {
+	defer func(d time.Duration) { runTimeout = d }(runTimeout)
+	runTimeout = time.Second
+
+	req := RunRequest{
+		Text:  "import time\ntime.sleep(2)\n",
+		Cases: []TestCase{{Name: "slow"}, {Name: "late"}},
+	}
+	resp, err := pythonRunner.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if len(resp.Cases) != 2 {
+		t.Fatalf("Run returned %d cases, want 2", len(resp.Cases))
+	}
+	if got := resp.Cases[0].Error; !strings.Contains(got, "timed out") {
+		t.Errorf("Run returned error %q for the first case, want a timeout", got)
+	}
+	if got, want := resp.Cases[1].Error, "not run: test cases took longer than 1s"; got != want {
+		t.Errorf("Run returned error %q for the second case, want %q", got, want)
+	}
+	if resp.Pass {
+		t.Errorf("Run returned Pass=true, want false")
+	}
+}
@@ -0,0 +1,191 @@
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Rust edition used to format and compile programs.
+const rustEdition = "2021"
+
+// Cargo manifest for the throwaway project holding the program. The empty
+// workspace section keeps cargo from looking for workspaces in the parent
+// directories.
+const cargoManifest = `[package]
+name = "program"
+version = "0.1.0"
+edition = "%s"
+
+[[bin]]
+name = "program"
+path = "%s"
+
+[workspace]
+`
+
+// Regexp matching cargo lines to be removed (the diagnostics already tell
+// the story).
+var cargoCruftRegex = regexp.MustCompile("^error: could not compile `program`")
+
+// Resource limits for the Rust tools.
+var rustLimits = DefaultLimits
+
+// FingerprintRust identifies the versions of the Rust tools, for caching.
+var FingerprintRust = fingerprint([][]string{{"rustfmt", "--version"}, {"cargo", "clippy", "--version"}}, noFiles)
+
+// rustMessage is a compiler message in the JSON output of cargo
+// (--message-format=json). Only the fields we use are decoded.
+type rustMessage struct {
+	Reason  string `json:"reason"`
+	Message struct {
+		Message string `json:"message"`
+		Level   string `json:"level"`
+		Code    *struct {
+			Code string `json:"code"`
+		} `json:"code"`
+		Spans    []rustSpan `json:"spans"`
+		Children []struct {
+			Message string `json:"message"`
+			Level   string `json:"level"`
+		} `json:"children"`
+	} `json:"message"`
+}
+
+// rustSpan is a region of the source code referred to by a compiler message.
+type rustSpan struct {
+	LineStart   int  `json:"line_start"`
+	LineEnd     int  `json:"line_end"`
+	ColumnStart int  `json:"column_start"`
+	ColumnEnd   int  `json:"column_end"`
+	IsPrimary   bool `json:"is_primary"`
+}
+
+// LintRust lints programs written in Rust using rustfmt and clippy. The
+// program is compiled as the only source file of a cargo project in the
+// temporary directory, without dependencies (only std is available).
+func LintRust(ctx context.Context, req LintRequest) (LintResponse, error) {
+	// Save program text in request to file.
+	tempdir, tempfile, err := saveRequestToFile(ctx, req.Text, "*.rs")
+	if err != nil {
+		return LintResponse{}, err
+	}
+	defer os.RemoveAll(tempdir)
+
+	manifest := fmt.Sprintf(cargoManifest, rustEdition, filepath.Base(tempfile))
+	if err := os.WriteFile(filepath.Join(tempdir, "Cargo.toml"), []byte(manifest), 0644); err != nil {
+		return LintResponse{}, err
+	}
+
+	var diags []Diagnostic
+
+	// Reformat source code using rustfmt (in place). In case of errors, we
+	// move ahead with the old code and attempt linting anyway.
+	reformatted := req.Text
+	out, reformatErr := Execute(ctx, tempdir, rustLimits, "rustfmt", "rustfmt", "--edition", rustEdition, tempfile)
+	if reformatErr != nil {
+		diags = append(diags, formatterDiagnostics("rustfmt", fmt.Sprintf("Error reformatting Rust code: %v", reformatErr), reformatErr, out)...)
+		// rustfmt may have written a partially formatted file.
+		if err := os.WriteFile(tempfile, []byte(req.Text), 0644); err != nil {
+			return LintResponse{}, err
+		}
+	} else {
+		data, err := os.ReadFile(tempfile)
+		if err != nil {
+			return LintResponse{}, err
+		}
+		reformatted = string(data)
+	}
+
+	// Apply the clippy suggestions, if requested. The fixed program is
+	// linted below.
+	var fix fixResult
+	if req.Fix {
+		fix, err = runFixer(ctx, "clippy", tempdir, tempfile, rustLimits, "cargo", "clippy", "--fix", "--allow-no-vcs", "--allow-dirty",
+			"--offline", "--quiet")
+		if err != nil {
+			return LintResponse{}, err
+		}
+		diags = append(diags, fix.diags...)
+	}
+
+	// Clippy runs the compiler as well, so this reports compile errors and
+	// warnings too. Cargo returns an error code (101) on compile errors, but
+	// nothing on warnings. We look for the output instead.
+	out, err = Execute(ctx, tempdir, rustLimits, "clippy", "cargo", "clippy", "--offline", "--quiet", "--message-format=json")
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		diags = append(diags, toolDiagnostics("clippy", fmt.Sprintf("Error running clippy: %v", err), err, out)...)
+	} else {
+		diags = append(diags, rustFilterOutput(out)...)
+	}
+
+	// Create and return response.
+	return LintResponse{
+		Pass:            len(diags) == 0,
+		ErrorMessages:   ErrorMessages(diags),
+		Diagnostics:     setSource(diags, textSource(reformatErr == nil, fix.fixed())),
+		Reformatted:     reformatted != req.Text,
+		ReformattedText: reformatted,
+		Formatter:       "rustfmt",
+		Fixed:           fix.fixed(),
+		FixedText:       fix.text,
+		Fixes:           fix.edits,
+	}, nil
+}
+
+// rustFilterOutput converts the compiler messages in the JSON output of cargo
+// into diagnostics. Messages from clippy lints (codes starting with
+// "clippy::") are attributed to clippy, and the others to rustc. Other lines
+// emitted by cargo are included literally.
+func rustFilterOutput(output string) []Diagnostic {
+	var ret []Diagnostic
+	for _, v := range strings.Split(output, "\n") {
+		// Remove blank lines and cargo cruft.
+		if strings.TrimSpace(v) == "" || cargoCruftRegex.MatchString(v) {
+			continue
+		}
+		var m rustMessage
+		if !strings.HasPrefix(v, "{") || json.Unmarshal([]byte(v), &m) != nil {
+			ret = appendUnparsed(ret, "cargo", v)
+			continue
+		}
+		// Ignore build progress and notes like "For more information
+		// about this error, try...".
+		if m.Reason != "compiler-message" || m.Message.Level == "failure-note" {
+			continue
+		}
+
+		d := Diagnostic{
+			Tool:     "rustc",
+			Severity: m.Message.Level,
+			Message:  m.Message.Message,
+		}
+		if m.Message.Code != nil {
+			d.RuleID = m.Message.Code.Code
+			if strings.HasPrefix(d.RuleID, "clippy::") {
+				d.Tool = "clippy"
+			}
+		}
+		for _, s := range m.Message.Spans {
+			if s.IsPrimary {
+				d.Line, d.Column, d.EndLine, d.EndColumn = s.LineStart, s.ColumnStart, s.LineEnd, s.ColumnEnd
+				break
+			}
+		}
+		// Children hold help and notes (E.g. suggestions).
+		for _, c := range m.Message.Children {
+			d.Context = append(d.Context, c.Level+": "+c.Message)
+		}
+		ret = append(ret, d)
+	}
+	return ret
+}
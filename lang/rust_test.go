@@ -0,0 +1,61 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRustFilterOutput(t *testing.T) {
+	out := `{"reason":"compiler-artifact","package_id":"program 0.1.0","target":{"name":"program"}}
+{"reason":"compiler-message","package_id":"program 0.1.0","message":{"message":"cannot find value ` + "`y`" + ` in this scope","code":{"code":"E0425","explanation":"..."},"level":"error","spans":[{"file_name":"main.rs","line_start":3,"line_end":3,"column_start":20,"column_end":21,"is_primary":true}],"children":[{"message":"a local variable with a similar name exists: ` + "`x`" + `","level":"help","spans":[]}]}}
+{"reason":"compiler-message","package_id":"program 0.1.0","message":{"message":"unneeded ` + "`return`" + ` statement","code":{"code":"clippy::needless_return","explanation":null},"level":"warning","spans":[{"file_name":"main.rs","line_start":5,"line_end":6,"column_start":5,"column_end":14,"is_primary":false},{"file_name":"main.rs","line_start":6,"line_end":6,"column_start":5,"column_end":13,"is_primary":true}],"children":[]}}
+{"reason":"compiler-message","package_id":"program 0.1.0","message":{"message":"aborting due to 1 previous error","code":null,"level":"error","spans":[],"children":[]}}
+{"reason":"compiler-message","package_id":"program 0.1.0","message":{"message":"For more information about this error, try ` + "`rustc --explain E0425`" + `.","code":null,"level":"failure-note","spans":[],"children":[]}}
+{"reason":"build-finished","success":false}
+error: could not compile ` + "`program`" + ` (bin "program") due to 1 previous error
+
+warning: unexpected cargo output
+`
+	want := []Diagnostic{
+		{
+			Tool:      "rustc",
+			Line:      3,
+			Column:    20,
+			EndLine:   3,
+			EndColumn: 21,
+			Severity:  "error",
+			RuleID:    "E0425",
+			Message:   "cannot find value `y` in this scope",
+			Context:   []string{"help: a local variable with a similar name exists: `x`"},
+		},
+		{
+			Tool:      "clippy",
+			Line:      6,
+			Column:    5,
+			EndLine:   6,
+			EndColumn: 13,
+			Severity:  "warning",
+			RuleID:    "clippy::needless_return",
+			Message:   "unneeded `return` statement",
+		},
+		{
+			Tool:     "rustc",
+			Severity: "error",
+			Message:  "aborting due to 1 previous error",
+			Context:  []string{"warning: unexpected cargo output"},
+		},
+	}
+	if got := rustFilterOutput(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("rustFilterOutput =\n%+v\nwant:\n%+v", got, want)
+	}
+
+	// Output that is not JSON at all.
+	got := rustFilterOutput("error: no such command: `clippy`\n")
+	want = []Diagnostic{{Tool: "cargo", Message: "error: no such command: `clippy`"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rustFilterOutput(no JSON) = %+v, want %+v", got, want)
+	}
+}
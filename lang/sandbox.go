@@ -0,0 +1,204 @@
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// SandboxConfig controls the isolation of the tools run by Execute.
+type SandboxConfig struct {
+	Enabled  bool     // Run tools inside Linux namespaces.
+	Writable []string // Paths kept writable inside the sandbox for the tools (besides the temporary directory).
+
+	// Paths the tools can write to through an overlay, discarded when
+	// each tool exits (E.g. the Go build and staticcheck caches). Writes
+	// never reach the paths themselves, so requests can't change them for
+	// each other.
+	Overlay []string
+
+	// Paths hidden from the programs run by Run (E.g. the response cache
+	// and the challenge profiles), besides the temporary directories and
+	// the home directory.
+	Hidden []string
+}
+
+// Sandbox holds the sandbox configuration used by Execute. It should only be
+// changed at startup, before any calls to Execute.
+var Sandbox = SandboxConfig{Enabled: true}
+
+// sandboxArg is the first argument passed to our own binary to run it as the
+// helper. The helper sets up the sandbox and resource limits and executes
+// the tool.
+const sandboxArg = "__op_web_linter_sandbox__"
+
+// sandboxExitCode is returned by the helper when the sandbox setup fails.
+const sandboxExitCode = 125
+
+// statusFd is the file descriptor where the helper reports the signal that
+// killed the tool, if any, and its peak resident memory, when running it
+// inside the sandbox. The exit code of the helper can't tell signals apart
+// from regular exit codes, and its rusage includes the memory of the server
+// it was forked from.
+const statusFd = 3
+
+// Environment variables passed to tools running inside the sandbox. Anything
+// else in the server environment is removed.
+var sandboxEnvVars = []string{
+	"CARGO_HOME",
+	"GOCACHE",
+	"GOPATH",
+	"GOROOT",
+	"HOME",
+	"JAVA_HOME",
+	"LANG",
+	"LC_ALL",
+	"PATH",
+	"RUSTUP_HOME",
+	"USER",
+}
+
+// helperSpec tells the helper what to do. It is passed as a JSON encoded
+// command-line argument.
+type helperSpec struct {
+	Sandbox    bool     // Set up the sandbox?
+	Writable   []string // Paths kept writable inside the sandbox.
+	Overlay    []string // Paths covered by a writable overlay inside the sandbox.
+	OverlayDir string   // Empty directory for the overlay upper layers (covered by a tmpfs inside the sandbox).
+	Hidden     []string // Paths replaced by empty directories inside the sandbox.
+	Limits     Limits   // Resource limits for the tool.
+}
+
+// RunSandboxHelper checks if the program was started as the helper (by
+// Execute). If so, it sets up the sandbox (if enabled) and resource limits
+// and executes the tool named in the command line, never returning.
+// Otherwise, it returns immediately. Call this function at the very
+// beginning of main.
+func RunSandboxHelper() {
+	if len(os.Args) < 4 || os.Args[1] != sandboxArg {
+		return
+	}
+	// Capabilities are per thread. Make sure the sandbox setup and the final
+	// exec happen in the same thread.
+	runtime.LockOSThread()
+
+	var spec helperSpec
+	if err := json.Unmarshal([]byte(os.Args[2]), &spec); err != nil {
+		sandboxFatal("invalid helper arguments: %v", err)
+	}
+	name, args := os.Args[3], os.Args[4:]
+
+	if spec.Sandbox {
+		if err := setupSandbox(spec); err != nil {
+			sandboxFatal("setup failed: %v", err)
+		}
+	}
+	// RLIMIT_NPROC limits the processes of the user. Inside the sandbox,
+	// that's the user in the new user namespace (Linux 5.14 or later), so
+	// concurrent tools don't count against each other's limits. Outside,
+	// they would, so there's no limit.
+	limits := spec.Limits
+	if !spec.Sandbox {
+		limits.Processes = 0
+	}
+	if err := applyLimits(limits); err != nil {
+		sandboxFatal("unable to set resource limits: %v", err)
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		sandboxFatal("%v", err)
+	}
+	argv := append([]string{name}, args...)
+
+	// In the new pid namespace the helper is init, and the kernel drops
+	// signals sent to init without a handler (E.g. SIGABRT from abort).
+	// Run the tool as a child instead.
+	if spec.Sandbox {
+		code, err := runTool(path, argv, os.Environ())
+		if err != nil {
+			sandboxFatal("run %s: %v", path, err)
+		}
+		os.Exit(code)
+	}
+	if err := execTool(path, argv, os.Environ()); err != nil {
+		sandboxFatal("exec %s: %v", path, err)
+	}
+}
+
+// sandboxFatal prints an error message to stderr and exits the helper.
+func sandboxFatal(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "sandbox: "+format+"\n", args...)
+	os.Exit(sandboxExitCode)
+}
+
+// sandboxEnv returns the environment for tools running inside the sandbox.
+// TMPDIR points to the temporary (and writable) directory. Cgo is disabled,
+// so that building Go programs never runs the C toolchain on them.
+func sandboxEnv(dir string) []string {
+	var env []string
+	for _, name := range sandboxEnvVars {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	return append(env, "TMPDIR="+dir, "CGO_ENABLED=0")
+}
+
+// command returns an exec.Cmd to run the program in dir through the helper,
+// using the sandbox (as described by spec) if enabled. The program is killed
+// when the context is done.
+func command(ctx context.Context, dir string, spec helperSpec, name string, args ...string) (*exec.Cmd, error) {
+	spec.Sandbox = Sandbox.Enabled
+	arg, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	self, err := helperPath()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, self, append([]string{sandboxArg, string(arg), name}, args...)...)
+	cmd.Dir = dir
+
+	if Sandbox.Enabled {
+		if cmd.SysProcAttr, err = sandboxSysProcAttr(); err != nil {
+			return nil, err
+		}
+		cmd.Env = sandboxEnv(dir)
+	}
+	return cmd, nil
+}
+
+// programHidden returns the paths hidden from the programs run by Run: the
+// temporary directories of other requests, the home directory (with the
+// tool configurations and caches) and the paths in Sandbox.Hidden.
+func programHidden() []string {
+	ret := []string{os.TempDir()}
+	if home, err := os.UserHomeDir(); err == nil {
+		ret = append(ret, home)
+	}
+	return append(ret, Sandbox.Hidden...)
+}
+
+// toolStatus returns the signal (zero if none) and peak resident memory (in
+// bytes) reported by the helper through the read end of the status pipe. ok
+// is false if the helper didn't report them.
+func toolStatus(r io.Reader) (sig syscall.Signal, peak int64, ok bool) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, 0, false
+	}
+	if _, err := fmt.Sscan(string(data), &sig, &peak); err != nil {
+		return 0, 0, false
+	}
+	return sig, peak, true
+}
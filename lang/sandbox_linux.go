@@ -0,0 +1,393 @@
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Linux constants not defined in the syscall package.
+const (
+	capNetAdmin          = 12
+	capSysAdmin          = 21
+	prSetNoNewPrivs      = 38
+	prCapAmbient         = 47
+	prCapAmbientClearAll = 4
+)
+
+// Mount options in /proc/self/mountinfo that must be preserved when
+// remounting read-only. The kernel refuses to clear "locked" flags
+// inherited from the parent namespace.
+var mountFlags = map[string]uintptr{
+	"nosuid":     syscall.MS_NOSUID,
+	"nodev":      syscall.MS_NODEV,
+	"noexec":     syscall.MS_NOEXEC,
+	"noatime":    syscall.MS_NOATIME,
+	"nodiratime": syscall.MS_NODIRATIME,
+	"relatime":   syscall.MS_RELATIME,
+}
+
+// Options of the tmpfs mounted over hidden paths. Programs may use them as
+// scratch space (E.g. /tmp), up to a small size.
+const hiddenTmpfsOptions = "mode=755,size=16m,nr_inodes=4096"
+
+// helperPath returns the path to our own binary, used to start the helper.
+func helperPath() (string, error) {
+	return "/proc/self/exe", nil
+}
+
+// sandboxSysProcAttr returns the attributes to start the helper in new user,
+// mount, pid, network, ipc and uts namespaces. The helper keeps the same
+// uid/gid (mapped into the namespace) and only CAP_SYS_ADMIN and
+// CAP_NET_ADMIN, which it drops before executing the tool.
+func sandboxSysProcAttr() (*syscall.SysProcAttr, error) {
+	uid, gid := os.Getuid(), os.Getgid()
+	return &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+			syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}},
+		GidMappingsEnableSetgroups: false,
+		AmbientCaps:                []uintptr{capSysAdmin, capNetAdmin},
+		Pdeathsig:                  syscall.SIGKILL,
+	}, nil
+}
+
+// setupSandbox runs inside the sandbox helper. It makes the entire
+// filesystem read-only, except for the paths in spec.Writable and the
+// overlays on the paths in spec.Overlay, hides the paths in spec.Hidden
+// behind empty tmpfs mounts, mounts a new /proc for the pid namespace and
+// brings up the loopback interface.
+func setupSandbox(spec helperSpec) error {
+	// The working directory refers to the mounts we are about to cover.
+	// Remember it to enter it again at the end.
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	// Some tools (E.g. cargo fix) talk to their own processes over TCP. The
+	// network namespace only contains the loopback interface, so this gives
+	// no access to the outside. Failure is not fatal.
+	loopbackUp()
+
+	// Don't propagate anything we do here back to the host.
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return err
+	}
+
+	// Bind mount writable paths onto themselves, so they become separate
+	// mount points that are left alone below.
+	keep := map[string]bool{}
+	for _, p := range spec.Writable {
+		p = filepath.Clean(p)
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		if err := syscall.Mount(p, p, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return err
+		}
+		keep[p] = true
+	}
+	overlays, err := mountOverlays(spec.Overlay, spec.OverlayDir)
+	if err != nil {
+		return err
+	}
+	for _, p := range overlays {
+		keep[p] = true
+	}
+
+	// A new /proc reflects the new pid namespace. This may fail under
+	// container runtimes that mask parts of /proc, so failure is not fatal.
+	syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, "")
+
+	mounts, err := readMountInfo()
+	if err != nil {
+		return err
+	}
+	for _, m := range mounts {
+		if underAny(m.path, keep) {
+			continue
+		}
+		flags := syscall.MS_REMOUNT | syscall.MS_BIND | syscall.MS_RDONLY | m.flags
+		err := syscall.Mount("", m.path, "", flags, "")
+		// Some special filesystems cannot be remounted. Failing to make the
+		// root read-only, however, defeats the purpose of the sandbox.
+		if err != nil && m.path == "/" {
+			return err
+		}
+	}
+	if err := hidePaths(spec.Hidden, keep); err != nil {
+		return err
+	}
+
+	// The working directory still refers to the mount underneath the mounts
+	// above. Enter it again so that relative paths are writable.
+	return os.Chdir(wd)
+}
+
+// mountOverlays mounts a tmpfs on dir, and an overlay on each one of the
+// paths that exists, with the upper layer in the tmpfs. Tools can write to
+// the paths, but the changes are discarded with the mount namespace. Returns
+// the paths covered.
+func mountOverlays(paths []string, dir string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	if err := syscall.Mount("tmpfs", dir, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0700"); err != nil {
+		return nil, err
+	}
+	var ret []string
+	for i, p := range paths {
+		p = filepath.Clean(p)
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		// Commas separate the mount options.
+		if strings.Contains(p, ",") {
+			return nil, fmt.Errorf("overlay path %q contains a comma", p)
+		}
+		upper := filepath.Join(dir, strconv.Itoa(i), "upper")
+		work := filepath.Join(dir, strconv.Itoa(i), "work")
+		for _, d := range []string{upper, work} {
+			if err := os.MkdirAll(d, 0700); err != nil {
+				return nil, err
+			}
+		}
+		opts := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", p, upper, work)
+		if err := syscall.Mount("overlay", p, "overlay", 0, opts); err != nil {
+			return nil, fmt.Errorf("overlay on %s: %v", p, err)
+		}
+		ret = append(ret, p)
+	}
+	return ret, nil
+}
+
+// hidePaths mounts an empty tmpfs over each one of the paths in hidden that
+// exists. Writable paths below them (E.g. the temporary directory of the
+// program, below /tmp) are mounted again on top, through file descriptors
+// opened before hiding them.
+func hidePaths(hidden []string, writable map[string]bool) error {
+	set := map[string]bool{}
+	for _, p := range hidden {
+		set[filepath.Clean(p)] = true
+	}
+	fds := map[string]int{}
+	defer func() {
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+	}()
+	for p := range writable {
+		if !underAny(p, set) {
+			continue
+		}
+		fd, err := syscall.Open(p, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			return err
+		}
+		fds[p] = fd
+	}
+
+	for p := range set {
+		// Paths inside others hidden before no longer exist.
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		if err := syscall.Mount("tmpfs", p, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, hiddenTmpfsOptions); err != nil {
+			return err
+		}
+	}
+	for p, fd := range fds {
+		if err := os.MkdirAll(p, 0700); err != nil {
+			return err
+		}
+		if err := syscall.Mount(fmt.Sprintf("/proc/self/fd/%d", fd), p, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loopbackUp brings up the loopback interface of the current network
+// namespace.
+func loopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	// struct ifreq: interface name followed by the flags (a short).
+	var ifr [40]byte
+	copy(ifr[:syscall.IFNAMSIZ-1], "lo")
+	flags := (*uint16)(unsafe.Pointer(&ifr[syscall.IFNAMSIZ]))
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCGIFFLAGS, uintptr(unsafe.Pointer(&ifr[0]))); errno != 0 {
+		return errno
+	}
+	*flags |= syscall.IFF_UP
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&ifr[0]))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// applyLimits sets the resource limits (rlimits) of the current process.
+// They are inherited by the tool executed next. Zero means no limit.
+func applyLimits(limits Limits) error {
+	rlimits := []struct {
+		resource int
+		value    uint64
+		extra    uint64 // Added to the hard limit.
+	}{
+		{syscall.RLIMIT_AS, limits.AddressSpace, 0},
+		// The soft limit sends SIGXCPU, the hard limit SIGKILL.
+		{syscall.RLIMIT_CPU, limits.CPUTime, 1},
+		{rlimitNproc, limits.Processes, 0},
+		{syscall.RLIMIT_FSIZE, limits.FileSize, 0},
+	}
+	for _, r := range rlimits {
+		if r.value == 0 {
+			continue
+		}
+		rl := syscall.Rlimit{Cur: r.value, Max: r.value + r.extra}
+		if err := syscall.Setrlimit(r.resource, &rl); err != nil {
+			return fmt.Errorf("resource %d: %v", r.resource, err)
+		}
+	}
+	return nil
+}
+
+// execTool drops all capabilities and executes the program. Only returns on
+// errors.
+func execTool(path string, argv, env []string) error {
+	if err := dropPrivileges(); err != nil {
+		return err
+	}
+	return syscall.Exec(path, argv, env)
+}
+
+// runTool drops all capabilities, runs the program as a child and waits for
+// it, reaping any orphans in the meantime (as init of the pid namespace).
+// Returns the exit code of the program, or 128 plus the signal number if it
+// was killed by a signal. The signal (zero if none) and the peak resident
+// memory of the program are also written to statusFd.
+func runTool(path string, argv, env []string) (int, error) {
+	syscall.CloseOnExec(statusFd)
+	if err := dropPrivileges(); err != nil {
+		return 0, err
+	}
+	pid, err := syscall.ForkExec(path, argv, &syscall.ProcAttr{Env: env, Files: []uintptr{0, 1, 2}})
+	if err != nil {
+		return 0, err
+	}
+	for {
+		var status syscall.WaitStatus
+		var rusage syscall.Rusage
+		wpid, err := syscall.Wait4(-1, &status, 0, &rusage)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if wpid != pid {
+			continue
+		}
+		var sig syscall.Signal
+		if status.Signaled() {
+			sig = status.Signal()
+		}
+		// Maxrss is in kilobytes.
+		syscall.Write(statusFd, []byte(fmt.Sprintf("%d %d", sig, rusage.Maxrss<<10)))
+		if sig != 0 {
+			return 128 + int(sig), nil
+		}
+		return status.ExitStatus(), nil
+	}
+}
+
+// dropPrivileges clears the ambient capabilities of the current thread and
+// prevents programs executed from it from gaining privileges.
+func dropPrivileges() error {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClearAll, 0); errno != 0 {
+		return errno
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// mountInfo contains the information about a single mount point.
+type mountInfo struct {
+	path  string
+	flags uintptr
+}
+
+// readMountInfo parses /proc/self/mountinfo, returning all mount points and
+// the flags to be preserved when remounting them.
+func readMountInfo() ([]mountInfo, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ret []mountInfo
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Format: id parent major:minor root mountpoint options ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		m := mountInfo{path: unescapeMountPath(fields[4])}
+		for _, opt := range strings.Split(fields[5], ",") {
+			m.flags |= mountFlags[opt]
+		}
+		ret = append(ret, m)
+	}
+	return ret, scanner.Err()
+}
+
+// unescapeMountPath decodes the octal escapes (E.g. \040 for space) used in
+// paths inside /proc/self/mountinfo.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// underAny returns true if path is one of the paths in the set, or is
+// located below one of them.
+func underAny(path string, set map[string]bool) bool {
+	for p := range set {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
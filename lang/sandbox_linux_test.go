@@ -0,0 +1,281 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// enableSandbox enables the sandbox for the duration of a test, with the
+// given writable paths. Skips the test if the sandbox can't be created
+// (E.g. user namespaces are disabled).
+func enableSandbox(t *testing.T, writable ...string) {
+	t.Helper()
+	saved := Sandbox
+	t.Cleanup(func() { Sandbox = saved })
+	Sandbox = SandboxConfig{Enabled: true, Writable: writable}
+
+	if out, err := Execute(context.Background(), t.TempDir(), Limits{}, "true", "true"); err != nil {
+		t.Skipf("Sandbox not available: %v: %s", err, out)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	writable := t.TempDir()
+	readonly := t.TempDir()
+	enableSandbox(t, writable)
+
+	t.Setenv("SECRET_TOKEN", "secret")
+	dir := t.TempDir()
+	script := `
+		echo ok > prog.out && echo "dir writable"
+		echo ok > "$1/file" && echo "extra path writable"
+		{ echo ok > "$2/file"; } 2>/dev/null || echo "read-only"
+		echo "token=$SECRET_TOKEN"
+		echo "tmpdir=$TMPDIR"
+	`
+	out, err := Execute(context.Background(), dir, Limits{}, "sh", "sh", "-c", script, "sh", writable, readonly)
+	if err != nil {
+		t.Fatalf("Execute returned error: %v: %s", err, out)
+	}
+	want := "dir writable\nextra path writable\nread-only\ntoken=\ntmpdir=" + dir + "\n"
+	if out != want {
+		t.Errorf("Execute in the sandbox returned:\n%s\nwant:\n%s", out, want)
+	}
+	if _, err := os.Stat(filepath.Join(readonly, "file")); err == nil {
+		t.Errorf("Sandboxed program wrote to a read-only directory")
+	}
+}
+
+// TestSandboxOverlay checks that tools can write to the paths in
+// Sandbox.Overlay, without changing them outside the sandbox.
+func TestSandboxOverlay(t *testing.T) {
+	shared := t.TempDir()
+	if err := os.WriteFile(filepath.Join(shared, "cached"), []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	enableSandbox(t)
+	Sandbox.Overlay = []string{shared}
+
+	script := `
+		cat "$1/cached"
+		echo new > "$1/cached" && echo new > "$1/added" && echo "overlay writable"
+		cat "$1/cached"
+		echo "cgo=$CGO_ENABLED"
+	`
+	for i := 0; i < 2; i++ {
+		out, err := Execute(context.Background(), t.TempDir(), Limits{}, "sh", "sh", "-c", script, "sh", shared)
+		if err != nil {
+			t.Fatalf("Execute returned error: %v: %s", err, out)
+		}
+		if want := "old\noverlay writable\nnew\ncgo=0\n"; out != want {
+			t.Errorf("Execute %d in the sandbox returned:\n%s\nwant:\n%s", i+1, out, want)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(shared, "cached")); err != nil || string(data) != "old\n" {
+		t.Errorf("Overlay path changed outside the sandbox: %q (error %v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(shared, "added")); err == nil {
+		t.Errorf("Sandboxed program added a file to the overlay path")
+	}
+}
+
+func TestSandboxNetwork(t *testing.T) {
+	enableSandbox(t)
+	// Only the loopback interface exists in the network namespace.
+	out, err := Execute(context.Background(), t.TempDir(), Limits{}, "cat", "cat", "/proc/net/dev")
+	if err != nil {
+		t.Fatalf("Execute returned error: %v: %s", err, out)
+	}
+	for _, line := range strings.Split(out, "\n")[2:] {
+		if name, _, ok := strings.Cut(strings.TrimSpace(line), ":"); ok && name != "lo" {
+			t.Errorf("Sandbox has network interface %q", name)
+		}
+	}
+}
+
+// TestSandboxLoopback checks that programs in the sandbox can talk to each
+// other over the loopback interface.
+func TestSandboxLoopback(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 not available")
+	}
+	enableSandbox(t)
+	script := `import socket
+s = socket.socket()
+s.bind(("127.0.0.1", 0))
+s.listen()
+socket.create_connection(s.getsockname(), timeout=5)
+print("connected")
+`
+	out, err := Execute(context.Background(), t.TempDir(), Limits{}, "python3", "python3", "-c", script)
+	if err != nil || out != "connected\n" {
+		t.Errorf("Connection over the loopback interface returned %q, %v, want %q", out, err, "connected\n")
+	}
+}
+
+func TestUnescapeMountPath(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"/tmp", "/tmp"},
+		{`/mnt/my\040disk`, "/mnt/my disk"},
+		{`/a\134b`, `/a\b`},
+		{`/trailing\04`, `/trailing\04`},
+		{`/not\999octal`, `/not\999octal`},
+	}
+	for _, tt := range tests {
+		if got := unescapeMountPath(tt.in); got != tt.want {
+			t.Errorf("unescapeMountPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUnderAny(t *testing.T) {
+	set := map[string]bool{"/home/linter/.cache": true, "/tmp/lint123": true}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/tmp/lint123", true},
+		{"/tmp/lint123/sub", true},
+		{"/tmp/lint1234", false},
+		{"/home/linter", false},
+		{"/", false},
+	}
+	for _, tt := range tests {
+		if got := underAny(tt.path, set); got != tt.want {
+			t.Errorf("underAny(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestSandboxRunCase checks that programs run against test cases can only
+// write to their own directory, not to the tool caches in Sandbox.Writable.
+func TestSandboxRunCase(t *testing.T) {
+	cache := t.TempDir()
+	enableSandbox(t, cache)
+
+	script := `
+		echo ok > prog.out && echo "dir writable"
+		{ echo ok > "$1/file"; } 2>/dev/null || echo "cache read-only"
+	`
+	tc := TestCase{Expected: "dir writable\ncache read-only\n"}
+	result, err := runCase(context.Background(), t.TempDir(), DefaultLimits, caseTimeout, tc, "sh", "-c", script, "sh", cache)
+	if err != nil {
+		t.Fatalf("runCase returned error: %v", err)
+	}
+	if !result.Pass {
+		t.Errorf("runCase returned output %q (stderr %q), want %q", result.Stdout, result.Stderr, tc.Expected)
+	}
+}
+
+// TestSandboxHidden checks that programs run against test cases don't see
+// the hidden paths or the other temporary directories, but still see their
+// own directory.
+func TestSandboxHidden(t *testing.T) {
+	hidden := t.TempDir()
+	if err := os.WriteFile(filepath.Join(hidden, "secret"), []byte("secret\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	other, err := os.MkdirTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(other)
+	enableSandbox(t)
+	Sandbox.Hidden = []string{hidden}
+
+	dir, err := os.MkdirTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "input"), []byte("input\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	script := `
+		cat input
+		cat "$1/secret" 2>/dev/null || echo "hidden path not visible"
+		ls "$2" 2>/dev/null || echo "other directory not visible"
+		echo ok > prog.out && echo "dir writable"
+	`
+	tc := TestCase{Expected: "input\nhidden path not visible\nother directory not visible\ndir writable\n"}
+	result, err := runCase(context.Background(), dir, DefaultLimits, caseTimeout, tc, "sh", "-c", script, "sh", hidden, other)
+	if err != nil {
+		t.Fatalf("runCase returned error: %v", err)
+	}
+	if !result.Pass {
+		t.Errorf("runCase returned output %q (stderr %q), want %q", result.Stdout, result.Stderr, tc.Expected)
+	}
+}
+
+// TestSandboxSignal checks that the signal that killed a program is
+// reported from inside the sandbox, where the helper is init of the pid
+// namespace.
+func TestSandboxSignal(t *testing.T) {
+	enableSandbox(t)
+	result, err := runCase(context.Background(), t.TempDir(), DefaultLimits, caseTimeout, TestCase{}, "sh", "-c", "kill -ABRT $$")
+	if err != nil {
+		t.Fatalf("runCase returned error: %v", err)
+	}
+	if result.Pass || result.Signal != "aborted" {
+		t.Errorf("runCase returned Pass=%v and signal %q, want false and %q", result.Pass, result.Signal, "aborted")
+	}
+}
+
+// TestSandboxPeakMemory checks that the peak memory of a program run inside
+// the sandbox doesn't include the memory of the server.
+func TestSandboxPeakMemory(t *testing.T) {
+	enableSandbox(t)
+	tests := []struct {
+		script   string
+		min, max int64
+	}{
+		{"exit 0", 0, 32 << 20},
+		{`exec python3 -c 'b = bytearray(64 << 20)'`, 64 << 20, 128 << 20},
+	}
+	for _, tt := range tests {
+		result, err := runCase(context.Background(), t.TempDir(), DefaultLimits, caseTimeout, TestCase{}, "sh", "-c", tt.script)
+		if err != nil {
+			t.Fatalf("runCase(%q) returned error: %v", tt.script, err)
+		}
+		if result.PeakMemory < tt.min || result.PeakMemory > tt.max {
+			t.Errorf("runCase(%q) returned PeakMemory %d, want between %d and %d", tt.script, result.PeakMemory, tt.min, tt.max)
+		}
+	}
+}
+
+// TestSandboxProcessLimit checks that the process limit only counts the
+// processes of the tool, not other processes of the same user (E.g. tools
+// running for other requests).
+func TestSandboxProcessLimit(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("Process limits don't apply to root")
+	}
+	enableSandbox(t)
+
+	const others = 20
+	for i := 0; i < others; i++ {
+		cmd := exec.Command("sleep", "30")
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		})
+	}
+	limits := Limits{Processes: others / 2}
+	out, err := Execute(context.Background(), t.TempDir(), limits, "sh", "sh", "-c", "sleep 0 & sleep 0 & wait; echo ok")
+	if err != nil || out != "ok\n" {
+		t.Errorf("Execute with %d other processes returned %q and error %v, want %q", others, out, err, "ok\n")
+	}
+}
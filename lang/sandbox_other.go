@@ -0,0 +1,47 @@
+//go:build !linux
+
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// errNoSandbox is returned when the sandbox is enabled on unsupported platforms.
+var errNoSandbox = errors.New("sandbox is only supported on Linux (disable it with --sandbox=false)")
+
+// helperPath returns the path to our own binary, used to start the helper.
+func helperPath() (string, error) {
+	return os.Executable()
+}
+
+// sandboxSysProcAttr always fails outside Linux.
+func sandboxSysProcAttr() (*syscall.SysProcAttr, error) {
+	return nil, errNoSandbox
+}
+
+// setupSandbox always fails outside Linux.
+func setupSandbox(spec helperSpec) error {
+	return errNoSandbox
+}
+
+// applyLimits does nothing outside Linux (except for the output limit,
+// enforced by Execute).
+func applyLimits(limits Limits) error {
+	return nil
+}
+
+// runTool always fails outside Linux.
+func runTool(path string, argv, env []string) (int, error) {
+	return 0, errNoSandbox
+}
+
+// execTool executes the program. Only returns on errors.
+func execTool(path string, argv, env []string) error {
+	return syscall.Exec(path, argv, env)
+}
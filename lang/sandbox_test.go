@@ -0,0 +1,34 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Tests enabling the sandbox re-execute the test binary as the helper.
+	RunSandboxHelper()
+
+	// Other tests run the tools directly.
+	Sandbox.Enabled = false
+	os.Exit(m.Run())
+}
+
+func TestSandboxEnv(t *testing.T) {
+	for _, name := range sandboxEnvVars {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	t.Setenv("HOME", "/home/linter")
+	t.Setenv("PATH", "/usr/bin:/bin")
+	t.Setenv("SECRET_TOKEN", "secret")
+
+	want := []string{"HOME=/home/linter", "PATH=/usr/bin:/bin", "TMPDIR=/tmp/lint123", "CGO_ENABLED=0"}
+	if got := sandboxEnv("/tmp/lint123"); !reflect.DeepEqual(got, want) {
+		t.Errorf("sandboxEnv = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,142 @@
+// Package lang defines all language specific components of op-web-linter.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package lang
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Regexp matching tsc lines (with --pretty false).
+// Sample line: prog.ts(3,7): error TS2322: Type 'string' is not assignable to type 'number'.
+var tscLineRegex = regexp.MustCompile(`^(.*)\(([0-9]+),([0-9]+)\): (error|warning|message) (TS[0-9]+): (.*)`)
+
+// Resource limits for the TypeScript tools. Like eslint, tsc runs on V8.
+var typescriptLimits = noMemoryLimit
+
+// FingerprintTypescript identifies the versions of the TypeScript tools and
+// configuration, for caching.
+var FingerprintTypescript = fingerprint([][]string{{"npx", "tsc", "--version"}, {"npx", "eslint", "--version"}}, func() []string {
+	return []string{os.Getenv("HOME") + "/op-web-linter/config/eslintrc-typescript.json"}
+})
+
+// typescriptConfig returns the contents of a strict tsconfig.json checking
+// only the program in fname. Type definitions (E.g. for node) are taken from
+// the packages installed in the home directory.
+func typescriptConfig(fname, homedir string) ([]byte, error) {
+	return json.MarshalIndent(map[string]any{
+		"compilerOptions": map[string]any{
+			"strict":                     true,
+			"noEmit":                     true,
+			"noImplicitReturns":          true,
+			"noFallthroughCasesInSwitch": true,
+			"noUnusedLocals":             true,
+			"noUnusedParameters":         true,
+			"target":                     "es2021",
+			"module":                     "commonjs",
+			"moduleResolution":           "node",
+			"lib":                        []string{"es2021", "dom"},
+			"typeRoots":                  []string{homedir + "/node_modules/@types"},
+			"skipLibCheck":               true,
+		},
+		"files": []string{filepath.Base(fname)},
+	}, "", "  ")
+}
+
+// LintTypescript lints programs written in TypeScript, using tsc for type
+// checking and eslint with the TypeScript parser.
+func LintTypescript(ctx context.Context, req LintRequest) (LintResponse, error) {
+	tempdir, tempfile, err := saveRequestToFile(ctx, req.Text, "*.ts")
+	if err != nil {
+		return LintResponse{}, err
+	}
+	defer os.RemoveAll(tempdir)
+
+	homedir := os.Getenv("HOME")
+	eslintrc := homedir + "/op-web-linter/config/eslintrc-typescript.json"
+
+	// The TypeScript rules in eslint need type information, so both tools
+	// use the same tsconfig.
+	tsconfig := filepath.Join(tempdir, "tsconfig.json")
+	data, err := typescriptConfig(tempfile, homedir)
+	if err != nil {
+		return LintResponse{}, err
+	}
+	if err := os.WriteFile(tsconfig, data, 0644); err != nil {
+		return LintResponse{}, err
+	}
+
+	// Apply the eslint fixes, if requested. The fixed program is linted below.
+	var fix fixResult
+	if req.Fix {
+		fix, err = runFixer(ctx, "eslint", tempdir, tempfile, typescriptLimits, "npx", "eslint", "--fix", "-c", eslintrc,
+			"--parser-options", "project:"+tsconfig, tempfile)
+		if err != nil {
+			return LintResponse{}, err
+		}
+	}
+
+	// tsc.
+	// Returns an error code on type errors.
+	o, tscErr := Execute(ctx, tempdir, typescriptLimits, "tsc", "npx", "tsc", "--noEmit", "--pretty", "false", "-p", tsconfig)
+	diags := TypescriptFilterOutput(strings.Split(o, "\n"), tempfile)
+	diags = append(diags, limitDiagnostics("tsc", tscErr)...)
+
+	// eslint.
+	// --max-warnings 0 makes eslint a return code for any warnings.
+	o, eslintErr := Execute(ctx, tempdir, typescriptLimits, "eslint", "npx", "eslint", "--max-warnings", "0", "-c", eslintrc,
+		"--parser-options", "project:"+tsconfig, tempfile)
+	diags = append(diags, JavascriptFilterOutput(strings.Split(o, "\n"), tempfile)...)
+	diags = append(diags, limitDiagnostics("eslint", eslintErr)...)
+	diags = append(fix.diags, diags...)
+
+	// Create and return response.
+	return LintResponse{
+		Pass:          tscErr == nil && eslintErr == nil && len(fix.diags) == 0,
+		ErrorMessages: ErrorMessages(diags),
+		Diagnostics:   setSource(diags, textSource(false, fix.fixed())),
+		Fixed:         fix.fixed(),
+		FixedText:     fix.text,
+		Fixes:         fix.edits,
+	}, nil
+}
+
+// TypescriptFilterOutput remove undesirable messages from the tsc output and
+// converts the remaining lines into diagnostics. Messages spanning multiple
+// lines (E.g. detailed type mismatches) keep the extra lines as context.
+func TypescriptFilterOutput(list []string, tempfile string) []Diagnostic {
+	var ret []Diagnostic
+	for _, v := range list {
+		// Remove blank lines.
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		// Parse file(line,column): severity code: message lines.
+		r := tscLineRegex.FindStringSubmatch(v)
+
+		// Unable to parse line. Include literally.
+		if len(r) < 7 {
+			ret = appendUnparsed(ret, "tsc", strings.TrimSpace(v))
+			continue
+		}
+		// Messages about other files (E.g. type definitions) have no
+		// position in the program.
+		d := Diagnostic{
+			Tool:     "tsc",
+			Severity: r[4],
+			RuleID:   r[5],
+			Message:  r[6],
+		}
+		if filepath.Base(r[1]) == filepath.Base(tempfile) {
+			d.Line, d.Column = atoi(r[2]), atoi(r[3])
+		}
+		ret = append(ret, d)
+	}
+	return ret
+}
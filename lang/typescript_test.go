@@ -0,0 +1,69 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package lang
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTypescriptFilterOutput(t *testing.T) {
+	tempfile := "/tmp/123/456.ts"
+	out := `456.ts(3,7): error TS2322: Type 'string' is not assignable to type 'number'.
+456.ts(10,3): error TS2345: Argument of type '{ a: string; }' is not assignable to parameter of type 'Foo'.
+  Property 'b' is missing in type '{ a: string; }' but required in type 'Foo'.
+
+../../home/linter/node_modules/@types/node/index.d.ts(1,1): error TS1084: Invalid 'reference' directive syntax.
+error TS5058: The specified path does not exist: 'tsconfig.json'.
+`
+	want := []Diagnostic{
+		{Tool: "tsc", Line: 3, Column: 7, Severity: "error", RuleID: "TS2322", Message: "Type 'string' is not assignable to type 'number'."},
+		{
+			Tool:     "tsc",
+			Line:     10,
+			Column:   3,
+			Severity: "error",
+			RuleID:   "TS2345",
+			Message:  "Argument of type '{ a: string; }' is not assignable to parameter of type 'Foo'.",
+			Context:  []string{"Property 'b' is missing in type '{ a: string; }' but required in type 'Foo'."},
+		},
+		{
+			Tool:     "tsc",
+			Severity: "error",
+			RuleID:   "TS1084",
+			Message:  "Invalid 'reference' directive syntax.",
+			Context:  []string{"error TS5058: The specified path does not exist: 'tsconfig.json'."},
+		},
+	}
+	if got := TypescriptFilterOutput(strings.Split(out, "\n"), tempfile); !reflect.DeepEqual(got, want) {
+		t.Errorf("TypescriptFilterOutput =\n%+v\nwant:\n%+v", got, want)
+	}
+}
+
+func TestTypescriptConfig(t *testing.T) {
+	data, err := typescriptConfig("/tmp/123/456.ts", "/home/linter")
+	if err != nil {
+		t.Fatalf("typescriptConfig returned error: %v", err)
+	}
+	var config struct {
+		CompilerOptions struct {
+			Strict    bool     `json:"strict"`
+			NoEmit    bool     `json:"noEmit"`
+			TypeRoots []string `json:"typeRoots"`
+		} `json:"compilerOptions"`
+		Files []string `json:"files"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("typescriptConfig returned invalid JSON: %v", err)
+	}
+	opts := config.CompilerOptions
+	if !opts.Strict || !opts.NoEmit || !reflect.DeepEqual(opts.TypeRoots, []string{"/home/linter/node_modules/@types"}) {
+		t.Errorf("typescriptConfig returned compiler options %+v", opts)
+	}
+	if want := []string{"456.ts"}; !reflect.DeepEqual(config.Files, want) {
+		t.Errorf("typescriptConfig returned files %v, want %v", config.Files, want)
+	}
+}
@@ -4,26 +4,35 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/osprogramadores/op-web-linter/common"
 	"github.com/osprogramadores/op-web-linter/handlers"
 	"github.com/osprogramadores/op-web-linter/lang"
+	"github.com/osprogramadores/op-web-linter/metrics"
 )
 
 // API paths.
 const (
-	lintURLPath      = "/lint"
-	languagesURLPath = "/languages"
-	pingURLPath      = "/ping"
-	staticURLPath    = "/static"
-	tmplURLPath      = "/t"
-	formTmplFile     = "form.html"
+	lintURLPath       = "/lint"
+	runURLPath        = "/run"
+	languagesURLPath  = "/languages"
+	challengesURLPath = "/challenges"
+	metricsURLPath    = "/metrics"
+	pingURLPath       = "/ping"
+	staticURLPath     = "/static"
+	tmplURLPath       = "/t"
+	formTmplFile      = "form.html"
 )
 
 // BuildVersion Holds the current git HEAD version number.
@@ -31,35 +40,136 @@ const (
 var BuildVersion string
 
 // supported contains the supported linter languages.
-var supported = handlers.SupportedLangs{
-	"c":          {Display: "C", LintFn: lang.LintC},
-	"cpp":        {Display: "C++", LintFn: lang.LintCPP},
-	"golang":     {Display: "Go", LintFn: lang.LintGo},
-	"java":       {Display: "Java  (reformat only)", LintFn: lang.LintJava},
-	"javascript": {Display: "Javascript (lint only)", LintFn: lang.LintJavascript},
-	"python":     {Display: "Python  (lint only)", LintFn: lang.LintPython},
-}
+var supported = lang.DefaultLanguages()
 
 func main() {
+	// When re-executed by lang.Execute, run the tool inside the sandbox. This
+	// never returns.
+	lang.RunSandboxHelper()
+
+	// Lint files from the command line instead of serving requests.
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		os.Exit(lintCommand(os.Args[2:]))
+	}
+
 	var (
 		port      = flag.Int("port", 10000, "Specify the TCP port to listen to")
 		apiurl    = flag.String("url", "http://localhost:{port}", "Base URL for API requests (no slash at the end)")
 		staticdir = flag.String("staticdir", "./static", "Directory where we serve static files")
 		tmpldir   = flag.String("templates", "./t", "Directory where we serve templates")
+		langfile  = flag.String("languages", "", "JSON file with additional language definitions (optional)")
+		chaldir   = flag.String("challenges", "", "Directory with challenge profiles (optional)")
+		sandbox   = flag.Bool("sandbox", true, "Run external tools inside a sandbox (disable for local development only)")
+		writable  = flag.String("sandbox-writable", "", "Colon separated list of paths kept writable inside the sandbox")
+		overlay   = flag.String("sandbox-overlay", defaultSandboxOverlay(), "Colon separated list of paths writable inside the sandbox through an overlay (changes are discarded)")
+		gochecks  = flag.String("go-checks", strings.Join(lang.DefaultGoChecks, ","), "Comma separated list of staticcheck checks run on Go programs")
+		govet     = flag.String("go-vet-checks", strings.Join(lang.DefaultGoVetChecks, ","), "Comma separated list of go vet analyzers run on Go programs")
+		workers   = flag.Int("workers", runtime.NumCPU(), "Maximum number of concurrent lint and run requests")
+		langwork  = flag.String("lang-workers", "", "Maximum concurrent lint requests per language (E.g. java=2,cpp=2)")
+		maxqueue  = flag.Int("max-queue", 50, "Maximum number of lint requests waiting for a free worker")
+		cachesize = flag.Int("cache-size", 1000, "Maximum number of lint responses cached in memory (0 to disable the cache)")
+		cachedir  = flag.String("cache-dir", "", "Directory to keep cached lint responses across restarts (optional)")
+		logformat = flag.String("log-format", "json", "Log format (json or text)")
+		loglevel  = flag.String("log-level", "info", "Minimum log level (debug, info, warn or error)")
+		logtext   = flag.Bool("log-program-text", false, "Include program text and tool output in debug logs (contains student code)")
 	)
 	flag.Parse()
 
+	logger, err := newLogger(*logformat, *loglevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting up logging: %v\n", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+	common.LogProgramText = *logtext
+
+	lang.Sandbox.Enabled = *sandbox
+	if *writable != "" {
+		lang.Sandbox.Writable = strings.Split(*writable, ":")
+	}
+	if *overlay != "" {
+		lang.Sandbox.Overlay = strings.Split(*overlay, ":")
+	}
+	lang.GoChecks = strings.Split(*gochecks, ",")
+	lang.GoVetChecks = strings.Split(*govet, ",")
+	if err := lang.CheckGoVetChecks(lang.GoVetChecks); err != nil {
+		fatal("Error parsing --go-vet-checks", "error", err)
+	}
+
+	// Programs run by /run must not see the cached responses or the
+	// expected outputs of the challenges.
+	for _, dir := range []string{*cachedir, *chaldir} {
+		if dir == "" {
+			continue
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			fatal("Error finding the absolute path", "dir", dir, "error", err)
+		}
+		lang.Sandbox.Hidden = append(lang.Sandbox.Hidden, abs)
+	}
+
 	// Replace {port} with actual port.
 	*apiurl = strings.ReplaceAll(*apiurl, "{port}", fmt.Sprintf("%d", *port))
 
 	u, err := url.Parse(*apiurl)
 	if err != nil {
-		log.Fatalf("Error parsing URL: %v", err)
+		fatal("Error parsing URL", "error", err)
 	}
 
-	log.Printf("Started op-web-linter, version %s", BuildVersion)
-	log.Printf("Listening on port %d", *port)
-	log.Printf("URL for API requests: %s", *apiurl)
+	slog.Info("Started op-web-linter", "version", BuildVersion)
+	slog.Info("Listening", "port", *port)
+	slog.Info("URL for API requests", "url", *apiurl)
+	slog.Info("Sandbox", "enabled", lang.Sandbox.Enabled, "writable", lang.Sandbox.Writable, "overlay", lang.Sandbox.Overlay, "hidden", lang.Sandbox.Hidden)
+	slog.Info("Go checks", "checks", lang.GoChecks, "vet_checks", lang.GoVetChecks)
+
+	if err := checkPoolFlags(*workers, *maxqueue); err != nil {
+		fatal("Invalid worker pool flags", "error", err)
+	}
+	langWorkers, err := parseLangWorkers(*langwork)
+	if err != nil {
+		fatal("Error parsing --lang-workers", "error", err)
+	}
+	pool := handlers.NewWorkerPool(*workers, langWorkers, *maxqueue)
+	slog.Info("Workers", "workers", *workers, "lang_workers", langWorkers, "max_queue", *maxqueue)
+	metrics.NewGaugeFunc("op_web_linter_queue_depth", "Lint requests waiting for a free worker.", func() float64 {
+		return float64(pool.Queued())
+	})
+
+	var cache *handlers.Cache
+	if *cachesize > 0 {
+		if cache, err = handlers.NewCache(*cachesize, *cachedir, BuildVersion); err != nil {
+			fatal("Error creating cache", "error", err)
+		}
+		slog.Info("Cache", "size", *cachesize, "dir", *cachedir)
+	}
+
+	// Add languages defined in the configuration file, if any.
+	if err := loadLanguages(*langfile); err != nil {
+		fatal("Error loading languages", "error", err)
+	}
+
+	// Identify the versions of the tools, for caching. Languages with
+	// missing tools still work (reporting the errors), but are not cached.
+	if cache != nil {
+		if err := lang.ComputeFingerprints(context.Background()); err != nil {
+			slog.Warn("Unable to identify tool versions (responses for these languages are not cached)", "error", err)
+		}
+	}
+
+	// Build the export data of the Go standard library once, before any
+	// request (Go requests build it otherwise).
+	if err := lang.BuildGoExportData(context.Background()); err != nil {
+		slog.Warn("Unable to build the Go export data", "error", err)
+	}
+
+	// Load challenge profiles, if any.
+	if *chaldir != "" {
+		if lang.Challenges, err = lang.LoadChallenges(*chaldir); err != nil {
+			fatal("Error loading challenges", "error", err)
+		}
+		slog.Info("Loaded challenges", "count", len(lang.Challenges), "dir", *chaldir)
+	}
 
 	// All information required to serve the form. All paths end in slash.
 	formdata := &handlers.FormData{
@@ -67,6 +177,7 @@ func main() {
 		LintPath:       u.Path + lintURLPath + "/",
 		StaticPath:     u.Path + staticURLPath + "/",
 		LanguagesPath:  u.Path + languagesURLPath + "/",
+		ChallengesPath: u.Path + challengesURLPath + "/",
 		TmplPath:       u.Path + tmplURLPath + "/",
 		StaticDir:      *staticdir,
 		SupportedLangs: supported,
@@ -77,14 +188,24 @@ func main() {
 		handlers.LanguagesHandler(w, r, supported)
 	})
 
+	// Send list of challenges back to caller.
+	http.HandleFunc(formdata.ChallengesPath, func(w http.ResponseWriter, r *http.Request) {
+		handlers.ChallengesHandler(w, r, lang.Challenges)
+	})
+
 	// Lint request.
 	http.HandleFunc(formdata.LintPath, func(w http.ResponseWriter, r *http.Request) {
-		handlers.LintRequestHandler(w, r, supported)
+		handlers.LintRequestHandler(w, r, supported, pool, cache)
+	})
+
+	// Run request (build and run against test cases).
+	http.HandleFunc(u.Path+runURLPath+"/", func(w http.ResponseWriter, r *http.Request) {
+		handlers.RunRequestHandler(w, r, supported, pool)
 	})
 
 	// Pre-parse templates and register handlers.
 	if err := handlers.TmplSetup(*tmpldir, formdata.TmplPath, formdata); err != nil {
-		log.Fatalf("Error setting up template handlers: %v", err)
+		fatal("Error setting up template handlers", "error", err)
 	}
 
 	// Everything under staticURLPath is served as a regular file from rootdir.
@@ -92,12 +213,15 @@ func main() {
 	fs := http.FileServer(http.Dir(*staticdir))
 	http.Handle(formdata.StaticPath, http.StripPrefix(formdata.StaticPath, fs))
 
+	// Metrics in Prometheus text format.
+	http.HandleFunc(u.Path+metricsURLPath, metrics.Handler)
+
 	// This is a simple /ping handler that just returns "pong" and does not
 	// log anything. Useful for health probers.
 	http.HandleFunc(u.Path+pingURLPath+"/", func(w http.ResponseWriter, r *http.Request) {
 		// Only GET requests.
 		if r.Method != "GET" {
-			common.HTTPError(w, "Only POST requested accepted", http.StatusMethodNotAllowed)
+			common.HTTPError(w, r, "Only POST requested accepted", http.StatusMethodNotAllowed)
 			return
 		}
 		fmt.Fprintln(w, "pong")
@@ -108,7 +232,7 @@ func main() {
 	// function will emit a 404 if the path is anything other than "/".
 	// If everything is OK, it emits a 302 to the form path (served as a template).
 	http.HandleFunc(formdata.RootPath, func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("FORM Request %s %s %s\n", common.RealRemoteAddress(r), r.Method, r.URL)
+		common.Logger(r.Context()).Info("FORM Request", "remote", common.RealRemoteAddress(r), "method", r.Method, "url", r.URL.String())
 
 		if r.URL.Path != formdata.RootPath {
 			http.NotFound(w, r)
@@ -118,6 +242,85 @@ func main() {
 		http.Redirect(w, r, u, http.StatusTemporaryRedirect)
 	})
 
-	log.Printf("Serving static files on path: %s", formdata.StaticPath)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", *port), nil))
+	slog.Info("Serving static files", "path", formdata.StaticPath)
+
+	// Assign an ID to every request (returned in the X-Request-ID header).
+	err = http.ListenAndServe(fmt.Sprintf(":%d", *port), common.RequestIDHandler(http.DefaultServeMux))
+	fatal("Server stopped", "error", err)
+}
+
+// newLogger creates a logger writing to stderr in the given format (json or
+// text), logging messages at or above level.
+func newLogger(format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid log format: %q", format)
+}
+
+// fatal logs an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// defaultSandboxOverlay returns the default list of paths covered by an
+// overlay inside the sandbox. Go and staticcheck need writable caches, so the
+// tools can use (but not change) the shared caches. Paths that don't exist are
+// ignored by the sandbox.
+func defaultSandboxOverlay() string {
+	gocache := os.Getenv("GOCACHE")
+	dir, err := os.UserCacheDir()
+	if gocache == "" && err == nil {
+		gocache = filepath.Join(dir, "go-build")
+	}
+	var ret []string
+	if gocache != "" {
+		ret = append(ret, gocache)
+	}
+	if err == nil {
+		ret = append(ret, filepath.Join(dir, "staticcheck"))
+	}
+	return strings.Join(ret, ":")
+}
+
+// parseLangWorkers parses a list of comma separated lang=workers pairs into a map.
+func parseLangWorkers(s string) (map[string]int, error) {
+	ret := map[string]int{}
+	if s == "" {
+		return ret, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		lang, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid entry (expected lang=workers): %q", pair)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid number of workers for %s: %q", lang, value)
+		}
+		ret[strings.TrimSpace(lang)] = n
+	}
+	return ret, nil
+}
+
+// checkPoolFlags validates the --workers and --max-queue flags. A pool with
+// no slots would block every request forever.
+func checkPoolFlags(workers, maxQueue int) error {
+	if workers < 1 {
+		return fmt.Errorf("--workers must be at least 1 (got %d)", workers)
+	}
+	if maxQueue < 0 {
+		return fmt.Errorf("--max-queue must not be negative (got %d)", maxQueue)
+	}
+	return nil
 }
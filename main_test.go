@@ -0,0 +1,47 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLangWorkers(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    map[string]int
+		wantErr bool
+	}{
+		{s: "", want: map[string]int{}},
+		{s: "java=2,cpp=1", want: map[string]int{"java": 2, "cpp": 1}},
+		{s: "java", wantErr: true},
+		{s: "java=x", wantErr: true},
+		{s: "java=0", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseLangWorkers(tt.s)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("parseLangWorkers(%q) = %v, %v, want %v (error: %v)", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckPoolFlags(t *testing.T) {
+	tests := []struct {
+		workers, maxQueue int
+		wantErr           bool
+	}{
+		{1, 0, false},
+		{4, 50, false},
+		{0, 50, true},
+		{-1, 50, true},
+		{4, -1, true},
+	}
+	for _, tt := range tests {
+		if err := checkPoolFlags(tt.workers, tt.maxQueue); (err != nil) != tt.wantErr {
+			t.Errorf("checkPoolFlags(%d, %d) = %v, want error: %v", tt.workers, tt.maxQueue, err, tt.wantErr)
+		}
+	}
+}
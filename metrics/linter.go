@@ -0,0 +1,34 @@
+// Package metrics exports server metrics in the Prometheus text format.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package metrics
+
+// Metrics collected by op-web-linter.
+var (
+	// Requests counts lint requests by language and outcome (pass, fail,
+	// busy, canceled or error).
+	Requests = NewCounterVec("op_web_linter_requests_total",
+		"Lint requests by language and outcome.", "lang", "outcome")
+
+	// RunRequests counts run requests by language and outcome (pass, fail,
+	// busy, canceled or error).
+	RunRequests = NewCounterVec("op_web_linter_run_requests_total",
+		"Run requests by language and outcome.", "lang", "outcome")
+
+	// ExecuteDuration measures the wall time of each external tool execution.
+	ExecuteDuration = NewHistogramVec("op_web_linter_execute_duration_seconds",
+		"Execution time of external tools in seconds.", DefaultBuckets, "tool")
+
+	// Timeouts counts external tool executions killed by the timeout.
+	Timeouts = NewCounterVec("op_web_linter_timeouts_total",
+		"External tool executions that timed out.", "tool")
+
+	// FormatterFailures counts reformatting attempts that failed.
+	FormatterFailures = NewCounterVec("op_web_linter_formatter_failures_total",
+		"Failed reformatting attempts.", "tool")
+
+	// CacheRequests counts cache lookups by result (hit or miss).
+	CacheRequests = NewCounterVec("op_web_linter_cache_requests_total",
+		"Lint response cache lookups by result.", "result")
+)
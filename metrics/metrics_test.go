@@ -0,0 +1,115 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrape returns the output of Handler.
+func scrape(t *testing.T) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	Handler(w, httptest.NewRequest("GET", "/metrics", nil))
+	if want := "text/plain; version=0.0.4; charset=utf-8"; w.Header().Get("content-type") != want {
+		t.Errorf("/metrics returned content type %q, want %q", w.Header().Get("content-type"), want)
+	}
+	return w.Body.String()
+}
+
+// checkLines checks that all lines are present, in order, in the output.
+func checkLines(t *testing.T, out string, lines ...string) {
+	t.Helper()
+	rest := out
+	for _, line := range lines {
+		i := strings.Index(rest, line+"\n")
+		if i < 0 {
+			t.Errorf("/metrics output has no line %q after the previous ones:\n%s", line, out)
+			return
+		}
+		rest = rest[i+len(line):]
+	}
+}
+
+func TestCounterVec(t *testing.T) {
+	c := NewCounterVec("test_counter_total", "Test counter.\nSecond line with \\.", "lang", "outcome")
+	c.Inc("go", "pass")
+	c.Inc("c", "fail")
+	c.Add(2.5, "c", "fail")
+	c.Inc("a\"b\\c\nd", "pass")
+
+	checkLines(t, scrape(t),
+		`# HELP test_counter_total Test counter.\nSecond line with \\.`,
+		`# TYPE test_counter_total counter`,
+		`test_counter_total{lang="a\"b\\c\nd",outcome="pass"} 1`,
+		`test_counter_total{lang="c",outcome="fail"} 3.5`,
+		`test_counter_total{lang="go",outcome="pass"} 1`,
+	)
+}
+
+func TestCounterVecLabels(t *testing.T) {
+	c := NewCounterVec("test_labels_total", "Test counter.", "lang")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Inc with the wrong number of label values didn't panic")
+		}
+	}()
+	c.Inc("go", "pass")
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "Test histogram.", []float64{0.1, 1, 10}, "tool")
+	h.Observe(0.05, "gofmt")
+	h.Observe(0.1, "gofmt")
+	h.Observe(5, "gofmt")
+	h.Observe(60, "gofmt")
+
+	checkLines(t, scrape(t),
+		`# HELP test_duration_seconds Test histogram.`,
+		`# TYPE test_duration_seconds histogram`,
+		`test_duration_seconds_bucket{tool="gofmt",le="0.1"} 2`,
+		`test_duration_seconds_bucket{tool="gofmt",le="1"} 2`,
+		`test_duration_seconds_bucket{tool="gofmt",le="10"} 3`,
+		`test_duration_seconds_bucket{tool="gofmt",le="+Inf"} 4`,
+		`test_duration_seconds_sum{tool="gofmt"} 65.15`,
+		`test_duration_seconds_count{tool="gofmt"} 4`,
+	)
+}
+
+func TestGaugeFunc(t *testing.T) {
+	value := 3.0
+	NewGaugeFunc("test_queue_depth", "Test gauge.", func() float64 { return value })
+	checkLines(t, scrape(t),
+		`# HELP test_queue_depth Test gauge.`,
+		`# TYPE test_queue_depth gauge`,
+		`test_queue_depth 3`,
+	)
+	value = 7
+	checkLines(t, scrape(t), `test_queue_depth 7`)
+}
+
+// TestLinterMetrics checks that the metrics collected by op-web-linter are
+// exported.
+func TestLinterMetrics(t *testing.T) {
+	Requests.Inc("test", "pass")
+	CacheRequests.Inc("hit")
+
+	out := scrape(t)
+	for _, line := range []string{
+		"# TYPE op_web_linter_requests_total counter",
+		"# TYPE op_web_linter_run_requests_total counter",
+		"# TYPE op_web_linter_execute_duration_seconds histogram",
+		"# TYPE op_web_linter_timeouts_total counter",
+		"# TYPE op_web_linter_formatter_failures_total counter",
+		"# TYPE op_web_linter_cache_requests_total counter",
+	} {
+		checkLines(t, out, line)
+	}
+	checkLines(t, out,
+		`op_web_linter_requests_total{lang="test",outcome="pass"} 1`,
+		`op_web_linter_cache_requests_total{result="hit"} 1`,
+	)
+}
@@ -0,0 +1,382 @@
+// Package sarif converts lint responses into SARIF 2.1.0 logs.
+//
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+package sarif
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/osprogramadores/op-web-linter/lang"
+)
+
+// Version and schema of the SARIF logs produced by this package.
+const (
+	Version = "2.1.0"
+	Schema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// MediaType is the MIME type of SARIF logs.
+const MediaType = "application/sarif+json"
+
+// Log is the top level SARIF object.
+type Log struct {
+	Schema  string `json:"$schema"`
+	Version string `json:"version"`
+	Runs    []*Run `json:"runs"`
+}
+
+// Run contains the results of a single tool.
+type Run struct {
+	Tool      Tool        `json:"tool"`
+	Artifacts []*Artifact `json:"artifacts,omitempty"`
+	Results   []*Result   `json:"results"`
+}
+
+// Tool describes the tool that produced a run.
+type Tool struct {
+	Driver Driver `json:"driver"`
+}
+
+// Driver describes the main component of a tool.
+type Driver struct {
+	Name           string                 `json:"name"`
+	InformationURI string                 `json:"informationUri,omitempty"`
+	Rules          []*ReportingDescriptor `json:"rules,omitempty"`
+}
+
+// ReportingDescriptor contains the metadata of a rule.
+type ReportingDescriptor struct {
+	ID      string `json:"id"`
+	HelpURI string `json:"helpUri,omitempty"`
+}
+
+// Artifact describes a file analyzed by a tool.
+type Artifact struct {
+	Location ArtifactLocation `json:"location"`
+	Length   int              `json:"length"`
+}
+
+// ArtifactLocation identifies a file.
+type ArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// Message is a plain text message.
+type Message struct {
+	Text string `json:"text"`
+}
+
+// Result is a single diagnostic.
+type Result struct {
+	RuleID    string      `json:"ruleId,omitempty"`
+	RuleIndex *int        `json:"ruleIndex,omitempty"`
+	Level     string      `json:"level"`
+	Message   Message     `json:"message"`
+	Locations []*Location `json:"locations,omitempty"`
+	Fixes     []*Fix      `json:"fixes,omitempty"`
+}
+
+// Location holds the physical location of a result.
+type Location struct {
+	PhysicalLocation PhysicalLocation `json:"physicalLocation"`
+}
+
+// PhysicalLocation is a region inside a file.
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+	Region           *Region          `json:"region,omitempty"`
+}
+
+// Region is a part of a file, given by line and column numbers (starting at
+// 1) or by character offset and length.
+type Region struct {
+	StartLine   int  `json:"startLine,omitempty"`
+	StartColumn int  `json:"startColumn,omitempty"`
+	EndLine     int  `json:"endLine,omitempty"`
+	EndColumn   int  `json:"endColumn,omitempty"`
+	CharOffset  *int `json:"charOffset,omitempty"`
+	CharLength  *int `json:"charLength,omitempty"`
+}
+
+// Fix is a proposed change to one or more files.
+type Fix struct {
+	Description     Message           `json:"description"`
+	ArtifactChanges []*ArtifactChange `json:"artifactChanges"`
+}
+
+// ArtifactChange contains the changes to a single file.
+type ArtifactChange struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+	Replacements     []*Replacement   `json:"replacements"`
+}
+
+// Replacement replaces a region of a file with new content.
+type Replacement struct {
+	DeletedRegion   Region           `json:"deletedRegion"`
+	InsertedContent *ArtifactContent `json:"insertedContent,omitempty"`
+}
+
+// ArtifactContent holds the contents of (part of) a file.
+type ArtifactContent struct {
+	Text string `json:"text"`
+}
+
+// Information URIs for known tools.
+var toolURIs = map[string]string{
+	"clang-format":       "https://clang.llvm.org/docs/ClangFormat.html",
+	"clang-tidy":         "https://clang.llvm.org/extra/clang-tidy/",
+	"clippy":             "https://doc.rust-lang.org/clippy/",
+	"autopep8":           "https://github.com/hhatto/autopep8",
+	"cargo":              "https://doc.rust-lang.org/cargo/",
+	"eslint":             "https://eslint.org/",
+	"go build":           "https://pkg.go.dev/cmd/go",
+	"go vet":             "https://pkg.go.dev/cmd/vet",
+	"gofmt":              "https://pkg.go.dev/cmd/gofmt",
+	"gotype":             "https://pkg.go.dev/go/types",
+	"google-java-format": "https://github.com/google/google-java-format",
+	"pylint":             "https://pylint.readthedocs.io/",
+	"rustc":              "https://doc.rust-lang.org/rustc/",
+	"rustfmt":            "https://rust-lang.github.io/rustfmt/",
+	"shellcheck":         "https://www.shellcheck.net/",
+	"shfmt":              "https://github.com/mvdan/sh",
+	"staticcheck":        "https://staticcheck.dev/",
+	"tsc":                "https://www.typescriptlang.org/docs/handbook/compiler-options.html",
+}
+
+// FromResponse converts a lint response into a SARIF log with one run per
+// tool, in the order the tools first appear in the diagnostics. The program
+// (original text, as submitted) is identified by uri. If the program was
+// reformatted, the formatter run contains a result with a fix replacing the
+// original text with the reformatted one. Likewise, if the program was fixed,
+// the fixer run contains a result with a fix replacing it with the fixed one.
+func FromResponse(uri, original string, resp lang.LintResponse) *Log {
+	return newLog([]lang.File{{Path: uri, Text: original}}, resp, []fileChange{{
+		name:            "Program",
+		uri:             uri,
+		original:        original,
+		reformatted:     resp.Reformatted,
+		reformattedText: resp.ReformattedText,
+		fixed:           resp.Fixed,
+		fixedText:       resp.FixedText,
+		fixes:           len(resp.Fixes),
+	}})
+}
+
+// FromFiles converts the response to a multi-file lint request into a SARIF
+// log, like FromResponse. Files (as in the request) are identified by their
+// paths, and the fixes replace the text of each file.
+func FromFiles(files []lang.File, resp lang.LintResponse) *Log {
+	original := map[string]string{}
+	for _, f := range files {
+		original[f.Path] = f.Text
+	}
+	var changes []fileChange
+	for _, f := range resp.Files {
+		fixes := 0
+		for _, e := range resp.Fixes {
+			if e.File == f.Path {
+				fixes++
+			}
+		}
+		changes = append(changes, fileChange{
+			name:            f.Path,
+			uri:             f.Path,
+			original:        original[f.Path],
+			reformatted:     f.Reformatted,
+			reformattedText: f.ReformattedText,
+			fixed:           f.Fixed,
+			fixedText:       f.FixedText,
+			fixes:           fixes,
+		})
+	}
+	return newLog(files, resp, changes)
+}
+
+// fileChange holds the changes made to a file by the formatter and the fixers.
+type fileChange struct {
+	name            string // Name used in messages (E.g. "Program").
+	uri             string
+	original        string
+	reformatted     bool
+	reformattedText string
+	fixed           bool
+	fixedText       string
+	fixes           int // Number of changes made by the fixers.
+}
+
+// newLog creates a SARIF log with the diagnostics in the response and the
+// changes made to the files. Diagnostics without a file refer to the first
+// one in single file programs, and have no location otherwise.
+func newLog(files []lang.File, resp lang.LintResponse, changes []fileChange) *Log {
+	log := &Log{Schema: Schema, Version: Version, Runs: []*Run{}}
+	runs := map[string]*Run{}
+
+	run := func(tool string) *Run {
+		if r, ok := runs[tool]; ok {
+			return r
+		}
+		r := &Run{
+			Tool:    Tool{Driver: Driver{Name: tool, InformationURI: toolURIs[tool]}},
+			Results: []*Result{},
+		}
+		for _, f := range files {
+			r.Artifacts = append(r.Artifacts, &Artifact{
+				Location: ArtifactLocation{URI: f.Path},
+				Length:   len(f.Text),
+			})
+		}
+		runs[tool] = r
+		log.Runs = append(log.Runs, r)
+		return r
+	}
+
+	for _, d := range resp.Diagnostics {
+		uri := d.File
+		if uri == "" && len(files) == 1 {
+			uri = files[0].Path
+		}
+		r := run(d.Tool)
+		r.Results = append(r.Results, result(r, uri, d))
+	}
+
+	for _, c := range changes {
+		if c.reformatted && resp.Formatter != "" {
+			r := run(resp.Formatter)
+			r.Results = append(r.Results, replaceResult(c.uri, c.original, c.reformattedText,
+				fmt.Sprintf("%s should be reformatted with %s.", c.name, resp.Formatter),
+				fmt.Sprintf("Reformat with %s", resp.Formatter)))
+		}
+	}
+
+	if len(resp.Fixes) > 0 {
+		tool := resp.Fixes[0].Tool
+		for _, c := range changes {
+			if c.fixed && c.fixes > 0 {
+				r := run(tool)
+				r.Results = append(r.Results, replaceResult(c.uri, c.original, c.fixedText,
+					fmt.Sprintf("%s can be fixed automatically with %s (%d changes).", c.name, tool, c.fixes),
+					fmt.Sprintf("Apply fixes from %s", tool)))
+			}
+		}
+	}
+	return log
+}
+
+// result converts a diagnostic into a result, adding its rule to the run.
+func result(r *Run, uri string, d lang.Diagnostic) *Result {
+	msg := d.Message
+	if len(d.Context) > 0 {
+		msg += "\n" + strings.Join(d.Context, "\n")
+	}
+	res := &Result{
+		RuleID:  d.RuleID,
+		Level:   level(d.Severity),
+		Message: Message{Text: msg},
+	}
+	if d.RuleID != "" {
+		idx := ruleIndex(r, d.RuleID)
+		res.RuleIndex = &idx
+	}
+	// Locations refer to the original program. Columns are only kept when
+	// the tool ran on the original text.
+	if d.OriginalLine > 0 && uri != "" {
+		region := &Region{StartLine: d.OriginalLine, EndLine: d.OriginalEndLine}
+		if d.Source == lang.SourceOriginal {
+			region.StartColumn, region.EndColumn = d.Column, d.EndColumn
+		}
+		res.Locations = []*Location{{
+			PhysicalLocation: PhysicalLocation{
+				ArtifactLocation: ArtifactLocation{URI: uri},
+				Region:           region,
+			},
+		}}
+	}
+	return res
+}
+
+// replaceResult returns a note with a fix replacing the whole original text
+// with the given text (E.g. the reformatted text).
+func replaceResult(uri, original, text, msg, desc string) *Result {
+	// Offsets and lengths are in UTF-16 code units by default.
+	offset, length := 0, len(utf16.Encode([]rune(original)))
+	return &Result{
+		Level:   "note",
+		Message: Message{Text: msg},
+		Locations: []*Location{{
+			PhysicalLocation: PhysicalLocation{ArtifactLocation: ArtifactLocation{URI: uri}},
+		}},
+		Fixes: []*Fix{{
+			Description: Message{Text: desc},
+			ArtifactChanges: []*ArtifactChange{{
+				ArtifactLocation: ArtifactLocation{URI: uri},
+				Replacements: []*Replacement{{
+					DeletedRegion:   Region{CharOffset: &offset, CharLength: &length},
+					InsertedContent: &ArtifactContent{Text: text},
+				}},
+			}},
+		}},
+	}
+}
+
+// ruleIndex returns the index of the rule in the run's rules, adding it
+// (with a help link for known tools) if needed.
+func ruleIndex(r *Run, id string) int {
+	driver := &r.Tool.Driver
+	for i, rule := range driver.Rules {
+		if rule.ID == id {
+			return i
+		}
+	}
+	driver.Rules = append(driver.Rules, &ReportingDescriptor{ID: id, HelpURI: helpURI(driver.Name, id)})
+	return len(driver.Rules) - 1
+}
+
+// helpURI returns the documentation link for a rule of a known tool, or "".
+func helpURI(tool, id string) string {
+	switch tool {
+	case "clang-tidy":
+		// Checks are documented under their group (E.g. bugprone-foo-bar
+		// is at bugprone/foo-bar.html).
+		if name, ok := strings.CutPrefix(id, "clang-analyzer-"); ok {
+			return fmt.Sprintf("https://clang.llvm.org/extra/clang-tidy/checks/clang-analyzer/%s.html", name)
+		}
+		if group, name, ok := strings.Cut(id, "-"); ok {
+			return fmt.Sprintf("https://clang.llvm.org/extra/clang-tidy/checks/%s/%s.html", group, name)
+		}
+	case "clippy":
+		if name, ok := strings.CutPrefix(id, "clippy::"); ok {
+			return "https://rust-lang.github.io/rust-clippy/master/index.html#" + name
+		}
+	case "rustc":
+		// Only error codes (E.g. E0425) are documented, not lint names.
+		if strings.HasPrefix(id, "E") {
+			return fmt.Sprintf("https://doc.rust-lang.org/error_codes/%s.html", id)
+		}
+	case "shellcheck":
+		return lang.ShellcheckWikiURL(id)
+	case "staticcheck":
+		return "https://staticcheck.dev/docs/checks/#" + id
+	case "eslint":
+		if !strings.Contains(id, "/") {
+			return "https://eslint.org/docs/latest/rules/" + id
+		}
+		if name, ok := strings.CutPrefix(id, "@typescript-eslint/"); ok {
+			return "https://typescript-eslint.io/rules/" + name
+		}
+	}
+	return ""
+}
+
+// level converts a diagnostic severity into a SARIF level.
+func level(severity string) string {
+	switch strings.ToLower(severity) {
+	case "error", "fatal", "e", "f":
+		return "error"
+	case "note", "info", "style", "convention", "refactor", "c", "r", "i":
+		return "note"
+	}
+	return "warning"
+}
@@ -0,0 +1,249 @@
+// This file is part of op-web-linter.
+// See github.com/osprogramadores/op-web-linter for licensing and details.
+
+package sarif
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/osprogramadores/op-web-linter/lang"
+)
+
+// toolNames returns the names of the tools in the runs of a log.
+func toolNames(log *Log) []string {
+	var names []string
+	for _, r := range log.Runs {
+		names = append(names, r.Tool.Driver.Name)
+	}
+	return names
+}
+
+func TestFromResponse(t *testing.T) {
+	original := "x=1\ny = 'é'\n"
+	resp := lang.LintResponse{
+		Diagnostics: []lang.Diagnostic{
+			{Tool: "pylint", Line: 2, Column: 5, EndLine: 2, EndColumn: 8, Severity: "convention", RuleID: "C0103", Message: "bad name", Source: lang.SourceOriginal, OriginalLine: 2, OriginalEndLine: 2},
+			{Tool: "autopep8", Line: 3, Column: 2, Severity: "warning", RuleID: "E225", Message: "missing whitespace", Context: []string{"x=1"}, Source: lang.SourceReformatted, OriginalLine: 1},
+			{Tool: "pylint", Line: 1, Severity: "error", RuleID: "C0103", Message: "bad name again", Source: lang.SourceOriginal, OriginalLine: 1},
+			{Tool: "pylint", Severity: "fatal", Message: "no location"},
+		},
+		Reformatted:     true,
+		ReformattedText: "x = 1\ny = 'é'\n",
+		Formatter:       "autopep8",
+	}
+	log := FromResponse("main.py", original, resp)
+
+	if log.Version != Version || log.Schema != Schema {
+		t.Errorf("FromResponse returned version %q and schema %q, want %q and %q", log.Version, log.Schema, Version, Schema)
+	}
+	if got, want := toolNames(log), []string{"pylint", "autopep8"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("FromResponse returned runs for %v, want %v", got, want)
+	}
+
+	pylint := log.Runs[0]
+	if want := []*Artifact{{Location: ArtifactLocation{URI: "main.py"}, Length: len(original)}}; !reflect.DeepEqual(pylint.Artifacts, want) {
+		t.Errorf("pylint run has artifacts %+v, want %+v", pylint.Artifacts, want)
+	}
+	if want := "https://pylint.readthedocs.io/"; pylint.Tool.Driver.InformationURI != want {
+		t.Errorf("pylint run has information URI %q, want %q", pylint.Tool.Driver.InformationURI, want)
+	}
+	if got := len(pylint.Tool.Driver.Rules); got != 1 {
+		t.Errorf("pylint run has %d rules, want 1 (rules are not repeated)", got)
+	}
+	if got := len(pylint.Results); got != 3 {
+		t.Fatalf("pylint run has %d results, want 3", got)
+	}
+	first := pylint.Results[0]
+	if first.Level != "note" || first.RuleIndex == nil || *first.RuleIndex != 0 {
+		t.Errorf("first pylint result has level %q and rule index %v, want note and 0", first.Level, first.RuleIndex)
+	}
+	if want := (&Region{StartLine: 2, StartColumn: 5, EndLine: 2, EndColumn: 8}); !reflect.DeepEqual(first.Locations[0].PhysicalLocation.Region, want) {
+		t.Errorf("first pylint result has region %+v, want %+v", first.Locations[0].PhysicalLocation.Region, want)
+	}
+	if second := pylint.Results[1]; second.Level != "error" || *second.RuleIndex != 0 {
+		t.Errorf("second pylint result has level %q and rule index %d, want error and 0", second.Level, *second.RuleIndex)
+	}
+	if third := pylint.Results[2]; third.Locations != nil || third.RuleIndex != nil || third.Level != "error" {
+		t.Errorf("pylint result without line or rule has locations %v, rule index %v and level %q", third.Locations, third.RuleIndex, third.Level)
+	}
+
+	autopep8 := log.Runs[1]
+	if got := len(autopep8.Results); got != 2 {
+		t.Fatalf("autopep8 run has %d results, want 2", got)
+	}
+	// Columns in the reformatted text don't apply to the original.
+	diag := autopep8.Results[0]
+	if want := (&Region{StartLine: 1}); !reflect.DeepEqual(diag.Locations[0].PhysicalLocation.Region, want) {
+		t.Errorf("autopep8 result has region %+v, want %+v", diag.Locations[0].PhysicalLocation.Region, want)
+	}
+	if want := "missing whitespace\nx=1"; diag.Message.Text != want {
+		t.Errorf("autopep8 result has message %q, want %q", diag.Message.Text, want)
+	}
+
+	reformat := autopep8.Results[1]
+	if reformat.Level != "note" || len(reformat.Fixes) != 1 {
+		t.Fatalf("reformat result has level %q and %d fixes, want note and 1", reformat.Level, len(reformat.Fixes))
+	}
+	change := reformat.Fixes[0].ArtifactChanges[0]
+	if change.ArtifactLocation.URI != "main.py" || len(change.Replacements) != 1 {
+		t.Fatalf("reformat fix changes %q with %d replacements, want main.py and 1", change.ArtifactLocation.URI, len(change.Replacements))
+	}
+	repl := change.Replacements[0]
+	// The original text has 13 bytes, but 12 UTF-16 code units.
+	if *repl.DeletedRegion.CharOffset != 0 || *repl.DeletedRegion.CharLength != 12 {
+		t.Errorf("reformat fix deletes %d characters at %d, want 12 at 0", *repl.DeletedRegion.CharLength, *repl.DeletedRegion.CharOffset)
+	}
+	if repl.InsertedContent.Text != resp.ReformattedText {
+		t.Errorf("reformat fix inserts %q, want %q", repl.InsertedContent.Text, resp.ReformattedText)
+	}
+
+	data, err := json.Marshal(log)
+	if err != nil {
+		t.Fatalf("Unable to marshal log: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unable to unmarshal log: %v", err)
+	}
+	if decoded["$schema"] != Schema || decoded["version"] != Version {
+		t.Errorf("Marshaled log has $schema %v and version %v", decoded["$schema"], decoded["version"])
+	}
+}
+
+func TestFromResponseFixed(t *testing.T) {
+	resp := lang.LintResponse{
+		Fixed:     true,
+		FixedText: "fixed\n",
+		Fixes: []lang.FixEdit{
+			{Tool: "eslint", Line: 1, OldLines: 1, NewLines: 1, OldText: "a\n", NewText: "fixed\n"},
+			{Tool: "eslint", Line: 2, OldLines: 1, OldText: "b\n"},
+		},
+	}
+	log := FromResponse("main.js", "a\nb\n", resp)
+	if got, want := toolNames(log), []string{"eslint"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("FromResponse returned runs for %v, want %v", got, want)
+	}
+	results := log.Runs[0].Results
+	if len(results) != 1 {
+		t.Fatalf("eslint run has %d results, want 1", len(results))
+	}
+	if want := "Program can be fixed automatically with eslint (2 changes)."; results[0].Message.Text != want {
+		t.Errorf("fix result has message %q, want %q", results[0].Message.Text, want)
+	}
+	if got := results[0].Fixes[0].ArtifactChanges[0].Replacements[0].InsertedContent.Text; got != "fixed\n" {
+		t.Errorf("fix result inserts %q, want %q", got, "fixed\n")
+	}
+}
+
+func TestFromResponseEmpty(t *testing.T) {
+	log := FromResponse("main.c", "int main() {}\n", lang.LintResponse{Pass: true})
+	data, err := json.Marshal(log)
+	if err != nil {
+		t.Fatalf("Unable to marshal log: %v", err)
+	}
+	if want := `{"$schema":"` + Schema + `","version":"2.1.0","runs":[]}`; string(data) != want {
+		t.Errorf("Empty log = %s, want %s", data, want)
+	}
+}
+
+func TestFromFiles(t *testing.T) {
+	files := []lang.File{
+		{Path: "main.c", Text: "#include \"util.h\"\n"},
+		{Path: "src/util.h", Text: "void f();\n"},
+	}
+	resp := lang.LintResponse{
+		Diagnostics: []lang.Diagnostic{
+			{Tool: "clang-tidy", File: "src/util.h", Line: 1, Column: 6, Severity: "warning", RuleID: "readability-foo", Message: "foo", Source: lang.SourceOriginal, OriginalLine: 1},
+			{Tool: "gcc", Severity: "error", Message: "linker error"},
+		},
+		Reformatted: true,
+		Formatter:   "clang-format",
+		Files: []lang.FileResponse{
+			{Path: "main.c"},
+			{Path: "src/util.h", Reformatted: true, ReformattedText: "void f(void);\n"},
+		},
+	}
+	log := FromFiles(files, resp)
+	if got, want := toolNames(log), []string{"clang-tidy", "gcc", "clang-format"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("FromFiles returned runs for %v, want %v", got, want)
+	}
+	tidy := log.Runs[0]
+	if got := len(tidy.Artifacts); got != 2 {
+		t.Errorf("clang-tidy run has %d artifacts, want 2", got)
+	}
+	if got := tidy.Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI; got != "src/util.h" {
+		t.Errorf("clang-tidy result refers to %q, want %q", got, "src/util.h")
+	}
+	if want := "https://clang.llvm.org/extra/clang-tidy/checks/readability/foo.html"; tidy.Tool.Driver.Rules[0].HelpURI != want {
+		t.Errorf("clang-tidy rule has help URI %q, want %q", tidy.Tool.Driver.Rules[0].HelpURI, want)
+	}
+	// Diagnostics without a file have no location in multi-file programs.
+	if got := log.Runs[1].Results[0].Locations; got != nil {
+		t.Errorf("gcc result without file has locations %+v, want none", got)
+	}
+	format := log.Runs[2].Results
+	if len(format) != 1 {
+		t.Fatalf("clang-format run has %d results, want 1 (only reformatted files)", len(format))
+	}
+	if want := "src/util.h should be reformatted with clang-format."; format[0].Message.Text != want {
+		t.Errorf("clang-format result has message %q, want %q", format[0].Message.Text, want)
+	}
+	if got := *format[0].Fixes[0].ArtifactChanges[0].Replacements[0].DeletedRegion.CharLength; got != len(files[1].Text) {
+		t.Errorf("clang-format fix deletes %d characters, want %d", got, len(files[1].Text))
+	}
+}
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		severity string
+		want     string
+	}{
+		{"error", "error"},
+		{"Error", "error"},
+		{"fatal", "error"},
+		{"E", "error"},
+		{"warning", "warning"},
+		{"W", "warning"},
+		{"", "warning"},
+		{"unknown", "warning"},
+		{"note", "note"},
+		{"info", "note"},
+		{"style", "note"},
+		{"convention", "note"},
+		{"refactor", "note"},
+		{"C", "note"},
+	}
+	for _, tt := range tests {
+		if got := level(tt.severity); got != tt.want {
+			t.Errorf("level(%q) = %q, want %q", tt.severity, got, tt.want)
+		}
+	}
+}
+
+func TestHelpURI(t *testing.T) {
+	tests := []struct {
+		tool, id string
+		want     string
+	}{
+		{"clang-tidy", "bugprone-use-after-move", "https://clang.llvm.org/extra/clang-tidy/checks/bugprone/use-after-move.html"},
+		{"clang-tidy", "clang-analyzer-core.NullDereference", "https://clang.llvm.org/extra/clang-tidy/checks/clang-analyzer/core.NullDereference.html"},
+		{"clang-tidy", "nodash", ""},
+		{"clippy", "clippy::needless_return", "https://rust-lang.github.io/rust-clippy/master/index.html#needless_return"},
+		{"clippy", "dead_code", ""},
+		{"rustc", "E0425", "https://doc.rust-lang.org/error_codes/E0425.html"},
+		{"rustc", "unused_variables", ""},
+		{"shellcheck", "SC2086", "https://www.shellcheck.net/wiki/SC2086"},
+		{"staticcheck", "SA4006", "https://staticcheck.dev/docs/checks/#SA4006"},
+		{"eslint", "no-unused-vars", "https://eslint.org/docs/latest/rules/no-unused-vars"},
+		{"eslint", "@typescript-eslint/no-explicit-any", "https://typescript-eslint.io/rules/no-explicit-any"},
+		{"eslint", "plugin/rule", ""},
+		{"pylint", "C0103", ""},
+	}
+	for _, tt := range tests {
+		if got := helpURI(tt.tool, tt.id); got != tt.want {
+			t.Errorf("helpURI(%q, %q) = %q, want %q", tt.tool, tt.id, got, tt.want)
+		}
+	}
+}
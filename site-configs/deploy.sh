@@ -35,6 +35,8 @@ function deploy_local_copy() {
       chown -R \"${PROJECT_UID}\" \"${DATA_DIR}\";
       chmod 755 \"${DATA_DIR}\";
       cp site-configs/*.service /etc/systemd/system;
+      mkdir -p \"/etc/${PROJECT}\";
+      cp site-configs/seccomp.json \"/etc/${PROJECT}\";
       systemctl daemon-reload;
       systemctl restart \"${PROJECT}\"
 EOF
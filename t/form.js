@@ -10,6 +10,9 @@ let editor;
 // Spinner
 let spinner;
 
+// Editor markers highlighting lines changed by the reformatter.
+let reformatMarkers = [];
+
 function formOnload() {
     // Setup the ACE editor.
     editor = ace.edit("editor");
@@ -55,9 +58,38 @@ function formOnload() {
 
     // Spinner
     spinner = document.getElementById("pleasewait");
+
+    loadChallenges();
+}
+
+// loadChallenges fills the challenge picker with the challenges known to the
+// server, and shows it if there are any.
+function loadChallenges() {
+    const xhttp = new XMLHttpRequest();
+    xhttp.open("GET", "{{.ChallengesPath}}", true);
+
+    xhttp.onreadystatechange = function () {
+        if (this.readyState !== 4 || this.status !== 200) {
+            return;
+        }
+        const res = JSON.parse(this.responseText);
+        const challengeSet = document.getElementById("challengeSelect");
+        for (const c of res.Challenges) {
+            const opt = document.createElement("option");
+            opt.value = c.ID;
+            opt.textContent = c.Title;
+            challengeSet.appendChild(opt);
+        }
+        if (res.Challenges.length > 0) {
+            document.getElementById("challengeRow").style.display = "flex";
+        }
+    };
+    xhttp.send();
 }
 
-function lint() {
+// lint sends the program to the linter. If fix is true, the linters also
+// apply their automatic fixes, and the fixed program replaces the editor text.
+function lint(fix) {
     spinner.style.visibility = "visible";
 
     const xhttp = new XMLHttpRequest();
@@ -73,9 +105,17 @@ function lint() {
         if (this.readyState === 4) {
             if (this.status === 200) {
                 const res = JSON.parse(this.responseText);
-                // Update editor text if code reformatted.
+                // Update editor text if code reformatted and highlight
+                // the changes.
+                clearReformatMarkers();
                 if (res.Reformatted === true) {
-                    editor.setValue(res.ReformattedText);
+                    editor.setValue(res.ReformattedText, -1);
+                    markReformattedLines(res.Hunks || []);
+                }
+                // Fixed text includes the reformatting, if any.
+                if (res.Fixed === true) {
+                    clearReformatMarkers();
+                    editor.setValue(res.FixedText, -1);
                 }
 
                 eid = "results_ok";
@@ -99,12 +139,46 @@ function lint() {
     // Send
     const programText = encodeURIComponent(editor.getValue());
     const lang = document.getElementById("languageSelect");
-    const req = JSON.stringify({ lang: lang.value, text: programText });
+    const challenge = document.getElementById("challengeSelect");
+    const req = JSON.stringify({
+        lang: lang.value,
+        text: programText,
+        fix: fix === true,
+        challenge: challenge.value
+    });
 
     xhttp.setRequestHeader("Content-type", "application/json");
     xhttp.send(req);
 }
 
+// markReformattedLines highlights the lines added or changed by the
+// reformatter, as described by the diff hunks in the response.
+function markReformattedLines(hunks) {
+    const Range = ace.require("ace/range").Range;
+    for (const hunk of hunks) {
+        // NewStart is 1-based; ACE rows are 0-based.
+        let row = hunk.NewStart - 1;
+        for (const line of hunk.Lines) {
+            if (line.startsWith("-")) {
+                continue;
+            }
+            if (line.startsWith("+")) {
+                reformatMarkers.push(editor.session.addMarker(
+                    new Range(row, 0, row, 1), "reformatted-line", "fullLine"));
+            }
+            row++;
+        }
+    }
+}
+
+// clearReformatMarkers removes the highlights added by markReformattedLines.
+function clearReformatMarkers() {
+    for (const id of reformatMarkers) {
+        editor.session.removeMarker(id);
+    }
+    reformatMarkers = [];
+}
+
 // SetACELang sets the language used by the ACE editor.
 function SetACELang(langobj) {
     // Ugly hack: ACE considers C and C++ a single language: c_cpp